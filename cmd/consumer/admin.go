@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"kafka-go-study/internal/kafka"
+	"net/http"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func adminAddr() string {
+	if a := os.Getenv("ADMIN_ADDR"); a != "" {
+		return a
+	}
+	return ":8082"
+}
+
+type pauseRequest struct {
+	Reason string `json:"reason"`
+}
+
+type rateLimitRequest struct {
+	PerSecond float64 `json:"per_second"`
+	Burst     int     `json:"burst"`
+	Reason    string  `json:"reason"`
+}
+
+// newAdminApp exposes the flow state of consumer and lets operators pause,
+// resume and throttle it at runtime.
+func newAdminApp(consumer *kafka.Consumer) *fiber.App {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+
+	app.Get("/health", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"status": "ok"})
+	})
+	app.Get("/admin/consumer", func(c *fiber.Ctx) error {
+		return c.JSON(consumer.FlowState())
+	})
+	app.Post("/admin/consumer/pause", func(c *fiber.Ctx) error {
+		req := pauseRequest{Reason: "paused via admin endpoint"}
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+			}
+		}
+		consumer.Pause(req.Reason)
+		return c.JSON(consumer.FlowState())
+	})
+	app.Post("/admin/consumer/resume", func(c *fiber.Ctx) error {
+		req := pauseRequest{Reason: "resumed via admin endpoint"}
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+			}
+		}
+		consumer.Resume(req.Reason)
+		return c.JSON(consumer.FlowState())
+	})
+	app.Put("/admin/consumer/rate-limit", func(c *fiber.Ctx) error {
+		req := rateLimitRequest{Reason: "changed via admin endpoint"}
+		if err := c.BodyParser(&req); err != nil || req.PerSecond < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		if req.Burst <= 0 {
+			req.Burst = max(int(req.PerSecond), 1)
+		}
+		consumer.SetRateLimit(req.PerSecond, req.Burst, req.Reason)
+		return c.JSON(consumer.FlowState())
+	})
+
+	return app
+}
+
+// httpHealthCheck fails when url does not answer 200 OK.
+func httpHealthCheck(client *http.Client, url string) kafka.HealthCheck {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s returned %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
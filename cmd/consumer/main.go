@@ -1,91 +1,87 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
+	"kafka-go-study/internal/config"
+	"kafka-go-study/internal/dedup"
 	"kafka-go-study/internal/kafka"
-	"kafka-go-study/internal/models"
+	"kafka-go-study/internal/order"
+	"kafka-go-study/internal/payment"
 	"kafka-go-study/internal/telemetry"
-	"math/rand/v2"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/baggage"
-	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/metric"
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 const (
-	orderTopic   = "orders"
-	paymentTopic = "payments"
-	groupID      = "order-processor"
+	orderTopic     = "orders"
+	paymentTopic   = "payments"
+	groupID        = "order-processor"
+	handlerTimeout = 10 * time.Second
+
+	// paymentGroupID consumed payments before groupID and hands over its offsets.
+	paymentGroupID = "payment-processor"
 )
 
-func brokerAddr() string {
-	if b := os.Getenv("KAFKA_BROKER"); b != "" {
-		return b
-	}
-	return "localhost:9092"
-}
+var retryDelays = []time.Duration{5 * time.Second, time.Minute, 10 * time.Minute}
 
-func paymentAPIAddr() string {
-	if a := os.Getenv("PAYMENT_API_ADDR"); a != "" {
-		return a
-	}
-	return "http://localhost:8081"
+func main() {
+	os.Exit(run())
 }
 
-var (
-	log             *zap.Logger
-	paymentProducer *kafka.Producer
-	metrics         *telemetry.Metrics
-	tracer          trace.Tracer
-	httpClient      *http.Client
-	propagator      propagation.TextMapPropagator
-)
-
-func main() {
+func run() int {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	var (
-		meter    metric.Meter
-		shutdown func(context.Context)
-		err      error
-	)
-
-	log, tracer, meter, shutdown, err = telemetry.Setup(ctx, "consumer")
+	log, tracer, meter, shutdown, err := telemetry.Setup(ctx, "consumer")
 	if err != nil {
 		panic("failed to initialize telemetry: " + err.Error())
 	}
 	defer shutdown(context.Background())
 
-	metrics, err = telemetry.NewMetrics(meter)
+	metrics, err := telemetry.NewMetrics(meter)
 	if err != nil {
 		panic("failed to create metrics: " + err.Error())
 	}
 
-	httpClient = &http.Client{Timeout: 5 * time.Second}
-	propagator = propagation.TraceContext{}
+	partitionKey, err := order.ParsePartitionKey(config.PartitionKey())
+	if err != nil {
+		panic("invalid ORDER_PARTITION_KEY: " + err.Error())
+	}
 
-	addr := brokerAddr()
+	addr := config.Broker()
+
+	// The seek looks up the partitions of both topics.
+	for _, t := range []string{orderTopic, paymentTopic} {
+		if err := kafka.CreateTopic(ctx, addr, t, 3, 1); err != nil {
+			log.Warn("failed to create topic (may already exist)", zap.String("topic", t), zap.Error(err))
+		}
+	}
 
-	if err := kafka.CreateTopic(ctx, addr, paymentTopic, 3, 1); err != nil {
-		log.Warn("failed to create topic payments (may already exist)", zap.Error(err))
+	var failureTopics []string
+	for _, t := range []string{orderTopic, paymentTopic} {
+		failureTopics = append(failureTopics, kafka.DeadLetterTopic(t))
+		for _, d := range retryDelays {
+			failureTopics = append(failureTopics, kafka.RetryTopic(t, d))
+		}
+	}
+	for _, t := range failureTopics {
+		if err := kafka.CreateTopic(ctx, addr, t, 3, 1); err != nil {
+			log.Warn("failed to create topic (may already exist)", zap.String("topic", t), zap.Error(err))
+		}
 	}
 
-	paymentProducer = kafka.NewProducer([]string{addr}, paymentTopic)
+	paymentProducer := kafka.NewProducer([]string{addr}, paymentTopic, kafka.WithCodec(config.MessageCodec()), config.Balancer(), config.CloudEvents(), config.Spill())
 	defer paymentProducer.Close()
 
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	orders := order.NewProcessor(paymentProducer, partitionKey, log, tracer)
+	payments := payment.NewProcessor(httpClient, config.PaymentAPIAddr(), log, tracer)
+
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
@@ -94,144 +90,58 @@ func main() {
 		cancel()
 	}()
 
-	orderConsumer := kafka.NewConsumer([]string{addr}, orderTopic, groupID)
-	defer orderConsumer.Close()
-
-	paymentConsumer := kafka.NewConsumer([]string{addr}, paymentTopic, "payment-processor")
-	defer paymentConsumer.Close()
+	dedupStore, err := dedup.OpenBoltStore(config.DedupPath(), 24*time.Hour)
+	if err != nil {
+		panic("failed to open dedup store: " + err.Error())
+	}
+	defer dedupStore.Close()
+
+	middleware := kafka.WithMiddleware(
+		kafka.Tracing(),
+		kafka.Logging(log),
+		kafka.Metrics(metrics),
+		kafka.Recover(),
+		kafka.Deduplicate(dedupStore, kafka.DedupKey(kafka.HeaderMessageID), metrics),
+		kafka.Timeout(handlerTimeout),
+	)
 
-	log.Info("consumers started",
-		zap.String("order_topic", orderTopic),
-		zap.String("payment_topic", paymentTopic),
+	consumer := kafka.NewMultiTopicConsumer([]string{addr}, []string{orderTopic, paymentTopic}, groupID,
+		kafka.WithMetrics(metrics),
+		kafka.WithLogger(log),
+		config.RegistryCodecs(),
+		config.SpanRelation(),
+		config.DrainTimeout(),
+		middleware,
+		kafka.WithRetryTiers(retryDelays...),
+		kafka.WithDeadLetter(),
+		config.Concurrency(),
+		config.RateLimit(),
+		kafka.WithStartFromGroup(paymentGroupID),
+		kafka.WithHealthCheck("payment-api", 5*time.Second, httpHealthCheck(httpClient, config.PaymentAPIAddr()+"/health")),
 	)
+	defer consumer.Close()
 
+	admin := newAdminApp(consumer)
 	go func() {
-		if err := paymentConsumer.Listen(ctx, processPayment); err != nil {
-			log.Error("payment consumer error", zap.Error(err))
+		log.Info("consumer admin listening", zap.String("addr", adminAddr()))
+		if err := admin.Listen(adminAddr()); err != nil {
+			log.Error("admin server error", zap.Error(err))
 		}
 	}()
+	defer admin.Shutdown()
 
-	if err := orderConsumer.Listen(ctx, processOrder); err != nil {
-		log.Error("order consumer error", zap.Error(err))
-	}
-}
-
-func processOrder(ctx context.Context, key, value []byte) error {
-	ctx, span := tracer.Start(ctx, "ProcessOrder",
-		trace.WithSpanKind(trace.SpanKindConsumer),
-	)
-	defer span.End()
-
-	var order models.Order
-	if err := json.Unmarshal(value, &order); err != nil {
-		span.RecordError(err)
-		span.SetStatus(codes.Error, "failed to unmarshal order")
-		return err
-	}
-
-	span.SetAttributes(
-		attribute.String("order.id", order.ID),
-		attribute.String("order.customer_id", order.CustomerID),
-		attribute.Int64("order.total_cents", order.TotalCents),
-	)
-
-	bag := baggage.FromContext(ctx)
-	customerID := order.CustomerID
-	if cid := bag.Member("customer_id").Value(); cid != "" {
-		customerID = cid
-	}
-
-	_, sleepSpan := tracer.Start(ctx, "SimulateProcessingDelay")
-	delay := time.Duration(50+rand.IntN(451)) * time.Millisecond
-	sleepSpan.SetAttributes(attribute.Int64("delay_ms", delay.Milliseconds()))
-	time.Sleep(delay)
-	sleepSpan.End()
-
-	attrs := metric.WithAttributes(attribute.String("customer_id", customerID))
-	metrics.MessagesConsumed.Add(ctx, 1, attrs)
-	metrics.ProcessingTime.Record(ctx, delay.Seconds(), attrs)
-
-	payment := models.Payment{
-		OrderID:     order.ID,
-		CustomerID:  customerID,
-		TotalCents:  order.TotalCents,
-		Status:      "confirmed",
-		ConfirmedAt: time.Now(),
-	}
-
-	if err := paymentProducer.Publish(ctx, order.ID, payment); err != nil {
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
-		return err
-	}
-
-	span.SetStatus(codes.Ok, "")
-	log.Info("order processed, payment published",
-		zap.String("order_id", order.ID),
-		zap.String("customer_id", customerID),
-		zap.Int64("total_cents", order.TotalCents),
-		zap.Duration("processing_delay", delay),
-	)
-
-	return nil
-}
-
-func processPayment(ctx context.Context, key, value []byte) error {
-	ctx, span := tracer.Start(ctx, "ProcessPayment",
-		trace.WithSpanKind(trace.SpanKindConsumer),
-	)
-	defer span.End()
-
-	var payment models.Payment
-	if err := json.Unmarshal(value, &payment); err != nil {
-		span.RecordError(err)
-		span.SetStatus(codes.Error, "failed to unmarshal payment")
-		return err
-	}
-
-	span.SetAttributes(
-		attribute.String("payment.order_id", payment.OrderID),
-		attribute.String("payment.customer_id", payment.CustomerID),
-		attribute.Int64("payment.total_cents", payment.TotalCents),
+	log.Info("consumer started",
+		zap.String("order_topic", orderTopic),
+		zap.String("payment_topic", paymentTopic),
 	)
 
-	body, _ := json.Marshal(map[string]any{
-		"order_id":    payment.OrderID,
-		"customer_id": payment.CustomerID,
-		"total_cents": payment.TotalCents,
+	handler := kafka.RouteByTopic(map[string]kafka.HandlerFunc{
+		orderTopic:   orders.Process,
+		paymentTopic: payments.Process,
 	})
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
-		paymentAPIAddr()+"/payments/confirm", bytes.NewReader(body))
-	if err != nil {
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
-		return err
+	if err := consumer.Listen(ctx, handler); err != nil {
+		log.Error("consumer error", zap.Error(err))
+		return 1
 	}
-	req.Header.Set("Content-Type", "application/json")
-	propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
-
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		err = fmt.Errorf("payment-api returned %d", resp.StatusCode)
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
-		return err
-	}
-
-	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
-	span.SetStatus(codes.Ok, "")
-	log.Info("payment confirmed via payment-api",
-		zap.String("order_id", payment.OrderID),
-		zap.String("customer_id", payment.CustomerID),
-	)
-
-	return nil
+	return 0
 }
@@ -2,25 +2,21 @@ package main
 
 import (
 	"context"
+	"kafka-go-study/internal/config"
 	"kafka-go-study/internal/kafka"
 	"kafka-go-study/internal/order"
+	"kafka-go-study/internal/outbox"
 	"kafka-go-study/internal/telemetry"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/gofiber/contrib/otelfiber"
 	"github.com/gofiber/fiber/v2"
 	"go.uber.org/zap"
 )
 
-func brokerAddr() string {
-	if b := os.Getenv("KAFKA_BROKER"); b != "" {
-		return b
-	}
-	return "localhost:9092"
-}
-
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -36,15 +32,38 @@ func main() {
 		panic("failed to create metrics: " + err.Error())
 	}
 
-	addr := brokerAddr()
+	partitionKey, err := order.ParsePartitionKey(config.PartitionKey())
+	if err != nil {
+		panic("invalid ORDER_PARTITION_KEY: " + err.Error())
+	}
+
+	addr := config.Broker()
 	if err := kafka.CreateTopic(ctx, addr, "orders", 3, 1); err != nil {
 		log.Warn("failed to create topic orders (may already exist)", zap.Error(err))
 	}
 
-	producer := kafka.NewProducer([]string{addr}, "orders")
+	// The relay publishes outbox records in batches in the background.
+	producer := kafka.NewProducer([]string{addr}, "orders", kafka.WithAsync(1000, 100, 10*time.Millisecond), config.Balancer(), config.CloudEvents(), config.Spill())
 	defer producer.Close()
 
-	uc := order.NewUseCase(producer, metrics, log, tracer)
+	store, err := outbox.OpenStore(config.OutboxPath(), config.MessageCodec())
+	if err != nil {
+		panic("failed to open outbox store: " + err.Error())
+	}
+	defer store.Close()
+
+	relay := outbox.NewRelay(store, map[string]*kafka.Producer{"orders": producer}, log)
+	relayDone := make(chan struct{})
+	go func() {
+		defer close(relayDone)
+		relay.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-relayDone
+	}()
+
+	uc := order.NewUseCase(store, "orders", partitionKey, metrics, log, tracer)
 	ctrl := order.NewController(uc, log, tracer)
 
 	app := fiber.New(fiber.Config{DisableStartupMessage: true})
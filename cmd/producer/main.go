@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"kafka-go-study/internal/config"
 	"kafka-go-study/internal/kafka"
 	"kafka-go-study/internal/models"
 	"kafka-go-study/internal/telemetry"
@@ -20,13 +21,6 @@ import (
 
 const topic = "events"
 
-func brokerAddr() string {
-	if b := os.Getenv("KAFKA_BROKER"); b != "" {
-		return b
-	}
-	return "localhost:9092"
-}
-
 var (
 	log     *zap.Logger
 	tracer  trace.Tracer
@@ -62,13 +56,13 @@ func main() {
 		cancel()
 	}()
 
-	addr := brokerAddr()
+	addr := config.Broker()
 
 	if err := kafka.CreateTopic(ctx, addr, topic, 3, 1); err != nil {
 		log.Warn("failed to create topic (may already exist)", zap.Error(err))
 	}
 
-	producer := kafka.NewProducer([]string{addr}, topic)
+	producer := kafka.NewProducer([]string{addr}, topic, kafka.WithCodec(config.MessageCodec()), config.Balancer(), config.CloudEvents(), config.Spill())
 	defer producer.Close()
 
 	log.Info("producer started", zap.String("broker", addr), zap.String("topic", topic))
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"kafka-go-study/internal/config"
+	"kafka-go-study/internal/kafka"
+	"kafka-go-study/internal/order"
+	"kafka-go-study/internal/payment"
+	"kafka-go-study/internal/telemetry"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+// run re-delivers a range of a topic to one of the consumer handlers, on a
+// throwaway consumer group, deleted on exit, and exits once every partition
+// reached the end of the range.
+func run() int {
+	defaultGroup := fmt.Sprintf("replay-%d", time.Now().Unix())
+	var (
+		topic   = flag.String("topic", "orders", "topic to replay")
+		handler = flag.String("handler", "", "handler to run: orders or payments (default: same as -topic)")
+		from    = flag.String("from", "", "replay messages produced at or after this RFC 3339 time (default: earliest)")
+		until   = flag.String("until", "", "replay messages produced before this RFC 3339 time (default: now)")
+		offsets = flag.String("offsets", "", "start offsets per partition, e.g. 0:120,1:98; overrides -from")
+		group   = flag.String("group", defaultGroup, "consumer group used for the replay (default: a throwaway group)")
+		output  = flag.String("output-topic", "", "topic the orders handler publishes payments to (default: none, dry run)")
+		api     = flag.String("payment-api", "", "payment-api address the payments handler confirms on (default: none, dry run)")
+	)
+	flag.Parse()
+	if *handler == "" {
+		*handler = *topic
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	log, tracer, meter, shutdown, err := telemetry.Setup(ctx, "replay")
+	if err != nil {
+		panic("failed to initialize telemetry: " + err.Error())
+	}
+	defer shutdown(context.Background())
+
+	metrics, err := telemetry.NewMetrics(meter)
+	if err != nil {
+		panic("failed to create metrics: " + err.Error())
+	}
+
+	partitionKey, err := order.ParsePartitionKey(config.PartitionKey())
+	if err != nil {
+		panic("invalid ORDER_PARTITION_KEY: " + err.Error())
+	}
+
+	brokers := []string{config.Broker()}
+
+	var handle kafka.HandlerFunc
+	switch *handler {
+	case "orders":
+		var publisher order.Publisher = dryRunPublisher{log}
+		if *output != "" {
+			producer := kafka.NewProducer(brokers, *output, kafka.WithCodec(config.MessageCodec()), config.Balancer(), config.CloudEvents())
+			defer producer.Close()
+			publisher = producer
+			log.Info("replay publishes payments", zap.String("output_topic", *output))
+		} else {
+			log.Info("dry run: replay publishes no payments, set -output-topic to publish them")
+		}
+		handle = order.NewProcessor(publisher, partitionKey, log, tracer).Process
+	case "payments":
+		client := &http.Client{Timeout: 5 * time.Second}
+		addr := *api
+		if addr != "" {
+			log.Info("replay confirms payments", zap.String("payment_api", addr))
+		} else {
+			client.Transport = dryRunTransport{log}
+			addr = "http://dry-run"
+			log.Info("dry run: replay confirms no payments, set -payment-api to confirm them")
+		}
+		handle = payment.NewProcessor(client, addr, log, tracer).Process
+	default:
+		log.Error("unknown handler", zap.String("handler", *handler))
+		return 2
+	}
+
+	start, end, err := replayRange(ctx, brokers, *topic, *from, *until, *offsets)
+	if err != nil {
+		log.Error("failed to resolve replay range", zap.Error(err))
+		return 1
+	}
+
+	progress := newReplayProgress(start, end, cancel)
+	if progress.finished() {
+		log.Info("nothing to replay", zap.String("topic", *topic))
+		return 0
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		log.Info("stopping replay...")
+		cancel()
+	}()
+
+	consumer := kafka.NewConsumer(brokers, *topic, *group,
+		kafka.WithLogger(log),
+		config.RegistryCodecs(),
+		kafka.WithStartOffsets(start),
+		kafka.WithoutCommit(),
+		kafka.WithSpanAttributes(attribute.Bool("replay", true)),
+		kafka.WithMiddleware(
+			progress.middleware(),
+			kafka.Tracing(),
+			kafka.Logging(log),
+			kafka.Metrics(metrics),
+			kafka.Recover(),
+		),
+	)
+	defer func() {
+		_ = consumer.Close()
+		if *group != defaultGroup {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := kafka.DeleteGroup(ctx, brokers, *group); err != nil {
+			log.Warn("failed to delete replay group", zap.String("group", *group), zap.Error(err))
+		}
+	}()
+
+	log.Info("replay started",
+		zap.String("topic", *topic),
+		zap.String("handler", *handler),
+		zap.String("group", *group),
+		zap.Any("start_offsets", start),
+		zap.Any("end_offsets", end),
+	)
+
+	if err := consumer.Listen(ctx, handle); err != nil {
+		log.Error("replay failed", zap.Error(err))
+		return 1
+	}
+	log.Info("replay finished", zap.Int("messages", progress.replayed()))
+	return 0
+}
+
+// dryRunPublisher logs the payments the orders handler would publish.
+type dryRunPublisher struct {
+	log *zap.Logger
+}
+
+func (p dryRunPublisher) Publish(_ context.Context, key string, value any) error {
+	p.log.Info("dry run: payment not published", zap.String("key", key), zap.Any("payment", value))
+	return nil
+}
+
+// dryRunTransport logs the confirmations the payments handler would send and
+// answers them with 200 OK.
+type dryRunTransport struct {
+	log *zap.Logger
+}
+
+func (t dryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.log.Info("dry run: payment not confirmed", zap.String("method", req.Method), zap.String("path", req.URL.Path))
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
+
+// replayRange resolves the first offset to replay and the offset to stop at
+// for every partition of topic.
+func replayRange(ctx context.Context, brokers []string, topic, from, until, offsets string) (start, end map[int]int64, err error) {
+	switch {
+	case offsets != "":
+		start, err = parseOffsets(offsets)
+	case from != "":
+		var t time.Time
+		if t, err = time.Parse(time.RFC3339, from); err != nil {
+			return nil, nil, fmt.Errorf("invalid -from: %w", err)
+		}
+		start, err = kafka.OffsetsAt(ctx, brokers, topic, t)
+	default:
+		start, err = kafka.OffsetsAt(ctx, brokers, topic, time.Unix(0, 0))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if until == "" {
+		end, err = kafka.LatestOffsets(ctx, brokers, topic)
+	} else {
+		var t time.Time
+		if t, err = time.Parse(time.RFC3339, until); err != nil {
+			return nil, nil, fmt.Errorf("invalid -until: %w", err)
+		}
+		end, err = kafka.OffsetsAt(ctx, brokers, topic, t)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return start, end, nil
+}
+
+func parseOffsets(s string) (map[int]int64, error) {
+	offsets := make(map[int]int64)
+	for _, pair := range strings.Split(s, ",") {
+		p, o, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid -offsets entry %q, want partition:offset", pair)
+		}
+		partition, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid partition in %q: %w", pair, err)
+		}
+		offset, err := strconv.ParseInt(o, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid offset in %q: %w", pair, err)
+		}
+		offsets[partition] = offset
+	}
+	return offsets, nil
+}
+
+// replayProgress skips messages past the end of the range and cancels the
+// replay once every partition reached it.
+type replayProgress struct {
+	mu      sync.Mutex
+	end     map[int]int64
+	pending map[int]bool
+	count   int
+	done    context.CancelFunc
+}
+
+// newReplayProgress only replays the partitions in start: the others have no
+// start offset, so the group would read them from the beginning.
+func newReplayProgress(start, end map[int]int64, done context.CancelFunc) *replayProgress {
+	p := &replayProgress{end: make(map[int]int64), pending: make(map[int]bool), done: done}
+	for partition, offset := range start {
+		p.end[partition] = end[partition]
+		if offset < end[partition] {
+			p.pending[partition] = true
+		}
+	}
+	return p
+}
+
+func (p *replayProgress) middleware() kafka.Middleware {
+	return func(next kafka.HandlerFunc) kafka.HandlerFunc {
+		return func(ctx context.Context, msg kafka.Message) error {
+			end, ok := p.end[msg.Partition]
+			if !ok {
+				return nil
+			}
+			if msg.Offset >= end {
+				p.advance(msg, false)
+				return nil
+			}
+			err := next(ctx, msg)
+			p.advance(msg, true)
+			return err
+		}
+	}
+}
+
+// advance records that msg was reached, and handled if it was in the range.
+// The last offset of the range may never be delivered, e.g. when it was
+// compacted away or is a transaction marker, so any offset at or past it
+// finishes the partition.
+func (p *replayProgress) advance(msg kafka.Message, handled bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if handled {
+		p.count++
+	}
+	if msg.Offset >= p.end[msg.Partition]-1 {
+		delete(p.pending, msg.Partition)
+	}
+	if len(p.pending) == 0 {
+		p.done()
+	}
+}
+
+func (p *replayProgress) finished() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.pending) == 0
+}
+
+func (p *replayProgress) replayed() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.count
+}
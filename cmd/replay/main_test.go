@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"kafka-go-study/internal/kafka"
+	"kafka-go-study/internal/payment"
+	"maps"
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/zap"
+)
+
+func TestParseOffsets(t *testing.T) {
+	got, err := parseOffsets("0:10, 2:0,1:7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[int]int64{0: 10, 1: 7, 2: 0}; !maps.Equal(got, want) {
+		t.Errorf("parseOffsets = %v, want %v", got, want)
+	}
+
+	for _, s := range []string{"", "0", "a:1", "0:b", "0:1;1:2"} {
+		if _, err := parseOffsets(s); err == nil {
+			t.Errorf("parseOffsets(%q) succeeded", s)
+		}
+	}
+}
+
+func TestReplayProgress(t *testing.T) {
+	cancelled := false
+	p := newReplayProgress(
+		map[int]int64{0: 5, 1: 3},
+		map[int]int64{0: 7, 1: 3, 2: 9},
+		func() { cancelled = true },
+	)
+	if p.finished() {
+		t.Fatal("finished before replaying partition 0")
+	}
+
+	var handled []int64
+	handler := p.middleware()(func(_ context.Context, msg kafka.Message) error {
+		handled = append(handled, msg.Offset)
+		return nil
+	})
+	for _, msg := range []kafka.Message{
+		{Partition: 2, Offset: 0}, // no start offset
+		{Partition: 0, Offset: 5},
+		{Partition: 1, Offset: 3}, // produced after the range
+		{Partition: 0, Offset: 6},
+		{Partition: 0, Offset: 7},
+	} {
+		if err := handler(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+		if cancelled != (msg.Partition == 0 && msg.Offset >= 6) {
+			t.Fatalf("cancelled = %v after partition %d offset %d", cancelled, msg.Partition, msg.Offset)
+		}
+	}
+
+	if len(handled) != 2 || handled[0] != 5 || handled[1] != 6 {
+		t.Errorf("handled offsets %v, want [5 6]", handled)
+	}
+	if !p.finished() || p.replayed() != 2 {
+		t.Errorf("finished = %v with %d replayed, want 2", p.finished(), p.replayed())
+	}
+}
+
+func TestReplayProgressGapAtEnd(t *testing.T) {
+	cancelled := false
+	// Offset 7, the last of the range, was compacted away.
+	p := newReplayProgress(map[int]int64{0: 5}, map[int]int64{0: 8}, func() { cancelled = true })
+
+	var handled []int64
+	handler := p.middleware()(func(_ context.Context, msg kafka.Message) error {
+		handled = append(handled, msg.Offset)
+		return nil
+	})
+	for _, offset := range []int64{5, 6, 9} {
+		if err := handler(context.Background(), kafka.Message{Partition: 0, Offset: offset}); err != nil {
+			t.Fatal(err)
+		}
+		if cancelled != (offset == 9) {
+			t.Fatalf("cancelled = %v after offset %d", cancelled, offset)
+		}
+	}
+
+	if len(handled) != 2 || !p.finished() || p.replayed() != 2 {
+		t.Errorf("handled %v, finished = %v with %d replayed, want [5 6] and finished", handled, p.finished(), p.replayed())
+	}
+}
+
+func TestDryRunPaymentsAreNotConfirmed(t *testing.T) {
+	client := &http.Client{Transport: dryRunTransport{zap.NewNop()}}
+	processor := payment.NewProcessor(client, "http://dry-run", zap.NewNop(), noop.NewTracerProvider().Tracer("test"))
+
+	msg := kafka.Message{Value: []byte(`{"order_id":"o-1","customer_id":"c-1","total_cents":100}`)}
+	if err := processor.Process(t.Context(), msg); err != nil {
+		t.Errorf("Process = %v, want the dry run to succeed", err)
+	}
+}
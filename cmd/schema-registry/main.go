@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"kafka-go-study/internal/schemaregistry"
+	"kafka-go-study/internal/telemetry"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+)
+
+func listenAddr() string {
+	if a := os.Getenv("SCHEMA_REGISTRY_ADDR"); a != "" {
+		return a
+	}
+	return ":8085"
+}
+
+// schema-registry serves the in-memory fake registry, so producers and
+// consumers can use the Confluent wire format without a real one. Schemas are
+// lost on restart.
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	log, _, _, shutdown, err := telemetry.Setup(ctx, "schema-registry")
+	if err != nil {
+		panic("failed to initialize telemetry: " + err.Error())
+	}
+	defer shutdown(context.Background())
+
+	srv := &http.Server{Addr: listenAddr(), Handler: schemaregistry.NewFake()}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		log.Info("shutting down schema-registry...")
+		_ = srv.Shutdown(context.Background())
+		cancel()
+	}()
+
+	log.Info("schema-registry listening", zap.String("addr", srv.Addr))
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error("server error", zap.Error(err))
+	}
+}
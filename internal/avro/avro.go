@@ -0,0 +1,194 @@
+// Package avro implements the primitive types of the Avro binary encoding,
+// enough to hand-write encoders for fixed schemas.
+package avro
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+var ErrShortBuffer = errors.New("avro: unexpected end of data")
+
+// Encoder appends Avro binary values to a buffer.
+type Encoder struct {
+	buf []byte
+}
+
+// Long writes a long, which Avro encodes as a zig-zag varint.
+func (e *Encoder) Long(v int64) {
+	e.buf = binary.AppendVarint(e.buf, v)
+}
+
+func (e *Encoder) Int(v int32) {
+	e.Long(int64(v))
+}
+
+func (e *Encoder) Boolean(v bool) {
+	if v {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *Encoder) Float(v float32) {
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, math.Float32bits(v))
+}
+
+func (e *Encoder) Double(v float64) {
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(v))
+}
+
+// Fixed writes b as is, without a length.
+func (e *Encoder) Fixed(b []byte) {
+	e.buf = append(e.buf, b...)
+}
+
+func (e *Encoder) Bytes(b []byte) {
+	e.Long(int64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *Encoder) String(s string) {
+	e.Long(int64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// TimestampMillis writes t as a long with the timestamp-millis logical type.
+func (e *Encoder) TimestampMillis(t time.Time) {
+	e.Long(t.UnixMilli())
+}
+
+// Strings writes an array of strings as a single block.
+func (e *Encoder) Strings(ss []string) {
+	if len(ss) > 0 {
+		e.Long(int64(len(ss)))
+		for _, s := range ss {
+			e.String(s)
+		}
+	}
+	e.Long(0)
+}
+
+func (e *Encoder) Data() []byte {
+	return e.buf
+}
+
+// Decoder reads Avro binary values. The first error is kept and returned by
+// Err; reads after it return zero values.
+type Decoder struct {
+	data []byte
+	err  error
+}
+
+func NewDecoder(data []byte) *Decoder {
+	return &Decoder{data: data}
+}
+
+func (d *Decoder) Long() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.err = ErrShortBuffer
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *Decoder) Int() int32 {
+	return int32(d.Long())
+}
+
+func (d *Decoder) Boolean() bool {
+	b := d.Fixed(1)
+	return len(b) == 1 && b[0] != 0
+}
+
+func (d *Decoder) Float() float32 {
+	b := d.Fixed(4)
+	if b == nil {
+		return 0
+	}
+	return math.Float32frombits(binary.LittleEndian.Uint32(b))
+}
+
+func (d *Decoder) Double() float64 {
+	b := d.Fixed(8)
+	if b == nil {
+		return 0
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b))
+}
+
+func (d *Decoder) Bytes() []byte {
+	n := d.Long()
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > int64(len(d.data)) {
+		d.err = fmt.Errorf("avro: invalid length %d", n)
+		return nil
+	}
+	return d.Fixed(int(n))
+}
+
+// Fixed reads n bytes.
+func (d *Decoder) Fixed(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.data) {
+		d.err = ErrShortBuffer
+		return nil
+	}
+	b := d.data[:n:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *Decoder) String() string {
+	return string(d.Bytes())
+}
+
+func (d *Decoder) TimestampMillis() time.Time {
+	return time.UnixMilli(d.Long())
+}
+
+// Strings reads an array of strings, in any number of blocks.
+func (d *Decoder) Strings() []string {
+	var ss []string
+	for {
+		n := d.blockCount()
+		if d.err != nil || n == 0 {
+			return ss
+		}
+		for range n {
+			s := d.String()
+			if d.err != nil {
+				return ss
+			}
+			ss = append(ss, s)
+		}
+	}
+}
+
+// blockCount reads the item count of the next array or map block.
+func (d *Decoder) blockCount() int64 {
+	n := d.Long()
+	if n < 0 {
+		// A negative count is followed by the block size in bytes.
+		n = -n
+		d.Long()
+	}
+	return n
+}
+
+func (d *Decoder) Err() error {
+	return d.err
+}
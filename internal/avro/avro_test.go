@@ -0,0 +1,119 @@
+package avro
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	at := time.UnixMilli(1700000000123)
+
+	var e Encoder
+	e.Long(-1)
+	e.Long(1 << 40)
+	e.Int(-64)
+	e.Boolean(true)
+	e.Float(1.5)
+	e.Double(-2.25)
+	e.Bytes([]byte{0, 1, 2})
+	e.Fixed([]byte("abcd"))
+	e.String("olá")
+	e.TimestampMillis(at)
+	e.Strings([]string{"a", "b"})
+	e.Strings(nil)
+
+	d := NewDecoder(e.Data())
+	if v := d.Long(); v != -1 {
+		t.Errorf("Long = %d, want -1", v)
+	}
+	if v := d.Long(); v != 1<<40 {
+		t.Errorf("Long = %d, want %d", v, int64(1<<40))
+	}
+	if v := d.Int(); v != -64 {
+		t.Errorf("Int = %d, want -64", v)
+	}
+	if !d.Boolean() {
+		t.Error("Boolean = false, want true")
+	}
+	if v := d.Float(); v != 1.5 {
+		t.Errorf("Float = %v, want 1.5", v)
+	}
+	if v := d.Double(); v != -2.25 {
+		t.Errorf("Double = %v, want -2.25", v)
+	}
+	if v := d.Bytes(); !bytes.Equal(v, []byte{0, 1, 2}) {
+		t.Errorf("Bytes = %v, want [0 1 2]", v)
+	}
+	if v := d.Fixed(4); string(v) != "abcd" {
+		t.Errorf("Fixed = %q, want abcd", v)
+	}
+	if v := d.String(); v != "olá" {
+		t.Errorf("String = %q, want olá", v)
+	}
+	if v := d.TimestampMillis(); !v.Equal(at) {
+		t.Errorf("TimestampMillis = %v, want %v", v, at)
+	}
+	if v := d.Strings(); !slices.Equal(v, []string{"a", "b"}) {
+		t.Errorf("Strings = %q, want [a b]", v)
+	}
+	if v := d.Strings(); v != nil {
+		t.Errorf("Strings = %q, want none", v)
+	}
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLongIsZigZag(t *testing.T) {
+	// Examples from the Avro specification.
+	for v, want := range map[int64][]byte{0: {0x00}, -1: {0x01}, 1: {0x02}, -2: {0x03}, 64: {0x80, 0x01}} {
+		var e Encoder
+		e.Long(v)
+		if !bytes.Equal(e.Data(), want) {
+			t.Errorf("Long(%d) = %x, want %x", v, e.Data(), want)
+		}
+	}
+}
+
+func TestDecodeStringsInBlocks(t *testing.T) {
+	// Two blocks, the second with a negative count followed by its size.
+	var e Encoder
+	e.Long(1)
+	e.String("a")
+	e.Long(-2)
+	e.Long(4)
+	e.String("b")
+	e.String("c")
+	e.Long(0)
+
+	d := NewDecoder(e.Data())
+	if v := d.Strings(); !slices.Equal(v, []string{"a", "b", "c"}) || d.Err() != nil {
+		t.Errorf("Strings = %q, %v, want [a b c]", v, d.Err())
+	}
+}
+
+func TestDecoderKeepsFirstError(t *testing.T) {
+	var e Encoder
+	e.String("truncated")
+	data := e.Data()
+
+	d := NewDecoder(data[:len(data)-1])
+	if v := d.String(); v != "" {
+		t.Errorf("String = %q from a short buffer", v)
+	}
+	if v := d.Long(); v != 0 {
+		t.Errorf("Long = %d after an error, want 0", v)
+	}
+	if err := d.Err(); err == nil {
+		t.Error("Err = nil after reading past the end")
+	}
+
+	d = NewDecoder(nil)
+	d.Double()
+	if err := d.Err(); !errors.Is(err, ErrShortBuffer) {
+		t.Errorf("Err = %v, want %v", err, ErrShortBuffer)
+	}
+}
@@ -0,0 +1,342 @@
+package avro
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// CanRead returns an error naming the first difference that prevents data
+// written with writer from being read with reader, following the Avro schema
+// resolution rules.
+func CanRead(reader, writer *Schema) error {
+	return canRead(reader, writer, "", make(map[[2]*Schema]bool))
+}
+
+func canRead(r, w *Schema, path string, seen map[[2]*Schema]bool) error {
+	if w.Type == "union" {
+		for _, b := range w.Branches {
+			if err := canRead(r, b, path, seen); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if r.Type == "union" {
+		if readerBranch(r, w) < 0 {
+			return fmt.Errorf("%s: no branch of the reader union can read %s", at(path), w.Type)
+		}
+		return nil
+	}
+	if promotable(w.Type, r.Type) {
+		return nil
+	}
+	if r.Type != w.Type {
+		return fmt.Errorf("%s: cannot read %s as %s", at(path), w.Type, r.Type)
+	}
+
+	switch r.Type {
+	case "record":
+		if r.shortName() != w.shortName() {
+			return fmt.Errorf("%s: cannot read record %s as %s", at(path), w.Name, r.Name)
+		}
+		if seen[[2]*Schema{r, w}] {
+			return nil
+		}
+		seen[[2]*Schema{r, w}] = true
+		for _, rf := range r.Fields {
+			wf := w.field(rf.Name)
+			if wf == nil {
+				if !rf.HasDefault {
+					return fmt.Errorf("%s: field %q is missing from the writer schema and has no default", at(path), rf.Name)
+				}
+				continue
+			}
+			if err := canRead(rf.Type, wf.Type, path+"."+rf.Name, seen); err != nil {
+				return err
+			}
+		}
+	case "enum":
+		for _, sym := range w.Symbols {
+			if !slices.Contains(r.Symbols, sym) {
+				return fmt.Errorf("%s: enum symbol %q is unknown to the reader", at(path), sym)
+			}
+		}
+	case "fixed":
+		if r.Size != w.Size {
+			return fmt.Errorf("%s: cannot read fixed of size %d as %d", at(path), w.Size, r.Size)
+		}
+	case "array":
+		return canRead(r.Items, w.Items, path+"[]", seen)
+	case "map":
+		return canRead(r.Values, w.Values, path+"{}", seen)
+	}
+	return nil
+}
+
+// Resolve re-encodes data, written with writer, as the reader schema lays it
+// out: fields are reordered, dropped or filled with their defaults, and
+// numbers are promoted.
+func Resolve(data []byte, writer, reader *Schema) ([]byte, error) {
+	if err := CanRead(reader, writer); err != nil {
+		return nil, err
+	}
+	d := NewDecoder(data)
+	var e Encoder
+	if err := resolve(d, &e, writer, reader); err != nil {
+		return nil, err
+	}
+	if err := d.Err(); err != nil {
+		return nil, err
+	}
+	return e.Data(), nil
+}
+
+func resolve(d *Decoder, e *Encoder, w, r *Schema) error {
+	if w.Type == "union" {
+		i := d.Long()
+		if d.err != nil || i < 0 || i >= int64(len(w.Branches)) {
+			return fmt.Errorf("avro: invalid union branch %d", i)
+		}
+		return resolve(d, e, w.Branches[i], r)
+	}
+	if r.Type == "union" {
+		i := readerBranch(r, w)
+		e.Long(int64(i))
+		return resolve(d, e, w, r.Branches[i])
+	}
+
+	switch w.Type {
+	case "null":
+	case "boolean":
+		e.Boolean(d.Boolean())
+	case "int", "long":
+		v := d.Long()
+		switch r.Type {
+		case "float":
+			e.Float(float32(v))
+		case "double":
+			e.Double(float64(v))
+		default:
+			e.Long(v)
+		}
+	case "float":
+		v := d.Float()
+		if r.Type == "double" {
+			e.Double(float64(v))
+		} else {
+			e.Float(v)
+		}
+	case "double":
+		e.Double(d.Double())
+	case "bytes", "string":
+		e.Bytes(d.Bytes())
+	case "fixed":
+		e.Fixed(d.Fixed(w.Size))
+	case "enum":
+		i := d.Long()
+		if d.err != nil || i < 0 || i >= int64(len(w.Symbols)) {
+			return fmt.Errorf("avro: invalid enum index %d", i)
+		}
+		e.Long(int64(slices.Index(r.Symbols, w.Symbols[i])))
+	case "array", "map":
+		for {
+			n := d.blockCount()
+			if d.err != nil {
+				return d.err
+			}
+			e.Long(n)
+			if n == 0 {
+				return nil
+			}
+			for range n {
+				var err error
+				if w.Type == "map" {
+					e.String(d.String())
+					err = resolve(d, e, w.Values, r.Values)
+				} else {
+					err = resolve(d, e, w.Items, r.Items)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+	case "record":
+		values := make(map[string][]byte, len(w.Fields))
+		for _, wf := range w.Fields {
+			var fe Encoder
+			target := wf.Type
+			if rf := r.field(wf.Name); rf != nil {
+				target = rf.Type
+			}
+			if err := resolve(d, &fe, wf.Type, target); err != nil {
+				return err
+			}
+			values[wf.Name] = fe.Data()
+		}
+		for _, rf := range r.Fields {
+			if v, ok := values[rf.Name]; ok {
+				e.Fixed(v)
+				continue
+			}
+			if err := encodeDefault(e, rf.Type, rf.Default); err != nil {
+				return fmt.Errorf("avro: invalid default of %s.%s: %w", r.Name, rf.Name, err)
+			}
+		}
+	default:
+		return fmt.Errorf("avro: unsupported type %s", w.Type)
+	}
+	return d.Err()
+}
+
+// encodeDefault writes the JSON default value of a field of type s.
+func encodeDefault(e *Encoder, s *Schema, raw json.RawMessage) error {
+	switch s.Type {
+	case "union":
+		// Defaults of unions are values of their first branch.
+		e.Long(0)
+		return encodeDefault(e, s.Branches[0], raw)
+	case "null":
+		return nil
+	case "boolean":
+		var v bool
+		err := json.Unmarshal(raw, &v)
+		e.Boolean(v)
+		return err
+	case "int", "long":
+		var v int64
+		err := json.Unmarshal(raw, &v)
+		e.Long(v)
+		return err
+	case "float":
+		var v float32
+		err := json.Unmarshal(raw, &v)
+		e.Float(v)
+		return err
+	case "double":
+		var v float64
+		err := json.Unmarshal(raw, &v)
+		e.Double(v)
+		return err
+	case "string", "bytes", "fixed", "enum":
+		var v string
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return err
+		}
+		switch s.Type {
+		case "string":
+			e.String(v)
+		case "enum":
+			e.Long(int64(slices.Index(s.Symbols, v)))
+		default:
+			// Byte defaults are strings of code points 0-255.
+			b := make([]byte, 0, len(v))
+			for _, r := range v {
+				b = append(b, byte(r))
+			}
+			if s.Type == "bytes" {
+				e.Bytes(b)
+			} else {
+				e.Fixed(b)
+			}
+		}
+		return nil
+	case "array":
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return err
+		}
+		if len(items) > 0 {
+			e.Long(int64(len(items)))
+			for _, item := range items {
+				if err := encodeDefault(e, s.Items, item); err != nil {
+					return err
+				}
+			}
+		}
+		e.Long(0)
+		return nil
+	case "map":
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return err
+		}
+		if len(values) > 0 {
+			e.Long(int64(len(values)))
+			for k, v := range values {
+				e.String(k)
+				if err := encodeDefault(e, s.Values, v); err != nil {
+					return err
+				}
+			}
+		}
+		e.Long(0)
+		return nil
+	case "record":
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return err
+		}
+		for _, f := range s.Fields {
+			v, ok := values[f.Name]
+			if !ok {
+				v = f.Default
+			}
+			if err := encodeDefault(e, f.Type, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported type %s", s.Type)
+}
+
+// readerBranch returns the first branch of the reader union r that can read
+// w, or -1.
+func readerBranch(r, w *Schema) int {
+	for i, b := range r.Branches {
+		if b.Type == w.Type && canRead(b, w, "", make(map[[2]*Schema]bool)) == nil {
+			return i
+		}
+	}
+	for i, b := range r.Branches {
+		if canRead(b, w, "", make(map[[2]*Schema]bool)) == nil {
+			return i
+		}
+	}
+	return -1
+}
+
+func promotable(from, to string) bool {
+	switch from {
+	case "int":
+		return to == "long" || to == "float" || to == "double"
+	case "long":
+		return to == "float" || to == "double"
+	case "float":
+		return to == "double"
+	case "string":
+		return to == "bytes"
+	case "bytes":
+		return to == "string"
+	}
+	return false
+}
+
+func (s *Schema) field(name string) *Field {
+	for i := range s.Fields {
+		if s.Fields[i].Name == name {
+			return &s.Fields[i]
+		}
+	}
+	return nil
+}
+
+func at(path string) string {
+	if path == "" {
+		return "schema"
+	}
+	return strings.TrimPrefix(path, ".")
+}
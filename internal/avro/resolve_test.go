@@ -0,0 +1,233 @@
+package avro
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func mustParse(t *testing.T, text string) *Schema {
+	t.Helper()
+	s, err := ParseSchema(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestParseSchemaNamedTypes(t *testing.T) {
+	s := mustParse(t, `{
+		"type": "record", "name": "Node", "namespace": "shop",
+		"fields": [
+			{"name": "status", "type": {"type": "enum", "name": "Status", "symbols": ["NEW", "PAID"]}},
+			{"name": "previous", "type": "Status", "default": "NEW"},
+			{"name": "next", "type": ["null", "shop.Node"], "default": null}
+		]
+	}`)
+
+	if s.Name != "shop.Node" || len(s.Fields) != 3 {
+		t.Fatalf("parsed %s with %d fields", s.Name, len(s.Fields))
+	}
+	if status := s.Fields[0].Type; status.Name != "shop.Status" || s.Fields[1].Type != status {
+		t.Errorf("Status is not resolved by its short name within the namespace")
+	}
+	if next := s.Fields[2].Type; next.Type != "union" || next.Branches[1] != s {
+		t.Errorf("recursive reference is not resolved to the record")
+	}
+	if f := s.Fields[2]; !f.HasDefault || string(f.Default) != "null" {
+		t.Errorf("default of next = %s, %v, want null", f.Default, f.HasDefault)
+	}
+	if s.Fields[0].HasDefault {
+		t.Error("status has a default")
+	}
+
+	if _, err := ParseSchema(`{"type": "record", "name": "A", "fields": [{"name": "b", "type": "B"}]}`); err == nil {
+		t.Error("unknown type B was accepted")
+	}
+}
+
+func TestCanRead(t *testing.T) {
+	for _, tt := range []struct {
+		name, reader, writer string
+		wantErr              string
+	}{
+		{"promotes int", `"double"`, `"int"`, ""},
+		{"does not narrow", `"int"`, `"long"`, "cannot read long as int"},
+		{"string as bytes", `"bytes"`, `"string"`, ""},
+		{
+			"added field with default",
+			`{"type": "record", "name": "R", "fields": [{"name": "a", "type": "int"}, {"name": "b", "type": "string", "default": "x"}]}`,
+			`{"type": "record", "name": "R", "fields": [{"name": "a", "type": "int"}]}`,
+			"",
+		},
+		{
+			"added field without default",
+			`{"type": "record", "name": "R", "fields": [{"name": "a", "type": "int"}, {"name": "b", "type": "string"}]}`,
+			`{"type": "record", "name": "R", "fields": [{"name": "a", "type": "int"}]}`,
+			`field "b" is missing`,
+		},
+		{
+			"changed field type",
+			`{"type": "record", "name": "R", "fields": [{"name": "a", "type": "string"}]}`,
+			`{"type": "record", "name": "R", "fields": [{"name": "a", "type": "int"}]}`,
+			"a: cannot read int as string",
+		},
+		{
+			"renamed record",
+			`{"type": "record", "name": "S", "fields": []}`,
+			`{"type": "record", "name": "R", "fields": []}`,
+			"cannot read record R as S",
+		},
+		{
+			"namespaces are ignored",
+			`{"type": "record", "name": "a.R", "fields": []}`,
+			`{"type": "record", "name": "b.R", "fields": []}`,
+			"",
+		},
+		{
+			"removed enum symbol",
+			`{"type": "enum", "name": "E", "symbols": ["A"]}`,
+			`{"type": "enum", "name": "E", "symbols": ["A", "B"]}`,
+			`enum symbol "B"`,
+		},
+		{"fixed size", `{"type": "fixed", "name": "F", "size": 4}`, `{"type": "fixed", "name": "F", "size": 8}`, "size 8 as 4"},
+		{"array items", `{"type": "array", "items": "long"}`, `{"type": "array", "items": "int"}`, ""},
+		{"map values", `{"type": "map", "values": "int"}`, `{"type": "map", "values": "string"}`, "{}: cannot read string as int"},
+		{"into a union", `["null", "string"]`, `"string"`, ""},
+		{"into a union without the branch", `["null", "int"]`, `"string"`, "no branch"},
+		{"out of a union", `"string"`, `["null", "string"]`, "cannot read null as string"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CanRead(mustParse(t, tt.reader), mustParse(t, tt.writer))
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("CanRead = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("CanRead = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolveRecord(t *testing.T) {
+	writer := mustParse(t, `{
+		"type": "record", "name": "Order",
+		"fields": [
+			{"name": "id", "type": "string"},
+			{"name": "dropped", "type": "string"},
+			{"name": "total", "type": "int"},
+			{"name": "status", "type": {"type": "enum", "name": "Status", "symbols": ["NEW", "PAID"]}},
+			{"name": "items", "type": {"type": "array", "items": "int"}},
+			{"name": "note", "type": ["null", "string"]}
+		]
+	}`)
+	reader := mustParse(t, `{
+		"type": "record", "name": "Order",
+		"fields": [
+			{"name": "total", "type": "double"},
+			{"name": "id", "type": "string"},
+			{"name": "status", "type": {"type": "enum", "name": "Status", "symbols": ["PAID", "NEW", "CANCELLED"]}},
+			{"name": "items", "type": {"type": "array", "items": "long"}},
+			{"name": "note", "type": ["null", "string"]},
+			{"name": "currency", "type": "string", "default": "BRL"},
+			{"name": "tags", "type": {"type": "map", "values": "int"}, "default": {"a": 1}},
+			{"name": "coupon", "type": ["null", "string"], "default": null}
+		]
+	}`)
+
+	var e Encoder
+	e.String("o-1")
+	e.String("gone")
+	e.Int(4250)
+	e.Long(1) // PAID
+	e.Long(2)
+	e.Long(7)
+	e.Long(8)
+	e.Long(0)
+	e.Long(1) // string branch
+	e.String("gift")
+
+	data, err := Resolve(e.Data(), writer, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(data)
+	if v := d.Double(); v != 4250 {
+		t.Errorf("total = %v, want 4250", v)
+	}
+	if v := d.String(); v != "o-1" {
+		t.Errorf("id = %q, want o-1", v)
+	}
+	if v := d.Long(); v != 0 {
+		t.Errorf("status = %d, want 0 (PAID in the reader's symbols)", v)
+	}
+	if n, a, b, end := d.Long(), d.Long(), d.Long(), d.Long(); n != 2 || a != 7 || b != 8 || end != 0 {
+		t.Errorf("items = %d [%d %d] %d, want one block of [7 8]", n, a, b, end)
+	}
+	if branch, v := d.Long(), d.String(); branch != 1 || v != "gift" {
+		t.Errorf("note = branch %d %q, want the string gift", branch, v)
+	}
+	if v := d.String(); v != "BRL" {
+		t.Errorf("currency = %q, want the default BRL", v)
+	}
+	if n, k, v, end := d.Long(), d.String(), d.Long(), d.Long(); n != 1 || k != "a" || v != 1 || end != 0 {
+		t.Errorf("tags = %d {%s: %d} %d, want the default {a: 1}", n, k, v, end)
+	}
+	if branch := d.Long(); branch != 0 {
+		t.Errorf("coupon = branch %d, want null", branch)
+	}
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.data) != 0 {
+		t.Errorf("%d bytes left after the reader's fields", len(d.data))
+	}
+}
+
+func TestResolveUnions(t *testing.T) {
+	// A plain writer value is wrapped in the matching reader branch.
+	var e Encoder
+	e.String("x")
+	data, err := Resolve(e.Data(), mustParse(t, `"string"`), mustParse(t, `["null", "int", "string"]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want Encoder
+	want.Long(2)
+	want.String("x")
+	if !bytes.Equal(data, want.Data()) {
+		t.Errorf("Resolve = %x, want %x", data, want.Data())
+	}
+
+	// A writer union is unwrapped for a plain reader.
+	var branch Encoder
+	branch.Long(0)
+	branch.String("x")
+	data, err = Resolve(branch.Data(), mustParse(t, `["string", "bytes"]`), mustParse(t, `"bytes"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := NewDecoder(data); string(d.Bytes()) != "x" || d.Err() != nil {
+		t.Errorf("Resolve = %x, want the bytes of x", data)
+	}
+
+	var bad Encoder
+	bad.Long(5)
+	if _, err := Resolve(bad.Data(), mustParse(t, `["int", "string"]`), mustParse(t, `["int", "string"]`)); err == nil {
+		t.Error("invalid union branch was accepted")
+	}
+}
+
+func TestResolveRejectsIncompatibleAndShortData(t *testing.T) {
+	if _, err := Resolve([]byte{0}, mustParse(t, `"string"`), mustParse(t, `"int"`)); err == nil {
+		t.Error("resolved a string as an int")
+	}
+
+	var e Encoder
+	e.String("truncated")
+	data := e.Data()
+	if _, err := Resolve(data[:len(data)-1], mustParse(t, `"string"`), mustParse(t, `"string"`)); err == nil {
+		t.Error("resolved truncated data")
+	}
+}
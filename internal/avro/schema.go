@@ -0,0 +1,162 @@
+package avro
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Schema is a parsed Avro schema.
+type Schema struct {
+	// Type is a primitive type name, or "record", "enum", "array", "map",
+	// "union" or "fixed".
+	Type string
+	// Name is the full name of named types, including the namespace.
+	Name        string
+	LogicalType string
+	Fields      []Field
+	Items       *Schema
+	Values      *Schema
+	Branches    []*Schema
+	Symbols     []string
+	Size        int
+}
+
+type Field struct {
+	Name       string
+	Type       *Schema
+	Default    json.RawMessage
+	HasDefault bool
+}
+
+var primitives = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true,
+	"float": true, "double": true, "bytes": true, "string": true,
+}
+
+// ParseSchema parses an Avro schema in its JSON form.
+func ParseSchema(text string) (*Schema, error) {
+	var raw any
+	if err := json.Unmarshal([]byte(text), &raw); err != nil {
+		return nil, fmt.Errorf("avro: invalid schema: %w", err)
+	}
+	return (&parser{named: make(map[string]*Schema)}).parse(raw, "")
+}
+
+func (s *Schema) shortName() string {
+	return s.Name[strings.LastIndex(s.Name, ".")+1:]
+}
+
+type parser struct {
+	named map[string]*Schema
+}
+
+func (p *parser) parse(raw any, namespace string) (*Schema, error) {
+	switch v := raw.(type) {
+	case string:
+		if primitives[v] {
+			return &Schema{Type: v}, nil
+		}
+		if s, ok := p.named[qualify(v, namespace)]; ok {
+			return s, nil
+		}
+		if s, ok := p.named[v]; ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("avro: unknown type %q", v)
+	case []any:
+		s := &Schema{Type: "union"}
+		for _, b := range v {
+			branch, err := p.parse(b, namespace)
+			if err != nil {
+				return nil, err
+			}
+			s.Branches = append(s.Branches, branch)
+		}
+		return s, nil
+	case map[string]any:
+		return p.parseComplex(v, namespace)
+	}
+	return nil, fmt.Errorf("avro: invalid schema %v", raw)
+}
+
+func (p *parser) parseComplex(v map[string]any, namespace string) (*Schema, error) {
+	typ, _ := v["type"].(string)
+	logical, _ := v["logicalType"].(string)
+
+	switch typ {
+	case "record", "error", "enum", "fixed":
+		name, _ := v["name"].(string)
+		if ns, ok := v["namespace"].(string); ok && !strings.Contains(name, ".") {
+			namespace = ns
+		}
+		s := &Schema{Type: typ, Name: qualify(name, namespace), LogicalType: logical}
+		if typ == "error" {
+			s.Type = "record"
+		}
+		p.named[s.Name] = s
+		if i := strings.LastIndex(s.Name, "."); i >= 0 {
+			namespace = s.Name[:i]
+		}
+
+		switch s.Type {
+		case "record":
+			fields, _ := v["fields"].([]any)
+			for _, f := range fields {
+				fm, ok := f.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("avro: invalid field in %s", s.Name)
+				}
+				ft, err := p.parse(fm["type"], namespace)
+				if err != nil {
+					return nil, err
+				}
+				field := Field{Type: ft}
+				field.Name, _ = fm["name"].(string)
+				if d, ok := fm["default"]; ok {
+					field.Default, _ = json.Marshal(d)
+					field.HasDefault = true
+				}
+				s.Fields = append(s.Fields, field)
+			}
+		case "enum":
+			symbols, _ := v["symbols"].([]any)
+			for _, sym := range symbols {
+				str, _ := sym.(string)
+				s.Symbols = append(s.Symbols, str)
+			}
+		case "fixed":
+			size, _ := v["size"].(float64)
+			s.Size = int(size)
+		}
+		return s, nil
+	case "array":
+		items, err := p.parse(v["items"], namespace)
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items}, nil
+	case "map":
+		values, err := p.parse(v["values"], namespace)
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "map", Values: values}, nil
+	}
+
+	if primitives[typ] {
+		return &Schema{Type: typ, LogicalType: logical}, nil
+	}
+	s, err := p.parse(typ, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func qualify(name, namespace string) string {
+	if namespace == "" || strings.Contains(name, ".") {
+		return name
+	}
+	return namespace + "." + name
+}
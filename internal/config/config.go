@@ -0,0 +1,171 @@
+// Package config reads the settings shared by the commands from the environment.
+package config
+
+import (
+	"kafka-go-study/internal/kafka"
+	"kafka-go-study/internal/schemaregistry"
+	"os"
+	"strconv"
+	"time"
+)
+
+const defaultSpillMaxBytes = 256 << 20
+
+// Broker reads KAFKA_BROKER (default localhost:9092).
+func Broker() string {
+	if b := os.Getenv("KAFKA_BROKER"); b != "" {
+		return b
+	}
+	return "localhost:9092"
+}
+
+// PaymentAPIAddr reads PAYMENT_API_ADDR (default http://localhost:8081).
+func PaymentAPIAddr() string {
+	if a := os.Getenv("PAYMENT_API_ADDR"); a != "" {
+		return a
+	}
+	return "http://localhost:8081"
+}
+
+// DedupPath reads DEDUP_DB_PATH (default dedup.db).
+func DedupPath() string {
+	if p := os.Getenv("DEDUP_DB_PATH"); p != "" {
+		return p
+	}
+	return "dedup.db"
+}
+
+// OutboxPath reads OUTBOX_DB_PATH (default outbox.db).
+func OutboxPath() string {
+	if p := os.Getenv("OUTBOX_DB_PATH"); p != "" {
+		return p
+	}
+	return "outbox.db"
+}
+
+// Concurrency reads CONSUMER_CONCURRENCY: the number of messages handled at
+// once (default 8).
+func Concurrency() kafka.ConsumerOption {
+	n := 8
+	if v := os.Getenv("CONSUMER_CONCURRENCY"); v != "" {
+		if c, err := strconv.Atoi(v); err == nil && c > 0 {
+			n = c
+		}
+	}
+	return kafka.WithConcurrency(n)
+}
+
+// DrainTimeout reads DRAIN_TIMEOUT (default 25s).
+func DrainTimeout() kafka.ConsumerOption {
+	return kafka.WithDrainTimeout(drainTimeout())
+}
+
+func drainTimeout() time.Duration {
+	if v := os.Getenv("DRAIN_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return 25 * time.Second
+}
+
+// SpanRelation reads SPAN_RELATION: "link" starts a new trace per consumed
+// message linked to the producer span, anything else continues its trace.
+func SpanRelation() kafka.ConsumerOption {
+	if os.Getenv("SPAN_RELATION") == "link" {
+		return kafka.WithSpanRelation(kafka.LinkProducer)
+	}
+	return kafka.WithSpanRelation(kafka.ParentProducer)
+}
+
+// RateLimit reads CONSUMER_RATE_LIMIT: the initial number of messages fetched
+// per second, 0 (default) for no limit.
+func RateLimit() kafka.ConsumerOption {
+	r := rateLimit()
+	return kafka.WithRateLimit(r, max(int(r), 1))
+}
+
+func rateLimit() float64 {
+	if v := os.Getenv("CONSUMER_RATE_LIMIT"); v != "" {
+		if n, err := strconv.ParseFloat(v, 64); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+// MessageCodec reads MESSAGE_CODEC: "json" (default), "protobuf" or "avro".
+// Protobuf and Avro values are framed for the schema registry at
+// SCHEMA_REGISTRY_URL, if set.
+func MessageCodec() kafka.Codec {
+	codec := kafka.JSON
+	if name := os.Getenv("MESSAGE_CODEC"); name != "" {
+		if c, err := kafka.CodecByName(name); err == nil {
+			codec = c
+		}
+	}
+	if url := os.Getenv("SCHEMA_REGISTRY_URL"); url != "" && codec != kafka.JSON {
+		return schemaregistry.NewSerializer(schemaregistry.NewClient(url), codec)
+	}
+	return codec
+}
+
+// RegistryCodecs lets a consumer decode values framed for the schema registry
+// at SCHEMA_REGISTRY_URL, if set.
+func RegistryCodecs() kafka.ConsumerOption {
+	url := os.Getenv("SCHEMA_REGISTRY_URL")
+	if url == "" {
+		return kafka.WithCodecs()
+	}
+	client := schemaregistry.NewClient(url)
+	return kafka.WithCodecs(
+		schemaregistry.NewSerializer(client, kafka.Avro),
+		schemaregistry.NewSerializer(client, kafka.Protobuf),
+	)
+}
+
+// Balancer reads PRODUCER_BALANCER: "murmur2" (default), "consistent",
+// "round-robin" or "least-bytes".
+func Balancer() kafka.ProducerOption {
+	b, err := kafka.BalancerByName(os.Getenv("PRODUCER_BALANCER"))
+	if err != nil {
+		b, _ = kafka.BalancerByName("murmur2")
+	}
+	return kafka.WithBalancer(b)
+}
+
+// CloudEvents reads CLOUDEVENTS_MODE: "binary" or "structured" publish
+// CloudEvents, anything else plain messages.
+func CloudEvents() kafka.ProducerOption {
+	switch os.Getenv("CLOUDEVENTS_MODE") {
+	case "binary":
+		return kafka.WithCloudEvents(kafka.CloudEventsBinary, "")
+	case "structured":
+		return kafka.WithCloudEvents(kafka.CloudEventsStructured, "")
+	}
+	return kafka.WithCloudEvents(0, "")
+}
+
+// Spill reads PRODUCER_SPILL_DIR: if set, messages the broker cannot take are
+// spilled there, up to PRODUCER_SPILL_MAX_BYTES (default 256 MiB), and
+// replayed once it is back.
+func Spill() kafka.ProducerOption {
+	return kafka.WithSpill(os.Getenv("PRODUCER_SPILL_DIR"), spillMaxBytes())
+}
+
+func spillMaxBytes() int64 {
+	if v := os.Getenv("PRODUCER_SPILL_MAX_BYTES"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultSpillMaxBytes
+}
+
+// PartitionKey reads ORDER_PARTITION_KEY (default order_id).
+func PartitionKey() string {
+	if k := os.Getenv("ORDER_PARTITION_KEY"); k != "" {
+		return k
+	}
+	return "order_id"
+}
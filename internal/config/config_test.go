@@ -0,0 +1,74 @@
+package config
+
+import (
+	"kafka-go-study/internal/kafka"
+	"testing"
+	"time"
+)
+
+func TestMessageCodec(t *testing.T) {
+	for name, want := range map[string]string{
+		"":         kafka.JSON.ContentType(),
+		"avro":     kafka.Avro.ContentType(),
+		"protobuf": kafka.Protobuf.ContentType(),
+		"xml":      kafka.JSON.ContentType(),
+	} {
+		t.Setenv("MESSAGE_CODEC", name)
+		if got := MessageCodec().ContentType(); got != want {
+			t.Errorf("MESSAGE_CODEC=%q: content type %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestSpillMaxBytes(t *testing.T) {
+	for value, want := range map[string]int64{
+		"":     defaultSpillMaxBytes,
+		"1024": 1024,
+		"0":    defaultSpillMaxBytes,
+		"lots": defaultSpillMaxBytes,
+	} {
+		t.Setenv("PRODUCER_SPILL_MAX_BYTES", value)
+		if got := spillMaxBytes(); got != want {
+			t.Errorf("PRODUCER_SPILL_MAX_BYTES=%q: %d, want %d", value, got, want)
+		}
+	}
+}
+
+func TestPartitionKey(t *testing.T) {
+	for value, want := range map[string]string{
+		"":            "order_id",
+		"customer_id": "customer_id",
+	} {
+		t.Setenv("ORDER_PARTITION_KEY", value)
+		if got := PartitionKey(); got != want {
+			t.Errorf("ORDER_PARTITION_KEY=%q: %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"":      25 * time.Second,
+		"5s":    5 * time.Second,
+		"never": 25 * time.Second,
+	} {
+		t.Setenv("DRAIN_TIMEOUT", value)
+		if got := drainTimeout(); got != want {
+			t.Errorf("DRAIN_TIMEOUT=%q: %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	for value, want := range map[string]float64{
+		"":     0,
+		"50":   50,
+		"-1":   0,
+		"fast": 0,
+	} {
+		t.Setenv("CONSUMER_RATE_LIMIT", value)
+		if got := rateLimit(); got != want {
+			t.Errorf("CONSUMER_RATE_LIMIT=%q: %v, want %v", value, got, want)
+		}
+	}
+}
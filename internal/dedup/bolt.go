@@ -0,0 +1,115 @@
+package dedup
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucket = []byte("dedup")
+
+// BoltStore keeps keys in an embedded bbolt database so deduplication
+// survives restarts. Expired keys are purged every purgeInterval.
+type BoltStore struct {
+	db   *bolt.DB
+	ttl  time.Duration
+	stop chan struct{}
+	done chan struct{}
+}
+
+const purgeInterval = 10 * time.Minute
+
+func OpenBoltStore(path string, ttl time.Duration) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dedup store: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to create dedup bucket: %w", err)
+	}
+
+	s := &BoltStore{
+		db:   db,
+		ttl:  ttl,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go s.purgeLoop()
+
+	return s, nil
+}
+
+func (s *BoltStore) Contains(_ context.Context, key string) (bool, error) {
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucket).Get([]byte(key))
+		found = v != nil && !expired(v, time.Now())
+		return nil
+	})
+	return found, err
+}
+
+func (s *BoltStore) Add(_ context.Context, key string) error {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, uint64(time.Now().Add(s.ttl).UnixNano()))
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), v)
+	})
+}
+
+func (s *BoltStore) Close() error {
+	close(s.stop)
+	<-s.done
+	return s.db.Close()
+}
+
+func (s *BoltStore) purgeLoop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			_ = s.purge()
+		}
+	}
+}
+
+func (s *BoltStore) purge() error {
+	now := time.Now()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		var keys [][]byte
+		_ = b.ForEach(func(k, v []byte) error {
+			if expired(v, now) {
+				keys = append(keys, bytes.Clone(k))
+			}
+			return nil
+		})
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func expired(v []byte, now time.Time) bool {
+	return len(v) != 8 || now.UnixNano() > int64(binary.BigEndian.Uint64(v))
+}
@@ -0,0 +1,62 @@
+package dedup
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTestBoltStore(t *testing.T, path string, ttl time.Duration) *BoltStore {
+	t.Helper()
+	s, err := OpenBoltStore(path, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestBoltStoreSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.db")
+	s := openTestBoltStore(t, path, time.Hour)
+	add(t, s, "a")
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestBoltStore(t, path, time.Hour)
+	defer s.Close()
+	if !contains(t, s, "a") {
+		t.Error("a was forgotten on restart")
+	}
+	if contains(t, s, "b") {
+		t.Error("b was never added")
+	}
+}
+
+func TestBoltStorePurgesExpiredKeys(t *testing.T) {
+	s := openTestBoltStore(t, filepath.Join(t.TempDir(), "dedup.db"), 20*time.Millisecond)
+	defer s.Close()
+	for _, key := range []string{"a", "b", "c"} {
+		add(t, s, key)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	add(t, s, "d")
+	if contains(t, s, "a") {
+		t.Error("expired key a was found")
+	}
+
+	if err := s.purge(); err != nil {
+		t.Fatal(err)
+	}
+	var keys int
+	_ = s.db.View(func(tx *bolt.Tx) error {
+		keys = tx.Bucket(bucket).Stats().KeyN
+		return nil
+	})
+	if keys != 1 {
+		t.Errorf("%d keys after purging, want 1", keys)
+	}
+}
@@ -0,0 +1,75 @@
+package dedup
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func contains(t *testing.T, s interface {
+	Contains(context.Context, string) (bool, error)
+}, key string) bool {
+	t.Helper()
+	ok, err := s.Contains(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ok
+}
+
+func add(t *testing.T, s interface {
+	Add(context.Context, string) error
+}, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		if err := s.Add(context.Background(), key); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMemoryStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	s := NewMemoryStore(2, time.Hour)
+	add(t, s, "a", "b")
+
+	// Finding a keeps it over b, which was added later.
+	if !contains(t, s, "a") {
+		t.Fatal("a not found")
+	}
+	add(t, s, "c")
+
+	if !contains(t, s, "a") || !contains(t, s, "c") {
+		t.Error("recently used keys were evicted")
+	}
+	if contains(t, s, "b") {
+		t.Error("least recently used key b was kept")
+	}
+}
+
+func TestMemoryStoreAddRefreshesKey(t *testing.T) {
+	s := NewMemoryStore(2, time.Hour)
+	add(t, s, "a", "b", "a", "c")
+
+	if !contains(t, s, "a") {
+		t.Error("re-added key a was evicted")
+	}
+	if contains(t, s, "b") {
+		t.Error("b was kept over a re-added key")
+	}
+}
+
+func TestMemoryStoreExpiresKeys(t *testing.T) {
+	s := NewMemoryStore(10, 20*time.Millisecond)
+	add(t, s, "a")
+	if !contains(t, s, "a") {
+		t.Fatal("a not found")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if contains(t, s, "a") {
+		t.Error("expired key a was found")
+	}
+	if n := s.order.Len(); n != 0 {
+		t.Errorf("%d keys kept after expiring, want 0", n)
+	}
+}
@@ -4,7 +4,11 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/segmentio/kafka-go"
 )
@@ -38,3 +42,173 @@ func CreateTopic(ctx context.Context, broker, topic string, partitions, replicat
 
 	return nil
 }
+
+// MatchTopics returns the sorted topics matching pattern, except internal,
+// dead-letter and retry topics.
+func MatchTopics(ctx context.Context, brokers []string, pattern *regexp.Regexp) ([]string, error) {
+	client := &kafka.Client{Addr: kafka.TCP(brokers...)}
+
+	meta, err := client.Metadata(ctx, &kafka.MetadataRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster metadata: %w", err)
+	}
+
+	var topics []string
+	for _, t := range meta.Topics {
+		if t.Internal || t.Error != nil || isFailureTopic(t.Name) || !pattern.MatchString(t.Name) {
+			continue
+		}
+		topics = append(topics, t.Name)
+	}
+	slices.Sort(topics)
+	return topics, nil
+}
+
+func isFailureTopic(topic string) bool {
+	return strings.HasSuffix(topic, ".dlq") || strings.Contains(topic, ".retry.")
+}
+
+// OffsetsAt returns the first offset produced at or after at per partition.
+func OffsetsAt(ctx context.Context, brokers []string, topic string, at time.Time) (map[int]int64, error) {
+	return listOffsets(ctx, brokers, topic, func(p int) kafka.OffsetRequest {
+		return kafka.TimeOffsetOf(p, at)
+	})
+}
+
+// LatestOffsets returns the high watermark of every partition of topic.
+func LatestOffsets(ctx context.Context, brokers []string, topic string) (map[int]int64, error) {
+	return listOffsets(ctx, brokers, topic, kafka.LastOffsetOf)
+}
+
+func listOffsets(ctx context.Context, brokers []string, topic string, request func(partition int) kafka.OffsetRequest) (map[int]int64, error) {
+	client := &kafka.Client{Addr: kafka.TCP(brokers...)}
+
+	partitions, err := topicPartitions(ctx, client, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	requests := make([]kafka.OffsetRequest, 0, len(partitions))
+	latest := make([]kafka.OffsetRequest, 0, len(partitions))
+	for _, p := range partitions {
+		requests = append(requests, request(p))
+		latest = append(latest, kafka.LastOffsetOf(p))
+	}
+
+	resp, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{topic: requests},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list offsets: %w", err)
+	}
+	ends, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{topic: latest},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list offsets: %w", err)
+	}
+
+	offsets := make(map[int]int64, len(requests))
+	for _, p := range ends.Topics[topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("failed to list offsets of partition %d: %w", p.Partition, p.Error)
+		}
+		offsets[p.Partition] = p.LastOffset
+	}
+	for _, p := range resp.Topics[topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("failed to list offsets of partition %d: %w", p.Partition, p.Error)
+		}
+		for offset := range p.Offsets {
+			if offset >= 0 {
+				offsets[p.Partition] = offset
+			}
+		}
+	}
+
+	return offsets, nil
+}
+
+func committedOffsets(ctx context.Context, brokers []string, groupID, topic string) (map[int]int64, error) {
+	client := &kafka.Client{Addr: kafka.TCP(brokers...)}
+
+	partitions, err := topicPartitions(ctx, client, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: groupID,
+		Topics:  map[string][]int{topic: partitions},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch committed offsets: %w", err)
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("failed to fetch committed offsets: %w", resp.Error)
+	}
+
+	offsets := make(map[int]int64, len(partitions))
+	for _, p := range resp.Topics[topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("failed to fetch committed offset of partition %d: %w", p.Partition, p.Error)
+		}
+		if p.CommittedOffset >= 0 {
+			offsets[p.Partition] = p.CommittedOffset
+		}
+	}
+	return offsets, nil
+}
+
+func topicPartitions(ctx context.Context, client *kafka.Client, topic string) ([]int, error) {
+	meta, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get topic metadata: %w", err)
+	}
+	if len(meta.Topics) == 0 || meta.Topics[0].Error != nil {
+		return nil, fmt.Errorf("failed to get topic metadata: topic %s not found", topic)
+	}
+
+	partitions := make([]int, len(meta.Topics[0].Partitions))
+	for i, p := range meta.Topics[0].Partitions {
+		partitions[i] = p.ID
+	}
+	return partitions, nil
+}
+
+// commitOffsets sets the committed offsets of groupID, which must be empty.
+func commitOffsets(ctx context.Context, brokers []string, groupID, topic string, offsets map[int]int64) error {
+	commits := make([]kafka.OffsetCommit, 0, len(offsets))
+	for partition, offset := range offsets {
+		commits = append(commits, kafka.OffsetCommit{Partition: partition, Offset: offset})
+	}
+
+	client := &kafka.Client{Addr: kafka.TCP(brokers...)}
+	resp, err := client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      groupID,
+		GenerationID: -1,
+		Topics:       map[string][]kafka.OffsetCommit{topic: commits},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to commit offsets: %w", err)
+	}
+	for _, p := range resp.Topics[topic] {
+		if p.Error != nil {
+			return fmt.Errorf("failed to commit offset of partition %d: %w", p.Partition, p.Error)
+		}
+	}
+	return nil
+}
+
+// DeleteGroup deletes the committed offsets of groupID, which must be empty.
+func DeleteGroup(ctx context.Context, brokers []string, groupID string) error {
+	client := &kafka.Client{Addr: kafka.TCP(brokers...)}
+	resp, err := client.DeleteGroups(ctx, &kafka.DeleteGroupsRequest{GroupIDs: []string{groupID}})
+	if err != nil {
+		return fmt.Errorf("failed to delete group: %w", err)
+	}
+	if err := resp.Errors[groupID]; err != nil {
+		return fmt.Errorf("failed to delete group %s: %w", groupID, err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package kafka
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// BalancerByName returns the partitioner named "murmur2" (default, as the
+// Java client), "consistent", "round-robin" or "least-bytes".
+func BalancerByName(name string) (kafka.Balancer, error) {
+	switch name {
+	case "murmur2":
+		return kafka.Murmur2Balancer{}, nil
+	case "consistent":
+		return ConsistentHash{}, nil
+	case "round-robin":
+		return &kafka.RoundRobin{}, nil
+	case "least-bytes":
+		return &kafka.LeastBytes{}, nil
+	}
+	return nil, fmt.Errorf("unknown balancer %q", name)
+}
+
+// WithBalancer defaults to murmur2 key hashing.
+func WithBalancer(balancer kafka.Balancer) ProducerOption {
+	return func(p *Producer) { p.writer.Balancer = balancer }
+}
+
+// ConsistentHash assigns keys to partitions with jump consistent hashing.
+type ConsistentHash struct{}
+
+func (ConsistentHash) Balance(msg kafka.Message, partitions ...int) int {
+	if len(msg.Key) == 0 {
+		return partitions[rand.IntN(len(partitions))]
+	}
+	h := fnv.New64a()
+	h.Write(msg.Key)
+	return partitions[jumpHash(h.Sum64(), len(partitions))]
+}
+
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
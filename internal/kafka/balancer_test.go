@@ -0,0 +1,136 @@
+package kafka
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// javaMurmur2 are the murmur2 hashes of Kafka's Java client, from the
+// murmur2 test of org.apache.kafka.common.utils.UtilsTest.
+var javaMurmur2 = []struct {
+	key  string
+	hash int32
+}{
+	{"21", -973932308},
+	{"foobar", -790332482},
+	{"a-little-bit-long-string", -985981536},
+	{"a-little-bit-longer-string", -1486304829},
+	{"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8", -58897971},
+	{"abc", 479470107},
+}
+
+func partitions(n int) []int {
+	p := make([]int, n)
+	for i := range p {
+		p[i] = i
+	}
+	return p
+}
+
+func TestMurmur2MatchesJavaDefaultPartitioner(t *testing.T) {
+	for _, v := range javaMurmur2 {
+		for _, n := range []int{1, 3, 6, 12, 100} {
+			// DefaultPartitioner: Utils.toPositive(Utils.murmur2(key)) % numPartitions.
+			want := int(v.hash&0x7fffffff) % n
+			got := kafka.Murmur2Balancer{}.Balance(kafka.Message{Key: []byte(v.key)}, partitions(n)...)
+			if got != want {
+				t.Errorf("key %q over %d partitions: got %d, Java picks %d", v.key, n, got, want)
+			}
+		}
+	}
+}
+
+func TestMurmur2JavaPartitions(t *testing.T) {
+	// Partitions the Java client picks over 12 partitions.
+	for key, want := range map[string]int{
+		"21":                       0,
+		"foobar":                   6,
+		"a-little-bit-long-string": 8,
+		"abc":                      3,
+	} {
+		if got := (kafka.Murmur2Balancer{}).Balance(kafka.Message{Key: []byte(key)}, partitions(12)...); got != want {
+			t.Errorf("key %q: got partition %d, want %d", key, got, want)
+		}
+	}
+}
+
+func TestJumpHashDeterministic(t *testing.T) {
+	for key := uint64(0); key < 1000; key++ {
+		b := jumpHash(key, 16)
+		if b < 0 || b >= 16 {
+			t.Fatalf("jumpHash(%d, 16) = %d, out of range", key, b)
+		}
+		if again := jumpHash(key, 16); again != b {
+			t.Fatalf("jumpHash(%d, 16) = %d, then %d", key, b, again)
+		}
+	}
+	if b := jumpHash(12345, 1); b != 0 {
+		t.Fatalf("jumpHash over one bucket = %d", b)
+	}
+}
+
+func TestJumpHashOnlyMovesKeysToNewPartition(t *testing.T) {
+	const keys = 10000
+	for n := 1; n < 32; n++ {
+		moved := 0
+		for i := 0; i < keys; i++ {
+			key := []byte(fmt.Sprintf("order-%d", i))
+			before := ConsistentHash{}.Balance(kafka.Message{Key: key}, partitions(n)...)
+			after := ConsistentHash{}.Balance(kafka.Message{Key: key}, partitions(n+1)...)
+			if after == before {
+				continue
+			}
+			if after != n {
+				t.Fatalf("growing to %d partitions moved %q from %d to %d instead of the new partition", n+1, key, before, after)
+			}
+			moved++
+		}
+		// About 1/(n+1) of the keys move.
+		want := keys / (n + 1)
+		if moved < want/2 || moved > want*3/2 {
+			t.Errorf("growing to %d partitions moved %d keys, want about %d", n+1, moved, want)
+		}
+	}
+}
+
+func TestConsistentHashUsesGivenPartitions(t *testing.T) {
+	ids := []int{3, 5, 7}
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("customer-%d", i))
+		p := ConsistentHash{}.Balance(kafka.Message{Key: key}, ids...)
+		if p != 3 && p != 5 && p != 7 {
+			t.Fatalf("key %q went to partition %d, not one of %v", key, p, ids)
+		}
+		if again := (ConsistentHash{}).Balance(kafka.Message{Key: key}, ids...); again != p {
+			t.Fatalf("key %q went to partitions %d and %d", key, p, again)
+		}
+	}
+	if p := (ConsistentHash{}).Balance(kafka.Message{}, ids...); p != 3 && p != 5 && p != 7 {
+		t.Fatalf("keyless message went to partition %d", p)
+	}
+}
+
+func TestBalancerByName(t *testing.T) {
+	for name, want := range map[string]kafka.Balancer{
+		"murmur2":     kafka.Murmur2Balancer{},
+		"consistent":  ConsistentHash{},
+		"round-robin": &kafka.RoundRobin{},
+		"least-bytes": &kafka.LeastBytes{},
+	} {
+		b, err := BalancerByName(name)
+		if err != nil {
+			t.Fatalf("BalancerByName(%q): %v", name, err)
+		}
+		if fmt.Sprintf("%T", b) != fmt.Sprintf("%T", want) {
+			t.Errorf("BalancerByName(%q) = %T, want %T", name, b, want)
+		}
+	}
+
+	for _, name := range []string{"", "Murmur2", "hash", "roundrobin"} {
+		if b, err := BalancerByName(name); err == nil {
+			t.Errorf("BalancerByName(%q) = %T, want error", name, b)
+		}
+	}
+}
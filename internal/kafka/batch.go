@@ -0,0 +1,161 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type BatchHandlerFunc func(ctx context.Context, msgs []Message) error
+
+// ListenBatch hands handler up to maxSize messages, or those that arrived
+// within maxWait, and commits them once it succeeds.
+func (c *Consumer) ListenBatch(ctx context.Context, maxSize int, maxWait time.Duration, handler BatchHandlerFunc) error {
+	if c.quarantine != nil {
+		c.log.Warn("quarantine disabled: it does not apply to batch handlers")
+	}
+	return c.run(ctx, func(ctx, workCtx context.Context, c *Consumer) error {
+		return c.listenBatch(ctx, workCtx, maxSize, maxWait, handler)
+	})
+}
+
+func (c *Consumer) listenBatch(ctx, workCtx context.Context, maxSize int, maxWait time.Duration, handler BatchHandlerFunc) error {
+	for {
+		batch, err := c.fetchBatch(ctx, maxSize, maxWait)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		commit, err := c.handleBatch(workCtx, batch, handler)
+		if err != nil {
+			return err
+		}
+		if !commit {
+			continue
+		}
+
+		if err := c.commit(workCtx, batch...); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Consumer) fetchBatch(ctx context.Context, maxSize int, maxWait time.Duration) ([]kafka.Message, error) {
+	first, err := c.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	batch := []kafka.Message{first}
+
+	waitCtx, cancel := context.WithTimeout(ctx, maxWait)
+	defer cancel()
+
+	for len(batch) < maxSize {
+		err := c.flow.wait(waitCtx)
+		start := time.Now()
+		var msg kafka.Message
+		if err == nil {
+			msg, err = c.reader.FetchMessage(waitCtx)
+		}
+		if err != nil {
+			if errors.Is(waitCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+				break
+			}
+			c.forgetReceive(batch...)
+			return nil, fmt.Errorf("failed to fetch message: %w", err)
+		}
+		c.stats.fetched(msg)
+		msg = fromCloudEvent(msg)
+		c.recordReceive(c.traceReceive(msg, start), start, msg)
+		if err := c.awaitDue(ctx, msg); err != nil {
+			c.forgetReceive(batch...)
+			return nil, err
+		}
+		batch = append(batch, msg)
+	}
+
+	return batch, nil
+}
+
+// handleBatch runs handler inside a single process span.
+func (c *Consumer) handleBatch(ctx context.Context, batch []kafka.Message, handler BatchHandlerFunc) (bool, error) {
+	links := make([]trace.Link, 0, 2*len(batch))
+	msgs := make([]Message, len(batch))
+	for i, msg := range batch {
+		msgs[i] = c.message(msg)
+
+		attrs := []attribute.KeyValue{
+			semconv.MessagingDestinationPartitionID(strconv.Itoa(msg.Partition)),
+			semconv.MessagingKafkaMessageOffset(int(msg.Offset)),
+		}
+		for _, sc := range []trace.SpanContext{c.producerContext(msg), c.takeReceive(msg)} {
+			if sc.IsValid() {
+				links = append(links, trace.Link{SpanContext: sc, Attributes: attrs})
+			}
+		}
+	}
+
+	name, destination := c.destination(messageTopics(batch)...)
+	batchCtx, span := c.tracer.Start(ctx, fmt.Sprintf("process %s", name),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(links...),
+		trace.WithAttributes(destination...),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationTypeDeliver,
+			semconv.MessagingOperationName("process"),
+			semconv.MessagingBatchMessageCount(len(batch)),
+			semconv.MessagingClientID(c.clientID),
+			semconv.MessagingKafkaConsumerGroup(c.groupID),
+			attribute.String("messaging.consumer.group.name", c.groupID),
+		),
+		trace.WithAttributes(c.spanAttrs...),
+	)
+	defer span.End()
+
+	start := time.Now()
+	err := callBatchHandler(batchCtx, handler, msgs)
+	c.recordBatchProcess(batchCtx, start, batch, err)
+	if err == nil {
+		span.SetStatus(codes.Ok, "")
+		return true, nil
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	if ctx.Err() != nil {
+		return false, nil
+	}
+	failed := make(map[string]int)
+	for _, msg := range batch {
+		failed[msg.Topic]++
+	}
+	for topic, n := range failed {
+		c.recordFailure(batchCtx, topic, n, err)
+	}
+
+	for _, msg := range batch {
+		routed, routeErr := c.routeFailure(batchCtx, msg, err)
+		if routeErr != nil || !routed {
+			return false, routeErr
+		}
+	}
+	return true, nil
+}
+
+func callBatchHandler(ctx context.Context, handler BatchHandlerFunc, msgs []Message) (err error) {
+	defer recoverPanic(ctx, &err)
+	return handler(ctx, msgs)
+}
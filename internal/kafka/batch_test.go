@@ -0,0 +1,123 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func testBatch(n int) []kafka.Message {
+	batch := make([]kafka.Message, n)
+	for i := range batch {
+		batch[i] = kafka.Message{
+			Topic: "orders", Partition: i % 2, Offset: int64(i),
+			Value:   []byte{byte('a' + i)},
+			Headers: []kafka.Header{{Key: "traceparent", Value: []byte(producerTraceparent)}},
+		}
+	}
+	return batch
+}
+
+func TestHandleBatchTracesOneProcessSpan(t *testing.T) {
+	c, spans := newTestConsumer(t)
+	batch := testBatch(3)
+
+	var got []string
+	commit, err := c.handleBatch(t.Context(), batch, func(_ context.Context, msgs []Message) error {
+		for _, m := range msgs {
+			got = append(got, string(m.Value))
+		}
+		return nil
+	})
+	if err != nil || !commit {
+		t.Fatalf("handleBatch = %v, %v, want the batch committed", commit, err)
+	}
+	if len(got) != 3 || got[0] != "a" || got[2] != "c" {
+		t.Errorf("handler got %q, want the batch in order", got)
+	}
+
+	ended := spans.Ended()
+	if len(ended) != 1 || ended[0].Name() != "process orders" {
+		t.Fatalf("ended spans = %v, want one process span", spanNames(ended))
+	}
+	span := ended[0]
+	if !hasAttr(span, semconv.MessagingBatchMessageCount(3)) || span.Status().Code != codes.Ok {
+		t.Errorf("process span = %v, %v, want a successful batch of 3", span.Attributes(), span.Status())
+	}
+	if links := span.Links(); len(links) != 3 {
+		t.Errorf("%d links, want one per producer span", len(links))
+	} else if links[1].SpanContext.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("link = %v, want the producer span", links[1].SpanContext)
+	}
+}
+
+func TestHandleBatchRoutesEveryMessageOnFailure(t *testing.T) {
+	metrics, reader := withTestMetrics(t)
+	c := newRoutingConsumer(t, WithDeadLetter(), metrics)
+	dlq := routedTo(t, c, "orders.dlq")
+
+	commit, err := c.handleBatch(t.Context(), testBatch(3), func(context.Context, []Message) error {
+		panic("bad batch")
+	})
+	if err != nil || !commit {
+		t.Fatalf("handleBatch = %v, %v, want the batch dead-lettered and committed", commit, err)
+	}
+
+	dead := published(t, dlq)
+	if len(dead) != 3 {
+		t.Fatalf("%d messages dead-lettered, want 3", len(dead))
+	}
+	for i, msg := range dead {
+		if headerValue(msg.Headers, HeaderDeadLetterError) != "panic while handling message: bad batch" ||
+			headerValue(msg.Headers, HeaderDeadLetterOffset) != strconv.Itoa(i) {
+			t.Errorf("dead-lettered headers = %q", msg.Headers)
+		}
+	}
+	if n := counted(t, reader, "messages_failed_total", "orders"); n != 3 {
+		t.Errorf("messages_failed_total = %d, want 3", n)
+	}
+	if n := counted(t, reader, "handler_panics_total", "orders"); n != 1 {
+		t.Errorf("handler_panics_total = %d, want 1", n)
+	}
+}
+
+func TestHandleBatchFailureWithoutDeadLetter(t *testing.T) {
+	c, spans := newTestConsumer(t)
+
+	commit, err := c.handleBatch(t.Context(), testBatch(2), func(context.Context, []Message) error {
+		return errors.New("boom")
+	})
+	if err != nil || commit {
+		t.Errorf("handleBatch = %v, %v, want the batch left uncommitted", commit, err)
+	}
+	ended := spans.Ended()
+	if len(ended) != 1 {
+		t.Fatalf("ended spans = %v, want one process span", spanNames(ended))
+	}
+	if status := ended[0].Status(); status.Code != codes.Error || status.Description != "boom" {
+		t.Errorf("process span status = %v, want the handler error", status)
+	}
+}
+
+func TestHandleBatchDrainCancelled(t *testing.T) {
+	c := newRoutingConsumer(t, WithDeadLetter())
+	dlq := routedTo(t, c, "orders.dlq")
+
+	ctx, cancel := context.WithCancel(t.Context())
+	commit, err := c.handleBatch(ctx, testBatch(2), func(ctx context.Context, _ []Message) error {
+		cancel()
+		return ctx.Err()
+	})
+	if err != nil || commit {
+		t.Errorf("handleBatch = %v, %v, want the batch left uncommitted", commit, err)
+	}
+	if msgs := published(t, dlq); len(msgs) != 0 {
+		t.Errorf("%d messages dead-lettered while draining", len(msgs))
+	}
+}
@@ -0,0 +1,180 @@
+package kafka
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// CloudEventsMode is a CloudEvents Kafka protocol binding mode.
+type CloudEventsMode int
+
+const (
+	CloudEventsBinary CloudEventsMode = iota + 1
+	CloudEventsStructured
+)
+
+const (
+	ContentTypeCloudEvents = "application/cloudevents+json; charset=UTF-8"
+
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsPrefix      = "ce_"
+)
+
+// WithCloudEvents publishes messages as CloudEvents in mode, or as plain
+// messages if mode is zero. source defaults to "/<producer service>".
+func WithCloudEvents(mode CloudEventsMode, source string) ProducerOption {
+	return func(p *Producer) {
+		p.cloudEvents = mode
+		p.cloudEventsSource = source
+	}
+}
+
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      []byte          `json:"data_base64,omitempty"`
+
+	CorrelationID string `json:"correlationid,omitempty"`
+	SchemaVersion string `json:"schemaversion,omitempty"`
+	TraceParent   string `json:"traceparent,omitempty"`
+	TraceState    string `json:"tracestate,omitempty"`
+}
+
+func (p *Producer) newCloudEvent(e Envelope, headers []kafka.Header) cloudEvent {
+	source := p.cloudEventsSource
+	if source == "" {
+		source = "/" + e.ProducerService
+	}
+	ce := cloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              e.MessageID,
+		Source:          source,
+		Type:            e.EventType,
+		DataContentType: e.ContentType,
+		CorrelationID:   e.CorrelationID,
+		SchemaVersion:   e.SchemaVersion,
+		TraceParent:     headerValue(headers, "traceparent"),
+		TraceState:      headerValue(headers, "tracestate"),
+	}
+	if !e.CreatedAt.IsZero() {
+		ce.Time = e.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return ce
+}
+
+// toCloudEvent rewrites msg as a CloudEvent in the producer mode.
+func (p *Producer) toCloudEvent(msg kafka.Message, e Envelope) (kafka.Message, error) {
+	ce := p.newCloudEvent(e, msg.Headers)
+
+	switch p.cloudEvents {
+	case CloudEventsBinary:
+		headers := withoutHeaders(msg.Headers, HeaderMessageID, HeaderEventType, HeaderCreatedAt, HeaderCorrelationID, HeaderSchemaVersion)
+		add := func(attr, value string) {
+			if value != "" {
+				headers = append(headers, kafka.Header{Key: cloudEventsPrefix + attr, Value: []byte(value)})
+			}
+		}
+		add("specversion", ce.SpecVersion)
+		add("id", ce.ID)
+		add("source", ce.Source)
+		add("type", ce.Type)
+		add("time", ce.Time)
+		add("correlationid", ce.CorrelationID)
+		add("schemaversion", ce.SchemaVersion)
+		add("traceparent", ce.TraceParent)
+		add("tracestate", ce.TraceState)
+		msg.Headers = headers
+
+	case CloudEventsStructured:
+		if strings.HasPrefix(ce.DataContentType, ContentTypeJSON) {
+			ce.Data = msg.Value
+		} else {
+			ce.DataBase64 = msg.Value
+		}
+		value, err := json.Marshal(ce)
+		if err != nil {
+			return msg, err
+		}
+		msg.Value = value
+		msg.Headers = append(withoutHeaders(msg.Headers, envelopeHeaders...),
+			kafka.Header{Key: HeaderContentType, Value: []byte(ContentTypeCloudEvents)},
+			kafka.Header{Key: HeaderProducerService, Value: []byte(e.ProducerService)},
+			kafka.Header{Key: HeaderProducerVersion, Value: []byte(e.ProducerVersion)},
+		)
+	}
+	return msg, nil
+}
+
+func withoutCloudEventHeaders(headers []kafka.Header) []kafka.Header {
+	out := make([]kafka.Header, 0, len(headers))
+	for _, h := range headers {
+		if !strings.HasPrefix(h.Key, cloudEventsPrefix) {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+// fromCloudEvent rewrites a CloudEvent in either mode as a plain message.
+func fromCloudEvent(msg kafka.Message) kafka.Message {
+	var ce cloudEvent
+
+	switch {
+	case strings.HasPrefix(headerValue(msg.Headers, HeaderContentType), "application/cloudevents+json"):
+		if err := json.Unmarshal(msg.Value, &ce); err != nil {
+			return msg
+		}
+		msg.Value = ce.Data
+		if ce.DataBase64 != nil {
+			msg.Value = ce.DataBase64
+		} else if ce.DataContentType == "" && ce.Data != nil {
+			ce.DataContentType = ContentTypeJSON
+		}
+		msg.Headers = withoutHeaders(msg.Headers, HeaderContentType)
+
+	case headerValue(msg.Headers, cloudEventsPrefix+"specversion") != "":
+		attr := func(name string) string { return headerValue(msg.Headers, cloudEventsPrefix+name) }
+		ce = cloudEvent{
+			ID:              attr("id"),
+			Type:            attr("type"),
+			Time:            attr("time"),
+			DataContentType: headerValue(msg.Headers, HeaderContentType),
+			CorrelationID:   attr("correlationid"),
+			SchemaVersion:   attr("schemaversion"),
+			TraceParent:     attr("traceparent"),
+			TraceState:      attr("tracestate"),
+		}
+
+	default:
+		return msg
+	}
+
+	headers := msg.Headers
+	set := func(key, value string) {
+		if value != "" && headerValue(headers, key) == "" {
+			headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+		}
+	}
+	set(HeaderMessageID, ce.ID)
+	set(HeaderEventType, ce.Type)
+	set(HeaderContentType, ce.DataContentType)
+	set(HeaderCorrelationID, ce.CorrelationID)
+	set(HeaderSchemaVersion, ce.SchemaVersion)
+	if t, err := time.Parse(time.RFC3339Nano, ce.Time); err == nil {
+		set(HeaderCreatedAt, t.UTC().Format(time.RFC3339Nano))
+	}
+	if headerValue(headers, "traceparent") == "" {
+		set("traceparent", ce.TraceParent)
+		set("tracestate", ce.TraceState)
+	}
+	msg.Headers = headers
+	return msg
+}
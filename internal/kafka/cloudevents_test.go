@@ -0,0 +1,187 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type placed struct {
+	ID string `json:"id"`
+}
+
+func (placed) EventType() string     { return "order.placed" }
+func (placed) SchemaVersion() string { return "1" }
+
+func TestCloudEventsBinary(t *testing.T) {
+	p := newCapturingProducer(t, WithCloudEvents(CloudEventsBinary, "/order-api"))
+	ctx, span := p.tracer.Start(context.Background(), "request")
+	defer span.End()
+	if err := p.Publish(ContextWithCorrelationID(ctx, "corr-1"), "order-1", placed{ID: "order-1"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	msg := published(t, p)[0]
+
+	for key, want := range map[string]string{
+		"ce_specversion":   "1.0",
+		"ce_source":        "/order-api",
+		"ce_type":          "order.placed",
+		"ce_correlationid": "corr-1",
+		"ce_schemaversion": "1",
+		"ce_traceparent":   headerValue(msg.Headers, "traceparent"),
+		HeaderContentType:  ContentTypeJSON,
+	} {
+		if got := headerValue(msg.Headers, key); got != want || got == "" {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	for _, key := range []string{HeaderMessageID, HeaderEventType, HeaderCorrelationID, HeaderCreatedAt} {
+		if headerValue(msg.Headers, key) != "" {
+			t.Errorf("binary CloudEvent carries envelope header %s", key)
+		}
+	}
+	if string(msg.Value) != `{"id":"order-1"}` {
+		t.Errorf("value = %s, want the event data", msg.Value)
+	}
+
+	env := ParseEnvelope(fromCloudEvent(msg).Headers)
+	if env.MessageID != headerValue(msg.Headers, "ce_id") || env.EventType != "order.placed" ||
+		env.CorrelationID != "corr-1" || env.SchemaVersion != "1" || env.CreatedAt.IsZero() {
+		t.Errorf("envelope read back = %+v", env)
+	}
+}
+
+func TestCloudEventsStructured(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		codec Codec
+	}{
+		{"json data", JSON},
+		{"binary data", Protobuf},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newCapturingProducer(t, WithCloudEvents(CloudEventsStructured, ""), WithCodec(tc.codec))
+			value := []byte{0x0a, 0x01, 'x'}
+			if tc.codec == JSON {
+				value = []byte(`{"id":"order-1"}`)
+			}
+			headers := []kafka.Header{{Key: HeaderContentType, Value: []byte(tc.codec.ContentType())}}
+			if err := p.PublishRaw(context.Background(), []byte("k"), value, headers); err != nil {
+				t.Fatalf("PublishRaw: %v", err)
+			}
+			msg := published(t, p)[0]
+
+			if got := headerValue(msg.Headers, HeaderContentType); got != ContentTypeCloudEvents {
+				t.Fatalf("content-type = %q", got)
+			}
+			var ce cloudEvent
+			if err := json.Unmarshal(msg.Value, &ce); err != nil {
+				t.Fatalf("value is not a CloudEvent: %v", err)
+			}
+			if ce.SpecVersion != "1.0" || ce.ID == "" || !strings.HasPrefix(ce.Source, "/") || ce.TraceParent == "" {
+				t.Errorf("CloudEvent attributes = %+v", ce)
+			}
+			if (tc.codec == JSON) != (ce.Data != nil) || (tc.codec == JSON) == (ce.DataBase64 != nil) {
+				t.Errorf("data = %s, data_base64 = %v", ce.Data, ce.DataBase64)
+			}
+
+			back := fromCloudEvent(msg)
+			if string(back.Value) != string(value) {
+				t.Errorf("value read back = %q, want %q", back.Value, value)
+			}
+			env := ParseEnvelope(back.Headers)
+			if env.MessageID != ce.ID || env.ContentType != tc.codec.ContentType() {
+				t.Errorf("envelope read back = %+v", env)
+			}
+			if headerValue(back.Headers, "traceparent") != ce.TraceParent {
+				t.Error("traceparent not restored from the CloudEvent")
+			}
+		})
+	}
+}
+
+func TestFromCloudEventRestoresTraceContext(t *testing.T) {
+	msg := kafka.Message{Headers: []kafka.Header{
+		{Key: "ce_specversion", Value: []byte("1.0")},
+		{Key: "ce_id", Value: []byte("id-1")},
+		{Key: "ce_type", Value: []byte("order.placed")},
+		{Key: "ce_time", Value: []byte("2026-01-02T03:04:05Z")},
+		{Key: "ce_traceparent", Value: []byte("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")},
+	}}
+	back := fromCloudEvent(msg)
+
+	if got := headerValue(back.Headers, "traceparent"); got != "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01" {
+		t.Errorf("traceparent = %q", got)
+	}
+	env := ParseEnvelope(back.Headers)
+	if env.MessageID != "id-1" || !env.CreatedAt.Equal(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("envelope = %+v", env)
+	}
+	if plain := (kafka.Message{Value: []byte("x")}); string(fromCloudEvent(plain).Value) != "x" {
+		t.Error("plain message changed")
+	}
+}
+
+// A CloudEvent consumed in binary mode and republished, as to a retry or
+// dead-letter topic, carries the ce_* headers of the new publish only.
+func TestCloudEventsRepublish(t *testing.T) {
+	original := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1}, TraceFlags: trace.FlagsSampled,
+	})
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(trace.ContextWithSpanContext(context.Background(), original), carrier)
+
+	consumed := fromCloudEvent(kafka.Message{
+		Value: []byte(`{"id":"order-1"}`),
+		Headers: []kafka.Header{
+			{Key: "ce_specversion", Value: []byte("1.0")},
+			{Key: "ce_id", Value: []byte("id-1")},
+			{Key: "ce_source", Value: []byte("/order-api")},
+			{Key: "ce_type", Value: []byte("order.placed")},
+			{Key: "ce_time", Value: []byte("2026-01-02T03:04:05Z")},
+			{Key: "ce_traceparent", Value: []byte(carrier.Get("traceparent"))},
+			{Key: HeaderContentType, Value: []byte(ContentTypeJSON)},
+		},
+	})
+
+	for _, mode := range []CloudEventsMode{0, CloudEventsBinary} {
+		p := newCapturingProducer(t, WithCloudEvents(mode, ""))
+		ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "process")
+		if err := p.PublishRaw(ctx, consumed.Key, consumed.Value, consumed.Headers); err != nil {
+			t.Fatalf("PublishRaw: %v", err)
+		}
+		span.End()
+		msg := published(t, p)[0]
+
+		for _, h := range msg.Headers {
+			if strings.HasPrefix(h.Key, cloudEventsPrefix) && headerCount(msg.Headers, h.Key) != 1 {
+				t.Errorf("mode %d: %d %s headers", mode, headerCount(msg.Headers, h.Key), h.Key)
+			}
+		}
+		if mode == 0 {
+			for _, h := range msg.Headers {
+				if strings.HasPrefix(h.Key, cloudEventsPrefix) {
+					t.Errorf("plain republish kept %s", h.Key)
+				}
+			}
+			continue
+		}
+		if got, want := headerValue(msg.Headers, "ce_traceparent"), headerValue(msg.Headers, "traceparent"); got != want {
+			t.Errorf("ce_traceparent = %q, traceparent = %q", got, want)
+		}
+		if strings.Contains(headerValue(msg.Headers, "ce_traceparent"), original.SpanID().String()) {
+			t.Error("ce_traceparent still points at the original publish")
+		}
+		if got := headerValue(msg.Headers, "ce_id"); got != "id-1" {
+			t.Errorf("ce_id = %q, want the original message ID", got)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package kafka
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const HeaderContentType = "content-type"
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeAvro     = "avro/binary"
+)
+
+// ErrUnsupportedType is returned for values a codec cannot handle.
+var ErrUnsupportedType = errors.New("type not supported by codec")
+
+// Codec serializes message values. Its content type travels in
+// HeaderContentType.
+type Codec interface {
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+type ProtoMarshaler interface {
+	MarshalProto() ([]byte, error)
+}
+
+type ProtoUnmarshaler interface {
+	UnmarshalProto(data []byte) error
+}
+
+type AvroMarshaler interface {
+	MarshalAvro() ([]byte, error)
+}
+
+type AvroUnmarshaler interface {
+	UnmarshalAvro(data []byte) error
+}
+
+var (
+	JSON     Codec = jsonCodec{}
+	Protobuf Codec = protobufCodec{}
+	Avro     Codec = avroCodec{}
+)
+
+var codecs = map[string]Codec{
+	ContentTypeJSON:     JSON,
+	ContentTypeProtobuf: Protobuf,
+	ContentTypeAvro:     Avro,
+}
+
+// CodecByName returns the codec named "json", "protobuf" or "avro".
+func CodecByName(name string) (Codec, error) {
+	switch name {
+	case "json":
+		return JSON, nil
+	case "protobuf":
+		return Protobuf, nil
+	case "avro":
+		return Avro, nil
+	}
+	return nil, fmt.Errorf("unknown codec %q", name)
+}
+
+// WithCodec sets the codec Publish encodes values with. It defaults to JSON.
+func WithCodec(codec Codec) ProducerOption {
+	return func(p *Producer) { p.codec = codec }
+}
+
+// WithFallbackCodec sets the codec of messages without a content-type header.
+func WithFallbackCodec(codec Codec) ConsumerOption {
+	return func(c *Consumer) { c.codec = codec }
+}
+
+// WithCodecs lets Decode read the content types of codecs.
+func WithCodecs(extra ...Codec) ConsumerOption {
+	return func(c *Consumer) {
+		if c.codecs == nil {
+			c.codecs = make(map[string]Codec, len(extra))
+		}
+		for _, codec := range extra {
+			c.codecs[codec.ContentType()] = codec
+		}
+	}
+}
+
+// Decode unmarshals the message value with the codec of its content type and
+// fills in v from the envelope.
+func (m Message) Decode(v any) error {
+	codec := m.codec
+	if ct := m.Header(HeaderContentType); ct != "" {
+		var ok bool
+		if codec, ok = m.codecs[ct]; !ok {
+			if codec, ok = codecs[ct]; !ok {
+				return fmt.Errorf("unsupported content type %q", ct)
+			}
+		}
+	}
+	if codec == nil {
+		codec = JSON
+	}
+	if err := codec.Unmarshal(m.Value, v); err != nil {
+		return fmt.Errorf("failed to decode %s message: %w", codec.ContentType(), err)
+	}
+	if s, ok := v.(IDSetter); ok && m.Envelope.MessageID != "" {
+		s.SetMessageID(m.Envelope.MessageID)
+	}
+	if s, ok := v.(TypeSetter); ok && m.Envelope.EventType != "" {
+		s.SetEventType(m.Envelope.EventType)
+	}
+	return nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return ContentTypeJSON }
+
+func (jsonCodec) Marshal(v any) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string { return ContentTypeProtobuf }
+
+func (protobufCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(ProtoMarshaler)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+	}
+	return m.MarshalProto()
+}
+
+func (protobufCodec) Unmarshal(data []byte, v any) error {
+	u, ok := v.(ProtoUnmarshaler)
+	if !ok {
+		return fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+	}
+	return u.UnmarshalProto(data)
+}
+
+type avroCodec struct{}
+
+func (avroCodec) ContentType() string { return ContentTypeAvro }
+
+func (avroCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(AvroMarshaler)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+	}
+	return m.MarshalAvro()
+}
+
+func (avroCodec) Unmarshal(data []byte, v any) error {
+	u, ok := v.(AvroUnmarshaler)
+	if !ok {
+		return fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+	}
+	return u.UnmarshalAvro(data)
+}
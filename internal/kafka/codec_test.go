@@ -0,0 +1,175 @@
+package kafka
+
+import (
+	"errors"
+	"kafka-go-study/internal/models"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+var testOrder = models.Order{
+	ID:         "o-1",
+	CustomerID: "c-1",
+	Items:      []string{"book", "pen"},
+	TotalCents: 4250,
+	CreatedAt:  time.UnixMilli(1700000000000).UTC(),
+}
+
+func encodedMessage(t *testing.T, codec Codec, v any) Message {
+	t.Helper()
+	data, err := codec.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Message{
+		Value:   data,
+		Headers: []kafka.Header{{Key: HeaderContentType, Value: []byte(codec.ContentType())}},
+	}
+}
+
+func TestDecodeByContentType(t *testing.T) {
+	for _, codec := range []Codec{JSON, Protobuf, Avro} {
+		t.Run(codec.ContentType(), func(t *testing.T) {
+			// The fallback codec only applies without a content type.
+			msg := encodedMessage(t, codec, testOrder)
+			msg.codec = JSON
+
+			var got models.Order
+			if err := msg.Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			got.CreatedAt = got.CreatedAt.UTC()
+			if !reflect.DeepEqual(got, testOrder) {
+				t.Errorf("got %+v, want %+v", got, testOrder)
+			}
+		})
+	}
+}
+
+func TestDecodeWithoutContentType(t *testing.T) {
+	data, _ := Avro.Marshal(testOrder)
+
+	var got models.Order
+	if err := (Message{Value: data, codec: Avro}).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != testOrder.ID {
+		t.Errorf("fallback codec decoded %+v", got)
+	}
+
+	// Without a fallback, values are JSON.
+	if err := (Message{Value: []byte(`{"id":"o-2"}`)}).Decode(&got); err != nil || got.ID != "o-2" {
+		t.Errorf("Decode = %+v, %v, want JSON", got, err)
+	}
+}
+
+func TestDecodeUnknownContentType(t *testing.T) {
+	msg := Message{
+		Value:   []byte("<order/>"),
+		Headers: []kafka.Header{{Key: HeaderContentType, Value: []byte("application/xml")}},
+	}
+	err := msg.Decode(&models.Order{})
+	if err == nil || !strings.Contains(err.Error(), "application/xml") {
+		t.Errorf("Decode = %v, want an unsupported content type error", err)
+	}
+}
+
+// upperJSON is a codec with its own content type, as registered with
+// WithCodecs.
+type upperJSON struct{}
+
+func (upperJSON) ContentType() string           { return "application/x-upper+json" }
+func (upperJSON) Marshal(v any) ([]byte, error) { return JSON.Marshal(v) }
+func (upperJSON) Unmarshal(data []byte, v any) error {
+	return JSON.Unmarshal([]byte(strings.ToLower(string(data))), v)
+}
+
+func TestDecodeWithExtraCodecs(t *testing.T) {
+	c, _ := newTestConsumer(t, WithCodecs(upperJSON{}))
+
+	msg := c.message(kafka.Message{
+		Value:   []byte(`{"ID":"O-1"}`),
+		Headers: []kafka.Header{{Key: HeaderContentType, Value: []byte(upperJSON{}.ContentType())}},
+	})
+	var got models.Order
+	if err := msg.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != "o-1" {
+		t.Errorf("got %+v, want it decoded by the registered codec", got)
+	}
+}
+
+func TestCodecsRejectUnsupportedTypes(t *testing.T) {
+	for _, codec := range []Codec{Protobuf, Avro} {
+		if _, err := codec.Marshal(struct{}{}); !errors.Is(err, ErrUnsupportedType) {
+			t.Errorf("%s Marshal = %v, want %v", codec.ContentType(), err, ErrUnsupportedType)
+		}
+		if err := codec.Unmarshal(nil, &struct{}{}); !errors.Is(err, ErrUnsupportedType) {
+			t.Errorf("%s Unmarshal = %v, want %v", codec.ContentType(), err, ErrUnsupportedType)
+		}
+	}
+}
+
+func TestCodecByName(t *testing.T) {
+	for name, want := range map[string]Codec{"json": JSON, "protobuf": Protobuf, "avro": Avro} {
+		if got, err := CodecByName(name); err != nil || got != want {
+			t.Errorf("CodecByName(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+	for _, name := range []string{"", "JSON", "proto"} {
+		if _, err := CodecByName(name); err == nil {
+			t.Errorf("CodecByName(%q) succeeded", name)
+		}
+	}
+}
+
+func TestPublishSetsContentType(t *testing.T) {
+	p := newCapturingProducer(t, WithCodec(Protobuf))
+	if err := p.Publish(t.Context(), "o-1", testOrder); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := published(t, p)
+	if len(msgs) != 1 {
+		t.Fatalf("published %d messages, want 1", len(msgs))
+	}
+	if ct := headerValue(msgs[0].Headers, HeaderContentType); ct != ContentTypeProtobuf {
+		t.Errorf("content type = %q, want %q", ct, ContentTypeProtobuf)
+	}
+	c, _ := newTestConsumer(t)
+	var got models.Order
+	if err := c.message(msgs[0]).Decode(&got); err != nil || got.ID != testOrder.ID {
+		t.Errorf("Decode = %+v, %v", got, err)
+	}
+}
+
+func TestDecodeFillsEventFromEnvelope(t *testing.T) {
+	event := models.Event{ID: "e-1", Type: "order.created", Payload: "hello", CreatedAt: time.UnixMilli(1700000000000).UTC()}
+	for _, codec := range []Codec{JSON, Protobuf, Avro} {
+		t.Run(codec.ContentType(), func(t *testing.T) {
+			p := newCapturingProducer(t, WithCodec(codec))
+			if err := p.Publish(t.Context(), "e-1", event); err != nil {
+				t.Fatal(err)
+			}
+			msgs := published(t, p)
+			if len(msgs) != 1 {
+				t.Fatalf("published %d messages, want 1", len(msgs))
+			}
+
+			c, _ := newTestConsumer(t)
+			var got models.Event
+			if err := c.message(msgs[0]).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			got.CreatedAt = got.CreatedAt.UTC()
+			if got != event {
+				t.Errorf("got %+v, want %+v", got, event)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package kafka
+
+import (
+	"context"
+	"hash/fnv"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// WithConcurrency handles up to n messages at once, keeping the order of
+// messages with the same key.
+func WithConcurrency(n int) ConsumerOption {
+	return func(c *Consumer) { c.concurrency = n }
+}
+
+func (c *Consumer) listenConcurrent(ctx, workCtx context.Context, handler HandlerFunc) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		tracker = newOffsetTracker()
+		workers = make([]chan kafka.Message, c.concurrency)
+		errCh   = make(chan error, c.concurrency)
+		busy    atomic.Int64
+		wg      sync.WaitGroup
+	)
+
+	for i := range workers {
+		workers[i] = make(chan kafka.Message)
+		wg.Add(1)
+		go func(msgs <-chan kafka.Message) {
+			defer wg.Done()
+			for msg := range msgs {
+				if err := c.work(workCtx, msg, handler, tracker, &busy); err != nil {
+					errCh <- err
+					cancel()
+					return
+				}
+			}
+		}(workers[i])
+	}
+
+	var err error
+	for {
+		if tracker.wait(ctx) != nil {
+			break
+		}
+		msg, fetchErr := c.fetch(ctx)
+		if fetchErr != nil {
+			if ctx.Err() == nil {
+				err = fetchErr
+			}
+			break
+		}
+
+		tracker.start(msg)
+		if c.metrics != nil {
+			c.metrics.MessagesInFlight.Add(ctx, 1, c.metricAttrs(msg.Topic))
+		}
+
+		select {
+		case workers[c.workerFor(msg)] <- msg:
+		case <-ctx.Done():
+			c.abandon(ctx, tracker, msg)
+		}
+	}
+
+	for _, w := range workers {
+		close(w)
+	}
+	wg.Wait()
+	close(errCh)
+
+	if workerErr := <-errCh; workerErr != nil && err == nil {
+		err = workerErr
+	}
+	return err
+}
+
+func (c *Consumer) work(ctx context.Context, msg kafka.Message, handler HandlerFunc, tracker *offsetTracker, busy *atomic.Int64) error {
+	c.recordUtilization(ctx, busy.Add(1))
+	defer func() { c.recordUtilization(ctx, busy.Add(-1)) }()
+
+	commit, err := c.handle(ctx, msg, handler)
+	if c.metrics != nil {
+		c.metrics.MessagesInFlight.Add(ctx, -1, c.metricAttrs(msg.Topic))
+	}
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		// Cancelled by the drain deadline: the message is delivered again.
+		return nil
+	}
+
+	if next, ok := tracker.finish(msg, commit); ok {
+		return c.commit(ctx, next)
+	}
+	return nil
+}
+
+// abandon drops msg, which was never dispatched to a worker.
+func (c *Consumer) abandon(ctx context.Context, tracker *offsetTracker, msg kafka.Message) {
+	tracker.abandon(msg)
+	c.forgetReceive(msg)
+	if c.metrics != nil {
+		c.metrics.MessagesInFlight.Add(ctx, -1, c.metricAttrs(msg.Topic))
+	}
+}
+
+func (c *Consumer) recordUtilization(ctx context.Context, busy int64) {
+	if c.metrics == nil {
+		return
+	}
+	for _, topic := range c.topics {
+		c.metrics.WorkerUtilization.Record(ctx, float64(busy)/float64(c.concurrency), c.metricAttrs(topic))
+	}
+}
+
+func (c *Consumer) workerFor(msg kafka.Message) int {
+	if len(msg.Key) == 0 {
+		return int(msg.Offset % int64(c.concurrency))
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(msg.Key)
+	return int(h.Sum32() % uint32(c.concurrency))
+}
+
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+// maxPendingOffsets bounds the offsets tracked behind a slow message.
+const maxPendingOffsets = 10000
+
+type pendingOffset struct {
+	offset int64
+	done   bool
+	commit bool
+}
+
+// offsetTracker computes the commit watermark of each partition.
+type offsetTracker struct {
+	mu      sync.Mutex
+	pending map[topicPartition][]pendingOffset
+	size    int
+	limit   int
+	freed   chan struct{}
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		pending: make(map[topicPartition][]pendingOffset),
+		limit:   maxPendingOffsets,
+		freed:   make(chan struct{}, 1),
+	}
+}
+
+// wait blocks while limit offsets are pending.
+func (t *offsetTracker) wait(ctx context.Context) error {
+	for {
+		t.mu.Lock()
+		full := t.size >= t.limit
+		t.mu.Unlock()
+		if !full {
+			return nil
+		}
+		select {
+		case <-t.freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (t *offsetTracker) start(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tp := topicPartition{topic: msg.Topic, partition: msg.Partition}
+	t.pending[tp] = append(t.pending[tp], pendingOffset{offset: msg.Offset})
+	t.size++
+}
+
+func (t *offsetTracker) abandon(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tp := topicPartition{topic: msg.Topic, partition: msg.Partition}
+	n := len(t.pending[tp])
+	t.pending[tp] = slices.DeleteFunc(t.pending[tp], func(p pendingOffset) bool { return p.offset == msg.Offset })
+	t.release(n - len(t.pending[tp]))
+}
+
+// finish marks msg as done and returns the new watermark of its partition, if
+// it moved. As in sequential mode, a message that may not be committed is
+// only committed past by a later one.
+func (t *offsetTracker) finish(msg kafka.Message, commit bool) (kafka.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tp := topicPartition{topic: msg.Topic, partition: msg.Partition}
+	offsets := t.pending[tp]
+
+	i := slices.IndexFunc(offsets, func(p pendingOffset) bool { return p.offset == msg.Offset })
+	if i < 0 {
+		return kafka.Message{}, false
+	}
+	offsets[i].done = true
+	offsets[i].commit = commit
+
+	n := 0
+	for n < len(offsets) && offsets[n].done {
+		n++
+	}
+	if n == 0 {
+		return kafka.Message{}, false
+	}
+
+	last := offsets[n-1]
+	t.pending[tp] = offsets[n:]
+	t.release(n)
+	if !last.commit {
+		return kafka.Message{}, false
+	}
+	return kafka.Message{Topic: msg.Topic, Partition: msg.Partition, Offset: last.offset}, true
+}
+
+// release must be called with t.mu held.
+func (t *offsetTracker) release(n int) {
+	if n == 0 {
+		return
+	}
+	t.size -= n
+	select {
+	case t.freed <- struct{}{}:
+	default:
+	}
+}
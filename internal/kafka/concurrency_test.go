@@ -0,0 +1,234 @@
+package kafka
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// newTestConsumer returns a consumer of a broker that is never reached, with
+// its spans recorded.
+func newTestConsumer(t *testing.T, opts ...ConsumerOption) (*Consumer, *tracetest.SpanRecorder) {
+	t.Helper()
+	c := newConsumer([]string{"127.0.0.1:1"}, []string{"orders"}, "test-group", opts)
+	t.Cleanup(func() { _ = c.Close() })
+
+	spans := tracetest.NewSpanRecorder()
+	c.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)).Tracer("test")
+	return c, spans
+}
+
+func commitSpans(spans *tracetest.SpanRecorder) int {
+	n := 0
+	for _, s := range spans.Ended() {
+		if strings.HasPrefix(s.Name(), "commit ") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestOffsetTrackerWatermark(t *testing.T) {
+	tracker := newOffsetTracker()
+	msg := func(offset int64) kafka.Message { return kafka.Message{Topic: "orders", Partition: 1, Offset: offset} }
+	for _, o := range []int64{10, 11, 12} {
+		tracker.start(msg(o))
+	}
+
+	if _, ok := tracker.finish(msg(11), true); ok {
+		t.Fatal("watermark moved past unfinished offset 10")
+	}
+	if next, ok := tracker.finish(msg(10), true); !ok || next.Offset != 11 {
+		t.Fatalf("finish(10) = %d, %v, want 11, true", next.Offset, ok)
+	}
+	if next, ok := tracker.finish(msg(12), true); !ok || next.Offset != 12 {
+		t.Fatalf("finish(12) = %d, %v, want 12, true", next.Offset, ok)
+	}
+	if _, ok := tracker.finish(msg(12), true); ok {
+		t.Fatal("finishing an offset twice moved the watermark")
+	}
+}
+
+func TestOffsetTrackerPartitionsAreIndependent(t *testing.T) {
+	tracker := newOffsetTracker()
+	a := kafka.Message{Topic: "orders", Partition: 0, Offset: 5}
+	b := kafka.Message{Topic: "orders", Partition: 1, Offset: 7}
+	c := kafka.Message{Topic: "payments", Partition: 0, Offset: 3}
+	for _, m := range []kafka.Message{a, b, c} {
+		tracker.start(m)
+	}
+
+	for _, m := range []kafka.Message{c, b, a} {
+		next, ok := tracker.finish(m, true)
+		if !ok || next.Topic != m.Topic || next.Partition != m.Partition || next.Offset != m.Offset {
+			t.Fatalf("finish(%v) = %v, %v", m, next, ok)
+		}
+	}
+}
+
+func TestOffsetTrackerAbandon(t *testing.T) {
+	tracker := newOffsetTracker()
+	msg := func(offset int64) kafka.Message { return kafka.Message{Topic: "orders", Offset: offset} }
+	tracker.start(msg(1))
+	tracker.start(msg(2))
+	tracker.abandon(msg(2))
+
+	if next, ok := tracker.finish(msg(1), true); !ok || next.Offset != 1 {
+		t.Fatalf("finish(1) = %d, %v, want 1, true", next.Offset, ok)
+	}
+	if n := len(tracker.pending[topicPartition{topic: "orders"}]); n != 0 {
+		t.Fatalf("%d offsets still pending after abandon", n)
+	}
+
+	// A later message of the partition is not held back by the abandoned one.
+	tracker.start(msg(2))
+	if next, ok := tracker.finish(msg(2), true); !ok || next.Offset != 2 {
+		t.Fatalf("finish(2) = %d, %v, want 2, true", next.Offset, ok)
+	}
+}
+
+func TestWorkerForKeepsKeysTogether(t *testing.T) {
+	c := &Consumer{concurrency: 4}
+	for _, key := range []string{"order-1", "order-2", "customer-9"} {
+		want := c.workerFor(kafka.Message{Key: []byte(key), Offset: 0})
+		for offset := int64(1); offset < 20; offset++ {
+			if got := c.workerFor(kafka.Message{Key: []byte(key), Offset: offset}); got != want {
+				t.Fatalf("key %q went to workers %d and %d", key, want, got)
+			}
+		}
+	}
+
+	seen := make(map[int]bool)
+	for offset := int64(0); offset < 4; offset++ {
+		seen[c.workerFor(kafka.Message{Offset: offset})] = true
+	}
+	if len(seen) != 4 {
+		t.Fatalf("keyless messages used %d of 4 workers", len(seen))
+	}
+}
+
+func TestWorkSkipsCommitWhenDrainCancelled(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		handler HandlerFunc
+	}{
+		{"handler cancelled", func(ctx context.Context, _ Message) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+		{"handler done after cancel", func(ctx context.Context, _ Message) error {
+			<-ctx.Done()
+			return nil
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, spans := newTestConsumer(t, WithConcurrency(2))
+			tracker := newOffsetTracker()
+
+			// CommitMessages picks randomly between the commit queue and a
+			// done context, so a single run could pass by chance.
+			for offset := int64(0); offset < 50; offset++ {
+				msg := kafka.Message{Topic: "orders", Offset: offset}
+				tracker.start(msg)
+
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				var busy atomic.Int64
+				if err := c.work(ctx, msg, tc.handler, tracker, &busy); err != nil {
+					t.Fatalf("work: %v", err)
+				}
+			}
+			if n := commitSpans(spans); n != 0 {
+				t.Fatalf("%d commits after the drain deadline", n)
+			}
+		})
+	}
+}
+
+func TestWorkCommitsHandledMessage(t *testing.T) {
+	c, spans := newTestConsumer(t, WithConcurrency(2))
+	tracker := newOffsetTracker()
+	msg := kafka.Message{Topic: "orders", Offset: 3}
+	tracker.start(msg)
+
+	var busy atomic.Int64
+	handler := func(context.Context, Message) error { return nil }
+	if err := c.work(context.Background(), msg, handler, tracker, &busy); err != nil {
+		t.Fatalf("work: %v", err)
+	}
+	if n := commitSpans(spans); n != 1 {
+		t.Fatalf("got %d commits, want 1", n)
+	}
+}
+
+func TestOffsetTrackerPassesFailure(t *testing.T) {
+	tracker := newOffsetTracker()
+	msg := func(offset int64) kafka.Message { return kafka.Message{Topic: "orders", Offset: offset} }
+	for _, o := range []int64{10, 11, 12} {
+		tracker.start(msg(o))
+	}
+
+	if _, ok := tracker.finish(msg(10), true); !ok {
+		t.Fatal("watermark did not move to 10")
+	}
+	if _, ok := tracker.finish(msg(11), false); ok {
+		t.Fatal("failed offset 11 committed on its own")
+	}
+	if next, ok := tracker.finish(msg(12), true); !ok || next.Offset != 12 {
+		t.Fatalf("finish(12) = %d, %v, want 12, true", next.Offset, ok)
+	}
+	if tracker.size != 0 || len(tracker.pending[topicPartition{topic: "orders"}]) != 0 {
+		t.Errorf("%d offsets still pending", tracker.size)
+	}
+}
+
+func TestOffsetTrackerWaitsWhenFull(t *testing.T) {
+	tracker := newOffsetTracker()
+	tracker.limit = 2
+	msg := func(offset int64) kafka.Message { return kafka.Message{Topic: "orders", Offset: offset} }
+	tracker.start(msg(0))
+	tracker.start(msg(1))
+	tracker.finish(msg(1), true)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+	if err := tracker.wait(ctx); err == nil {
+		t.Fatal("wait returned with the tracker full")
+	}
+
+	tracker.finish(msg(0), true)
+	if err := tracker.wait(t.Context()); err != nil {
+		t.Fatalf("wait = %v after the watermark moved", err)
+	}
+}
+
+func TestWorkCommitsPastFailure(t *testing.T) {
+	c, spans := newTestConsumer(t, WithConcurrency(2))
+	tracker := newOffsetTracker()
+	failed := kafka.Message{Topic: "orders", Offset: 3}
+	next := kafka.Message{Topic: "orders", Offset: 4}
+	tracker.start(failed)
+	tracker.start(next)
+
+	var busy atomic.Int64
+	if err := c.work(context.Background(), failed, failing("boom"), tracker, &busy); err != nil {
+		t.Fatalf("work: %v", err)
+	}
+	if n := commitSpans(spans); n != 0 {
+		t.Fatalf("got %d commits of the failed offset, want none", n)
+	}
+	handler := func(context.Context, Message) error { return nil }
+	if err := c.work(context.Background(), next, handler, tracker, &busy); err != nil {
+		t.Fatalf("work: %v", err)
+	}
+	if n := commitSpans(spans); n != 1 {
+		t.Fatalf("got %d commits, want the next success committed", n)
+	}
+}
@@ -2,87 +2,420 @@ package kafka
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"kafka-go-study/internal/telemetry"
+	"regexp"
+	"slices"
+	"sync"
 	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 	"go.opentelemetry.io/otel/trace"
 
+	"go.uber.org/zap"
+
 	"github.com/segmentio/kafka-go"
 )
 
-type HandlerFunc func(ctx context.Context, key, value []byte) error
+type HandlerFunc func(ctx context.Context, msg Message) error
 
 type Consumer struct {
-	reader  *kafka.Reader
-	groupID string
-	topic   string
-	tracer  trace.Tracer
+	reader   *kafka.Reader
+	config   kafka.ReaderConfig
+	groupID  string
+	clientID string
+	topics   []string
+	tracer   trace.Tracer
+	metrics  *telemetry.Metrics
+	stats    *readerStats
+	log      *zap.Logger
+	codec    Codec
+	codecs   map[string]Codec
+
+	spanRelation SpanRelation
+	spanAttrs    []attribute.KeyValue
+	syncCommits  bool
+	receives     sync.Map
+
+	drainTimeout time.Duration
+	middleware   []Middleware
+
+	deadLetter      bool
+	deadLetterTopic string
+	producers       *producerPool
+
+	retryDelays   []time.Duration
+	retryTiers    []*Consumer
+	retryTier     bool
+	originGroupID string
+
+	concurrency int
+
+	flow         *flowControl
+	healthChecks []healthCheck
+
+	quarantine      QuarantineSink
+	quarantineAfter int
+	failures        *failureCounter
+
+	start    startPosition
+	noCommit bool
+}
+
+type ConsumerOption func(*Consumer)
+
+// WithMetrics records consumer metrics on m.
+func WithMetrics(m *telemetry.Metrics) ConsumerOption {
+	return func(c *Consumer) { c.metrics = m }
+}
+
+// WithLogger logs consumer lifecycle events on log.
+func WithLogger(log *zap.Logger) ConsumerOption {
+	return func(c *Consumer) { c.log = log }
+}
+
+// WithDeadLetter routes failed messages to "<origin topic>.dlq".
+func WithDeadLetter() ConsumerOption {
+	return func(c *Consumer) { c.deadLetter = true }
+}
+
+// WithDeadLetterTopic routes failed messages to topic.
+func WithDeadLetterTopic(topic string) ConsumerOption {
+	return func(c *Consumer) {
+		c.deadLetter = true
+		c.deadLetterTopic = topic
+	}
+}
+
+func NewConsumer(brokers []string, topic, groupID string, opts ...ConsumerOption) *Consumer {
+	return NewMultiTopicConsumer(brokers, []string{topic}, groupID, opts...)
+}
+
+// NewMultiTopicConsumer subscribes a single consumer group to all of topics.
+func NewMultiTopicConsumer(brokers []string, topics []string, groupID string, opts ...ConsumerOption) *Consumer {
+	c := newConsumer(brokers, topics, groupID, opts)
+
+	if len(c.retryDelays) > 0 {
+		c.deadLetter = true
+	}
+	if c.deadLetter {
+		c.producers = newProducerPool(brokers)
+		if c.quarantine != nil {
+			c.log.Warn("quarantine disabled: failures are routed to retry and dead-letter topics")
+		}
+	}
+	c.setupRetryTiers(brokers, opts)
+
+	return c
 }
 
-func NewConsumer(brokers []string, topic, groupID string) *Consumer {
-	reader := kafka.NewReader(kafka.ReaderConfig{
+// NewPatternConsumer subscribes to the topics matching pattern at startup,
+// except dead-letter and retry topics.
+func NewPatternConsumer(ctx context.Context, brokers []string, pattern *regexp.Regexp, groupID string, opts ...ConsumerOption) (*Consumer, error) {
+	topics, err := MatchTopics(ctx, brokers, pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("no topic matches %s", pattern)
+	}
+	return NewMultiTopicConsumer(brokers, topics, groupID, opts...), nil
+}
+
+func newConsumer(brokers []string, topics []string, groupID string, opts []ConsumerOption) *Consumer {
+	c := &Consumer{
+		groupID:  groupID,
+		clientID: kafka.DefaultClientID,
+		topics:   topics,
+		tracer:   otel.Tracer("kafka/consumer"),
+		log:      zap.NewNop(),
+		codec:    JSON,
+
+		drainTimeout: defaultDrainTimeout,
+		middleware:   DefaultMiddleware(),
+		flow:         newFlowControl(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	config := kafka.ReaderConfig{
 		Brokers:        brokers,
-		Topic:          topic,
 		GroupID:        groupID,
 		MinBytes:       1,
 		MaxBytes:       10e6,
 		CommitInterval: time.Second,
 		StartOffset:    kafka.FirstOffset,
-	})
+		Logger:         &groupObserver{c: c},
+		Dialer: &kafka.Dialer{
+			ClientID:  c.clientID,
+			Timeout:   10 * time.Second,
+			DualStack: true,
+		},
+	}
+	if c.syncCommits {
+		config.CommitInterval = 0
+	}
+	if len(topics) == 1 {
+		config.Topic = topics[0]
+	} else {
+		config.GroupTopics = topics
+	}
+	c.config = config
 
-	return &Consumer{
-		reader:  reader,
-		groupID: groupID,
-		topic:   topic,
-		tracer:  otel.Tracer("kafka/consumer"),
+	// The reader joins the group at once, so a start position delays it
+	// until Listen has sought.
+	if c.start == nil || c.retryTier {
+		c.openReader()
 	}
+	return c
+}
+
+func (c *Consumer) openReader() {
+	c.reader = kafka.NewReader(c.config)
+	c.registerStats()
 }
 
+// Listen handles messages until ctx is cancelled, then drains in-flight
+// handlers for up to the drain timeout.
 func (c *Consumer) Listen(ctx context.Context, handler HandlerFunc) error {
+	handler = Chain(handler, c.middleware...)
+	return c.run(ctx, func(ctx, workCtx context.Context, c *Consumer) error {
+		return c.listen(ctx, workCtx, handler)
+	})
+}
+
+// run executes loop for the consumer and each of its retry tiers.
+func (c *Consumer) run(ctx context.Context, loop func(ctx, workCtx context.Context, c *Consumer) error) error {
+	if c.reader == nil {
+		if err := c.seek(ctx); err != nil {
+			return err
+		}
+		c.openReader()
+	}
+
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+
+	fetchCtx, stopFetching := context.WithCancel(ctx)
+	defer stopFetching()
+
+	c.recordFlow(c.flow.state())
+	for _, hc := range c.healthChecks {
+		go c.watchHealth(fetchCtx, hc)
+	}
+
+	consumers := append([]*Consumer{c}, c.retryTiers...)
+	errCh := make(chan error, len(consumers))
+	for _, cons := range consumers {
+		go cons.watchLag(fetchCtx)
+		go func() { errCh <- loop(fetchCtx, workCtx, cons) }()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		var firstErr error
+		for range consumers {
+			if err := <-errCh; err != nil && firstErr == nil {
+				firstErr = err
+				stopFetching()
+			}
+		}
+		done <- firstErr
+	}()
+
+	<-fetchCtx.Done()
+	return c.shutdown(done, cancelWork)
+}
+
+func (c *Consumer) listen(ctx, workCtx context.Context, handler HandlerFunc) error {
+	if c.concurrency > 1 {
+		return c.listenConcurrent(ctx, workCtx, handler)
+	}
+
 	for {
-		msg, err := c.reader.FetchMessage(ctx)
+		msg, err := c.fetch(ctx)
 		if err != nil {
 			if ctx.Err() != nil {
 				return nil
 			}
-			return fmt.Errorf("failed to fetch message: %w", err)
+			return err
+		}
+
+		if err := c.process(workCtx, msg, handler); err != nil {
+			return err
 		}
+	}
+}
+
+func (c *Consumer) fetch(ctx context.Context) (kafka.Message, error) {
+	if err := c.flow.wait(ctx); err != nil {
+		return kafka.Message{}, err
+	}
+	start := time.Now()
+	msg, err := c.reader.FetchMessage(ctx)
+	if err != nil {
+		return msg, fmt.Errorf("failed to fetch message: %w", err)
+	}
+	c.stats.fetched(msg)
+	msg = fromCloudEvent(msg)
+	c.recordReceive(c.traceReceive(msg, start), start, msg)
+
+	if err := c.awaitDue(ctx, msg); err != nil {
+		return msg, err
+	}
+	return msg, nil
+}
+
+// awaitDue blocks a retry tier until msg is due.
+func (c *Consumer) awaitDue(ctx context.Context, msg kafka.Message) error {
+	if !c.retryTier {
+		return nil
+	}
+	if err := waitUntilDue(ctx, msg); err != nil {
+		c.forgetReceive(msg)
+		return err
+	}
+	return nil
+}
+
+func (c *Consumer) process(ctx context.Context, msg kafka.Message, handler HandlerFunc) error {
+	commit, err := c.handle(ctx, msg, handler)
+	if err != nil || !commit {
+		return err
+	}
+	return c.commit(ctx, msg)
+}
+
+func (c *Consumer) commit(ctx context.Context, msgs ...kafka.Message) error {
+	if c.noCommit {
+		return nil
+	}
+
+	ctx, span := c.startSettle(ctx, msgs)
+	defer span.End()
+
+	start := time.Now()
+	err := c.reader.CommitMessages(ctx, msgs...)
+	c.recordCommit(ctx, start, msgs, err)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to commit offsets: %w", err)
+	}
+	span.SetStatus(codes.Ok, "")
+	c.stats.committed(len(msgs))
+	return nil
+}
 
-		carrier := &kafkaHeaderCarrier{headers: &msg.Headers}
-		msgCtx := otel.GetTextMapPropagator().Extract(ctx, carrier)
-
-		msgCtx, span := c.tracer.Start(msgCtx, fmt.Sprintf("receive %s", c.topic),
-			trace.WithSpanKind(trace.SpanKindConsumer),
-			trace.WithAttributes(
-				semconv.MessagingSystemKafka,
-				semconv.MessagingDestinationName(c.topic),
-				attribute.String("messaging.kafka.message.key", string(msg.Key)),
-				attribute.Int("messaging.kafka.partition", msg.Partition),
-				attribute.Int64("messaging.kafka.offset", msg.Offset),
-				attribute.String("messaging.kafka.consumer.group", c.groupID),
-			),
-		)
-
-		if err := handler(msgCtx, msg.Key, msg.Value); err != nil {
-			span.RecordError(err)
-			span.SetStatus(codes.Error, err.Error())
-			span.End()
-			continue
+// handle runs handler and routes its failures. It reports whether the offset
+// may be committed.
+func (c *Consumer) handle(ctx context.Context, msg kafka.Message, handler HandlerFunc) (bool, error) {
+	msgCtx := c.handlerContext(ctx, msg)
+
+	err := c.runHandler(msgCtx, handler, msg)
+	if err == nil {
+		if c.failures != nil {
+			c.failures.reset(msg)
 		}
+		return true, nil
+	}
+	if ctx.Err() != nil {
+		// Cancelled by the drain deadline: deliver it again.
+		return false, nil
+	}
+	c.recordFailure(msgCtx, msg.Topic, 1, err)
+
+	if c.quarantine != nil && len(c.retryDelays) == 0 && !c.deadLetter {
+		return c.handleInPlace(ctx, msgCtx, msg, handler, err)
+	}
+	return c.routeFailure(msgCtx, msg, err)
+}
+
+func (c *Consumer) runHandler(ctx context.Context, handler HandlerFunc, msg kafka.Message) error {
+	start := time.Now()
+	err := callHandler(ctx, handler, c.message(msg))
+	c.recordProcess(ctx, start, msg, err)
+	return err
+}
 
-		span.SetStatus(codes.Ok, "")
-		span.End()
+func (c *Consumer) recordFailure(ctx context.Context, topic string, messages int, err error) {
+	if c.metrics == nil {
+		return
+	}
+	c.metrics.MessagesFailed.Add(ctx, int64(messages), c.metricAttrs(topic))
 
-		if err := c.reader.CommitMessages(ctx, msg); err != nil {
-			return fmt.Errorf("failed to commit offset: %w", err)
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		c.metrics.HandlerPanics.Add(ctx, 1, c.metricAttrs(topic))
+	}
+}
+
+// routeFailure sends msg to the next retry tier or the dead-letter topic.
+func (c *Consumer) routeFailure(ctx context.Context, msg kafka.Message, cause error) (bool, error) {
+	switch {
+	case len(c.retryDelays) > 0:
+		if err := c.sendToRetry(ctx, msg, cause); err != nil {
+			return false, fmt.Errorf("failed to route message to retry topic: %w", err)
+		}
+		if c.metrics != nil {
+			c.metrics.MessagesRetried.Add(ctx, 1, c.metricAttrs(msg.Topic))
+		}
+	case c.deadLetter:
+		if err := c.sendToDeadLetter(ctx, msg, cause); err != nil {
+			return false, fmt.Errorf("failed to route message to dead-letter topic: %w", err)
 		}
+		if c.metrics != nil {
+			c.metrics.MessagesDeadLettered.Add(ctx, 1, c.metricAttrs(msg.Topic))
+		}
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func (c *Consumer) metricAttrs(topic string) metric.MeasurementOption {
+	return metric.WithAttributes(
+		attribute.String("topic", topic),
+		attribute.String("consumer_group", c.groupID),
+	)
+}
+
+// destination names spans after the topic, or the group for several topics.
+func (c *Consumer) destination(topics ...string) (string, []attribute.KeyValue) {
+	if len(topics) == 0 || slices.ContainsFunc(topics, func(t string) bool { return t != topics[0] }) {
+		return c.groupID, nil
+	}
+	return topics[0], []attribute.KeyValue{semconv.MessagingDestinationName(topics[0])}
+}
+
+func messageTopics(msgs []kafka.Message) []string {
+	topics := make([]string, len(msgs))
+	for i, msg := range msgs {
+		topics[i] = msg.Topic
 	}
+	return topics
 }
 
 func (c *Consumer) Close() error {
+	for _, tier := range c.retryTiers {
+		_ = tier.closeReader()
+	}
+	if c.producers != nil {
+		c.producers.close()
+	}
+	return c.closeReader()
+}
+
+func (c *Consumer) closeReader() error {
+	if c.reader == nil {
+		return nil
+	}
+	c.stats.unregister()
 	return c.reader.Close()
 }
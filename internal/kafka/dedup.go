@@ -0,0 +1,74 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"kafka-go-study/internal/telemetry"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DedupStore remembers which messages were already handled.
+type DedupStore interface {
+	Contains(ctx context.Context, key string) (bool, error)
+	Add(ctx context.Context, key string) error
+}
+
+// DedupKey reads the deduplication key from header, falling back to the
+// origin partition and offset.
+func DedupKey(header string) func(Message) string {
+	return func(msg Message) string {
+		if header != "" {
+			if v := msg.Header(header); v != "" {
+				return v
+			}
+		}
+		if msg.Header(HeaderRetryOriginTopic) != "" {
+			return msg.Header(HeaderRetryOriginPartition) + "/" + msg.Header(HeaderRetryOriginOffset)
+		}
+		return strconv.Itoa(msg.Partition) + "/" + strconv.FormatInt(msg.Offset, 10)
+	}
+}
+
+// Deduplicate skips messages whose key is already in store. Keys are scoped
+// by the origin topic and group.
+func Deduplicate(store DedupStore, key func(Message) string, m *telemetry.Metrics) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg Message) error {
+			k := key(msg)
+			if k == "" {
+				return next(ctx, msg)
+			}
+			k = fmt.Sprintf("%s/%s/%s", msg.OriginGroupID(), msg.OriginTopic(), k)
+
+			seen, err := store.Contains(ctx, k)
+			if err != nil {
+				return fmt.Errorf("failed to check dedup store: %w", err)
+			}
+			if seen {
+				trace.SpanFromContext(ctx).AddEvent("duplicate message skipped",
+					trace.WithAttributes(attribute.String("messaging.dedup.key", k)),
+				)
+				if m != nil {
+					m.MessagesDeduplicated.Add(ctx, 1, metric.WithAttributes(
+						attribute.String("topic", msg.Topic),
+						attribute.String("consumer_group", msg.GroupID),
+					))
+				}
+				return nil
+			}
+
+			if err := next(ctx, msg); err != nil {
+				return err
+			}
+
+			if err := store.Add(ctx, k); err != nil {
+				trace.SpanFromContext(ctx).RecordError(fmt.Errorf("failed to record message in dedup store: %w", err))
+			}
+			return nil
+		}
+	}
+}
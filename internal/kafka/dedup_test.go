@@ -0,0 +1,105 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type mapDedupStore map[string]bool
+
+func (s mapDedupStore) Contains(_ context.Context, key string) (bool, error) { return s[key], nil }
+
+func (s mapDedupStore) Add(_ context.Context, key string) error {
+	s[key] = true
+	return nil
+}
+
+func TestDeduplicate(t *testing.T) {
+	store := mapDedupStore{}
+	var handled []string
+	fail := false
+	handler := Chain(func(_ context.Context, msg Message) error {
+		if fail {
+			return errors.New("failed")
+		}
+		handled = append(handled, string(msg.Value))
+		return nil
+	}, Deduplicate(store, DedupKey(HeaderMessageID), nil))
+
+	msg := func(topic, id string, offset int64, value string) Message {
+		// Every message has the same key, as with ORDER_PARTITION_KEY=customer_id.
+		m := Message{Topic: topic, GroupID: "g", Partition: 1, Offset: offset, Key: []byte("c-1"), Value: []byte(value)}
+		if id != "" {
+			m.Headers = []kafka.Header{{Key: HeaderMessageID, Value: []byte(id)}}
+		}
+		return m
+	}
+	ctx := context.Background()
+
+	fail = true
+	if err := handler(ctx, msg("orders", "m-1", 0, "failed")); err == nil {
+		t.Fatal("handler error was swallowed")
+	}
+	fail = false
+
+	for _, m := range []Message{
+		msg("orders", "m-1", 0, "first"),
+		msg("orders", "m-1", 1, "duplicate"),
+		msg("payments", "m-1", 0, "other topic"),
+		msg("orders", "", 5, "by position"),
+		msg("orders", "", 5, "redelivered"),
+		msg("orders", "", 6, "same key"),
+	} {
+		if err := handler(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"first", "other topic", "by position", "same key"}
+	if len(handled) != len(want) {
+		t.Fatalf("handled %q, want %q", handled, want)
+	}
+	for i := range want {
+		if handled[i] != want[i] {
+			t.Errorf("handled %q, want %q", handled, want)
+			break
+		}
+	}
+	if !store["g/orders/m-1"] || !store["g/payments/m-1"] || !store["g/orders/1/5"] {
+		t.Errorf("store = %v, want keys scoped by group and topic", store)
+	}
+}
+
+func TestDeduplicateAcrossRetryTiers(t *testing.T) {
+	c := newRoutingConsumer(t, WithRetryTiers(5*time.Second))
+	tier := c.retryTiers[0]
+	store := mapDedupStore{}
+	handled := 0
+	handler := Chain(func(context.Context, Message) error {
+		handled++
+		return nil
+	}, Deduplicate(store, DedupKey(HeaderMessageID), nil))
+
+	id := kafka.Header{Key: HeaderMessageID, Value: []byte("m-1")}
+	retried := tier.message(kafka.Message{
+		Topic:   "orders.retry.5s",
+		Headers: []kafka.Header{id, {Key: HeaderRetryOriginTopic, Value: []byte("orders")}},
+	})
+	if retried.GroupID != "test-group.retry.5s" || retried.OriginGroupID() != "test-group" {
+		t.Fatalf("retried message of group %q from %q, want test-group", retried.GroupID, retried.OriginGroupID())
+	}
+	redelivered := c.message(kafka.Message{Topic: "orders", Headers: []kafka.Header{id}})
+
+	for _, msg := range []Message{retried, redelivered} {
+		if err := handler(t.Context(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if handled != 1 || !store["test-group/orders/m-1"] {
+		t.Errorf("handled %d times with store %v, want the redelivery skipped", handled, store)
+	}
+}
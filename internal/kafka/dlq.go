@@ -0,0 +1,63 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	HeaderDeadLetterError     = "x-dlq-error"
+	HeaderDeadLetterTopic     = "x-dlq-source-topic"
+	HeaderDeadLetterPartition = "x-dlq-source-partition"
+	HeaderDeadLetterOffset    = "x-dlq-source-offset"
+	HeaderDeadLetterAttempts  = "x-dlq-attempts"
+	HeaderDeadLetterGroup     = "x-dlq-consumer-group"
+)
+
+func DeadLetterTopic(topic string) string {
+	return topic + ".dlq"
+}
+
+func (c *Consumer) sendToDeadLetter(ctx context.Context, msg kafka.Message, cause error) error {
+	headers := withoutHeaders(msg.Headers,
+		HeaderDeadLetterError,
+		HeaderDeadLetterTopic,
+		HeaderDeadLetterPartition,
+		HeaderDeadLetterOffset,
+		HeaderDeadLetterAttempts,
+		HeaderDeadLetterGroup,
+	)
+	topic, partition, offset := msg.Topic, strconv.Itoa(msg.Partition), strconv.FormatInt(msg.Offset, 10)
+	if origin := headerValue(msg.Headers, HeaderRetryOriginTopic); origin != "" {
+		topic = origin
+		partition = headerValue(msg.Headers, HeaderRetryOriginPartition)
+		offset = headerValue(msg.Headers, HeaderRetryOriginOffset)
+	}
+
+	group := c.groupID
+	if c.originGroupID != "" {
+		group = c.originGroupID
+	}
+
+	headers = append(headers,
+		kafka.Header{Key: HeaderDeadLetterError, Value: []byte(cause.Error())},
+		kafka.Header{Key: HeaderDeadLetterTopic, Value: []byte(topic)},
+		kafka.Header{Key: HeaderDeadLetterPartition, Value: []byte(partition)},
+		kafka.Header{Key: HeaderDeadLetterOffset, Value: []byte(offset)},
+		kafka.Header{Key: HeaderDeadLetterAttempts, Value: []byte(strconv.Itoa(attempts(msg.Headers)))},
+		kafka.Header{Key: HeaderDeadLetterGroup, Value: []byte(group)},
+	)
+
+	dest := c.deadLetterTopic
+	if dest == "" {
+		dest = DeadLetterTopic(topic)
+	}
+	return c.producers.get(dest).PublishRaw(ctx, msg.Key, msg.Value, headers)
+}
+
+func attempts(headers []kafka.Header) int {
+	n, _ := strconv.Atoi(headerValue(headers, HeaderRetryAttempt))
+	return n + 1
+}
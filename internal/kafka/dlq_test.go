@@ -0,0 +1,129 @@
+package kafka
+
+import (
+	"kafka-go-study/internal/telemetry"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func withTestMetrics(t *testing.T) (ConsumerOption, *sdkmetric.ManualReader) {
+	t.Helper()
+	reader := sdkmetric.NewManualReader()
+	metrics, err := telemetry.NewMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return WithMetrics(metrics), reader
+}
+
+// counted returns the value of the counter name for topic.
+func counted(t *testing.T, reader *sdkmetric.ManualReader, name, topic string) int64 {
+	t.Helper()
+	sum, _ := collect(t, reader, name).(metricdata.Sum[int64])
+	for _, p := range sum.DataPoints {
+		if v, _ := p.Attributes.Value("topic"); v.AsString() == topic {
+			return p.Value
+		}
+	}
+	return 0
+}
+
+func TestDeadLetter(t *testing.T) {
+	metrics, reader := withTestMetrics(t)
+	c := newRoutingConsumer(t, WithDeadLetter(), metrics)
+
+	msg := kafka.Message{
+		Topic: "orders", Partition: 1, Offset: 7,
+		Key: []byte("o-1"), Value: []byte("order"),
+		Headers: []kafka.Header{
+			{Key: "traceparent", Value: []byte(producerTraceparent)},
+			// Left by an earlier dead-lettering, e.g. on a redrive.
+			{Key: HeaderDeadLetterError, Value: []byte("old")},
+		},
+	}
+	dead := handleOne(t, c, msg, failing("invalid order"), "orders.dlq")
+
+	if string(dead.Key) != "o-1" || string(dead.Value) != "order" {
+		t.Errorf("dead-lettered %q = %q, want the original key and value", dead.Key, dead.Value)
+	}
+	for key, want := range map[string]string{
+		HeaderDeadLetterError:     "invalid order",
+		HeaderDeadLetterTopic:     "orders",
+		HeaderDeadLetterPartition: "1",
+		HeaderDeadLetterOffset:    "7",
+		HeaderDeadLetterAttempts:  "1",
+		HeaderDeadLetterGroup:     "test-group",
+	} {
+		if got := headerValue(dead.Headers, key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+		if n := headerCount(dead.Headers, key); n != 1 {
+			t.Errorf("%d %s headers, want 1", n, key)
+		}
+	}
+	// The dead-letter publish continues the trace of the failed message.
+	if tp := headerValue(dead.Headers, "traceparent"); len(tp) != 55 || tp[3:35] != producerTraceparent[3:35] {
+		t.Errorf("traceparent = %q, want one in the trace of %q", tp, producerTraceparent)
+	}
+
+	if n := counted(t, reader, "messages_failed_total", "orders"); n != 1 {
+		t.Errorf("messages_failed_total = %d, want 1", n)
+	}
+	if n := counted(t, reader, "messages_dead_lettered_total", "orders"); n != 1 {
+		t.Errorf("messages_dead_lettered_total = %d, want 1", n)
+	}
+}
+
+func TestDeadLetterFromRetryTier(t *testing.T) {
+	c := newRoutingConsumer(t, WithRetryTiers(5*time.Second), WithDeadLetter())
+
+	retried := handleOne(t, c, kafka.Message{Topic: "orders", Partition: 1, Offset: 7}, failing("boom"), RetryTopic("orders", 5*time.Second))
+	retried.Topic = RetryTopic("orders", 5*time.Second)
+	dead := handleOne(t, c.retryTiers[0], retried, failing("gave up"), "orders.dlq")
+
+	if got := headerValue(dead.Headers, HeaderDeadLetterGroup); got != "test-group" {
+		t.Errorf("%s = %q, want the group of the original topic", HeaderDeadLetterGroup, got)
+	}
+}
+
+func TestDeadLetterTopic(t *testing.T) {
+	c := newRoutingConsumer(t, WithDeadLetterTopic("failures"))
+
+	p := routedTo(t, c, "failures")
+	for _, topic := range []string{"orders", "payments"} {
+		if commit, err := c.handle(t.Context(), kafka.Message{Topic: topic}, failing("boom")); err != nil || !commit {
+			t.Fatalf("handle = %v, %v, want the failure dead-lettered", commit, err)
+		}
+	}
+
+	dead := published(t, p)
+	if len(dead) != 2 {
+		t.Fatalf("%d messages dead-lettered, want 2", len(dead))
+	}
+	for i, topic := range []string{"orders", "payments"} {
+		if got := headerValue(dead[i].Headers, HeaderDeadLetterTopic); got != topic {
+			t.Errorf("source topic = %q, want %q", got, topic)
+		}
+	}
+}
+
+func TestFailureWithoutDeadLetterIsNotCommitted(t *testing.T) {
+	metrics, reader := withTestMetrics(t)
+	c := newRoutingConsumer(t, metrics)
+
+	commit, err := c.handle(t.Context(), kafka.Message{Topic: "orders"}, failing("boom"))
+	if err != nil || commit {
+		t.Errorf("handle = %v, %v, want the offset left uncommitted", commit, err)
+	}
+	if c.producers != nil {
+		t.Error("a consumer without dead-letter topic has producers")
+	}
+	if n := counted(t, reader, "messages_failed_total", "orders"); n != 1 {
+		t.Errorf("messages_failed_total = %d, want 1", n)
+	}
+}
@@ -0,0 +1,233 @@
+package kafka
+
+import (
+	"context"
+	"path"
+	"reflect"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.uber.org/zap"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+)
+
+// Envelope headers, set on every published message.
+const (
+	HeaderMessageID       = "message-id"
+	HeaderEventType       = "event-type"
+	HeaderSchemaVersion   = "schema-version"
+	HeaderProducerService = "producer-service"
+	HeaderProducerVersion = "producer-version"
+	HeaderCorrelationID   = "correlation-id"
+	HeaderCreatedAt       = "created-at"
+)
+
+// Envelope is the metadata every message carries in headers.
+type Envelope struct {
+	MessageID       string
+	EventType       string
+	SchemaVersion   string
+	ContentType     string
+	ProducerService string
+	ProducerVersion string
+	CorrelationID   string
+	CreatedAt       time.Time
+}
+
+// Identified, Typed and Versioned set the envelope of values. Values that are
+// not Typed are typed by their Go type name.
+type Identified interface {
+	MessageID() string
+}
+
+type Typed interface {
+	EventType() string
+}
+
+type Versioned interface {
+	SchemaVersion() string
+}
+
+// IDSetter and TypeSetter let Decode fill values in from the envelope.
+type IDSetter interface {
+	SetMessageID(id string)
+}
+
+type TypeSetter interface {
+	SetEventType(eventType string)
+}
+
+// NewEnvelope returns the envelope of value encoded with codec.
+func NewEnvelope(ctx context.Context, value any, codec Codec) Envelope {
+	e := Envelope{
+		ContentType:   codec.ContentType(),
+		CorrelationID: CorrelationID(ctx),
+		CreatedAt:     time.Now(),
+	}
+	if v, ok := value.(Identified); ok {
+		e.MessageID = v.MessageID()
+	}
+	if v, ok := value.(Typed); ok {
+		e.EventType = v.EventType()
+	} else if t := reflect.TypeOf(value); t != nil {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		e.EventType = t.Name()
+	}
+	if v, ok := value.(Versioned); ok {
+		e.SchemaVersion = v.SchemaVersion()
+	}
+	return e
+}
+
+// ParseEnvelope reads the envelope from headers.
+func ParseEnvelope(headers []kafka.Header) Envelope {
+	e := Envelope{
+		MessageID:       headerValue(headers, HeaderMessageID),
+		EventType:       headerValue(headers, HeaderEventType),
+		SchemaVersion:   headerValue(headers, HeaderSchemaVersion),
+		ContentType:     headerValue(headers, HeaderContentType),
+		ProducerService: headerValue(headers, HeaderProducerService),
+		ProducerVersion: headerValue(headers, HeaderProducerVersion),
+		CorrelationID:   headerValue(headers, HeaderCorrelationID),
+	}
+	if t, err := time.Parse(time.RFC3339Nano, headerValue(headers, HeaderCreatedAt)); err == nil {
+		e.CreatedAt = t
+	}
+	return e
+}
+
+// Headers returns the non-empty fields of e as headers.
+func (e Envelope) Headers() []kafka.Header {
+	var headers []kafka.Header
+	add := func(key, value string) {
+		if value != "" {
+			headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+		}
+	}
+	add(HeaderMessageID, e.MessageID)
+	add(HeaderEventType, e.EventType)
+	add(HeaderSchemaVersion, e.SchemaVersion)
+	add(HeaderContentType, e.ContentType)
+	add(HeaderProducerService, e.ProducerService)
+	add(HeaderProducerVersion, e.ProducerVersion)
+	add(HeaderCorrelationID, e.CorrelationID)
+	if !e.CreatedAt.IsZero() {
+		add(HeaderCreatedAt, e.CreatedAt.UTC().Format(time.RFC3339Nano))
+	}
+	return headers
+}
+
+// envelopeHeaders are the headers an Envelope is made of.
+var envelopeHeaders = []string{
+	HeaderMessageID, HeaderEventType, HeaderSchemaVersion, HeaderContentType,
+	HeaderProducerService, HeaderProducerVersion, HeaderCorrelationID, HeaderCreatedAt,
+}
+
+// completeEnvelope fills in the fields the publisher left empty.
+func completeEnvelope(ctx context.Context, headers []kafka.Header) Envelope {
+	e := ParseEnvelope(headers)
+	if e.MessageID == "" {
+		e.MessageID = uuid.NewString()
+	}
+	if e.ProducerService == "" {
+		e.ProducerService, e.ProducerVersion = service()
+	}
+	if e.CorrelationID == "" {
+		e.CorrelationID = CorrelationID(ctx)
+	}
+	if e.CorrelationID == "" {
+		e.CorrelationID = e.MessageID
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	return e
+}
+
+func (e Envelope) attrs() []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	add := func(kv attribute.KeyValue) {
+		if kv.Value.AsString() != "" {
+			attrs = append(attrs, kv)
+		}
+	}
+	add(semconv.MessagingMessageID(e.MessageID))
+	add(semconv.MessagingMessageConversationID(e.CorrelationID))
+	add(attribute.String("messaging.message.event_type", e.EventType))
+	add(attribute.String("messaging.message.schema_version", e.SchemaVersion))
+	add(attribute.String("messaging.message.content_type", e.ContentType))
+	add(attribute.String("messaging.message.producer.service", e.ProducerService))
+	add(attribute.String("messaging.message.producer.version", e.ProducerVersion))
+	return attrs
+}
+
+func (e Envelope) fields() []zap.Field {
+	var fields []zap.Field
+	add := func(key, value string) {
+		if value != "" {
+			fields = append(fields, zap.String(key, value))
+		}
+	}
+	add("message_id", e.MessageID)
+	add("correlation_id", e.CorrelationID)
+	add("event_type", e.EventType)
+	add("schema_version", e.SchemaVersion)
+	add("producer_service", e.ProducerService)
+	return fields
+}
+
+type correlationIDKey struct{}
+
+// ContextWithCorrelationID sets the correlation ID of publishes made with ctx.
+func ContextWithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationID returns the correlation ID set on ctx, if any.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+var (
+	serviceMu      sync.Mutex
+	serviceName    string
+	serviceVersion string
+)
+
+// SetService sets the producer service name and version of the envelope.
+func SetService(name, version string) {
+	serviceMu.Lock()
+	defer serviceMu.Unlock()
+	serviceName, serviceVersion = name, version
+}
+
+func service() (string, string) {
+	serviceMu.Lock()
+	defer serviceMu.Unlock()
+	if serviceName == "" {
+		serviceName, serviceVersion = buildService()
+	}
+	return serviceName, serviceVersion
+}
+
+func buildService() (string, string) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown", ""
+	}
+	version := info.Main.Version
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			version = s.Value[:min(len(s.Value), 12)]
+		}
+	}
+	return path.Base(info.Path), version
+}
@@ -0,0 +1,133 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type identifiedPlaced struct {
+	placed
+}
+
+func (identifiedPlaced) MessageID() string { return "m-1" }
+
+type refunded struct{}
+
+func TestNewEnvelope(t *testing.T) {
+	ctx := ContextWithCorrelationID(context.Background(), "corr-1")
+
+	for _, tt := range []struct {
+		name  string
+		value any
+		want  Envelope
+	}{
+		{"typed and versioned", placed{}, Envelope{EventType: "order.placed", SchemaVersion: "1"}},
+		{"identified", identifiedPlaced{}, Envelope{MessageID: "m-1", EventType: "order.placed", SchemaVersion: "1"}},
+		{"type name", refunded{}, Envelope{EventType: "refunded"}},
+		{"pointer type name", &refunded{}, Envelope{EventType: "refunded"}},
+		{"nil", nil, Envelope{}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewEnvelope(ctx, tt.value, Protobuf)
+			if got.CreatedAt.IsZero() || time.Since(got.CreatedAt) > time.Minute {
+				t.Errorf("created at %v, want now", got.CreatedAt)
+			}
+			got.CreatedAt = time.Time{}
+
+			tt.want.ContentType = ContentTypeProtobuf
+			tt.want.CorrelationID = "corr-1"
+			if got != tt.want {
+				t.Errorf("NewEnvelope = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvelopeHeadersRoundTrip(t *testing.T) {
+	env := Envelope{
+		MessageID:       "m-1",
+		EventType:       "order.placed",
+		SchemaVersion:   "2",
+		ContentType:     ContentTypeJSON,
+		ProducerService: "order-api",
+		ProducerVersion: "abc123",
+		CorrelationID:   "corr-1",
+		CreatedAt:       time.Date(2026, 1, 2, 3, 4, 5, 678000000, time.FixedZone("BRT", -3*3600)),
+	}
+	got := ParseEnvelope(env.Headers())
+	if !got.CreatedAt.Equal(env.CreatedAt) {
+		t.Errorf("created at %v, want %v", got.CreatedAt, env.CreatedAt)
+	}
+	got.CreatedAt = env.CreatedAt
+	if got != env {
+		t.Errorf("ParseEnvelope = %+v, want %+v", got, env)
+	}
+
+	headers := Envelope{MessageID: "m-1"}.Headers()
+	if len(headers) != 1 || headers[0].Key != HeaderMessageID {
+		t.Errorf("Headers = %q, want only the message ID", headers)
+	}
+	if env := ParseEnvelope([]kafka.Header{{Key: HeaderCreatedAt, Value: []byte("yesterday")}}); !env.CreatedAt.IsZero() {
+		t.Errorf("malformed created-at parsed as %v", env.CreatedAt)
+	}
+}
+
+func TestCompleteEnvelope(t *testing.T) {
+	SetService("order-api", "v1")
+	t.Cleanup(func() { SetService("", "") })
+
+	// A message published outside any conversation starts one.
+	env := completeEnvelope(context.Background(), nil)
+	if env.MessageID == "" || env.CorrelationID != env.MessageID {
+		t.Errorf("envelope = %+v, want a new message ID as correlation ID", env)
+	}
+	if env.ProducerService != "order-api" || env.ProducerVersion != "v1" || env.CreatedAt.IsZero() {
+		t.Errorf("envelope = %+v, want the producer service and creation time", env)
+	}
+
+	env = completeEnvelope(ContextWithCorrelationID(context.Background(), "corr-1"), nil)
+	if env.CorrelationID != "corr-1" {
+		t.Errorf("correlation ID = %q, want the one of the context", env.CorrelationID)
+	}
+
+	// A republished message keeps its envelope.
+	original := Envelope{
+		MessageID:       "m-1",
+		ProducerService: "payment-api",
+		ProducerVersion: "v0",
+		CorrelationID:   "corr-0",
+		CreatedAt:       time.UnixMilli(1700000000000),
+	}
+	env = completeEnvelope(ContextWithCorrelationID(context.Background(), "corr-1"), original.Headers())
+	if env.MessageID != "m-1" || env.ProducerService != "payment-api" || env.ProducerVersion != "v0" ||
+		env.CorrelationID != "corr-0" || !env.CreatedAt.Equal(original.CreatedAt) {
+		t.Errorf("envelope = %+v, want %+v kept", env, original)
+	}
+}
+
+func TestHandlerPublishesInItsConversation(t *testing.T) {
+	c, _ := newTestConsumer(t)
+	p := newCapturingProducer(t)
+
+	first := Envelope{MessageID: "m-1", CorrelationID: "corr-1"}
+	msg := kafka.Message{Topic: "orders", Headers: first.Headers()}
+	var seen Envelope
+	commit, err := c.handle(t.Context(), msg, func(ctx context.Context, msg Message) error {
+		seen = msg.Envelope
+		return p.Publish(ctx, "p-1", placed{ID: "p-1"})
+	})
+	if err != nil || !commit {
+		t.Fatalf("handle = %v, %v", commit, err)
+	}
+	if seen.MessageID != "m-1" || seen.CorrelationID != "corr-1" {
+		t.Errorf("handler saw envelope %+v, want %+v", seen, first)
+	}
+
+	out := ParseEnvelope(published(t, p)[0].Headers)
+	if out.CorrelationID != "corr-1" || out.MessageID == "m-1" || out.EventType != "order.placed" {
+		t.Errorf("published envelope = %+v, want a new message in conversation corr-1", out)
+	}
+}
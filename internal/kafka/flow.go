@@ -0,0 +1,247 @@
+package kafka
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// HealthCheck reports whether a dependency of the handler is available.
+type HealthCheck func(ctx context.Context) error
+
+type healthCheck struct {
+	name     string
+	interval time.Duration
+	check    HealthCheck
+}
+
+// FlowState is the pause and rate-limit state of a consumer.
+type FlowState struct {
+	Paused      bool    `json:"paused"`
+	PauseReason string  `json:"pause_reason,omitempty"`
+	RateLimit   float64 `json:"rate_limit"`
+	Burst       int     `json:"burst"`
+}
+
+// WithRateLimit fetches at most perSecond messages per second.
+func WithRateLimit(perSecond float64, burst int) ConsumerOption {
+	return func(c *Consumer) { c.flow.setRate(perSecond, burst) }
+}
+
+// WithHealthCheck pauses the consumer while check fails.
+func WithHealthCheck(name string, interval time.Duration, check HealthCheck) ConsumerOption {
+	return func(c *Consumer) {
+		c.healthChecks = append(c.healthChecks, healthCheck{name: name, interval: interval, check: check})
+	}
+}
+
+// Pause stops fetching messages without leaving the group.
+func (c *Consumer) Pause(reason string) {
+	c.transition(reason, func(f *flowControl) {
+		f.paused = true
+		f.pauseReason = reason
+	})
+}
+
+// Resume undoes Pause.
+func (c *Consumer) Resume(reason string) {
+	c.transition(reason, func(f *flowControl) {
+		f.paused = false
+		f.pauseReason = ""
+	})
+}
+
+// SetRateLimit changes the rate limit. A perSecond of 0 removes it.
+func (c *Consumer) SetRateLimit(perSecond float64, burst int, reason string) {
+	c.transition(reason, func(f *flowControl) { f.setRate(perSecond, burst) })
+}
+
+func (c *Consumer) FlowState() FlowState {
+	return c.flow.state()
+}
+
+func (c *Consumer) transition(reason string, change func(*flowControl)) {
+	before, after := c.flow.update(change)
+	if before == after {
+		return
+	}
+
+	log := c.log.With(
+		zap.Strings("topics", c.topics),
+		zap.String("consumer_group", c.groupID),
+		zap.String("reason", reason),
+	)
+	switch {
+	case after.Paused && !before.Paused:
+		log.Warn("consumer paused")
+	case !after.Paused && before.Paused:
+		log.Info("consumer resumed")
+	}
+	if after.RateLimit != before.RateLimit || after.Burst != before.Burst {
+		log.Info("consumer rate limit changed",
+			zap.Float64("rate_limit", after.RateLimit),
+			zap.Int("burst", after.Burst),
+		)
+	}
+	c.recordFlow(after)
+}
+
+func (c *Consumer) recordFlow(state FlowState) {
+	if c.metrics == nil {
+		return
+	}
+	ctx := context.Background()
+	paused := int64(0)
+	if state.Paused {
+		paused = 1
+	}
+	for _, topic := range c.topics {
+		c.metrics.ConsumerPaused.Record(ctx, paused, c.metricAttrs(topic))
+		c.metrics.ConsumerRateLimit.Record(ctx, state.RateLimit, c.metricAttrs(topic))
+	}
+}
+
+func (c *Consumer) watchHealth(ctx context.Context, hc healthCheck) {
+	ticker := time.NewTicker(hc.interval)
+	defer ticker.Stop()
+
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, hc.interval)
+		err := hc.check(checkCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			reason := "health check " + hc.name + " failed: " + err.Error()
+			c.transition(reason, func(f *flowControl) { f.unhealthy[hc.name] = reason })
+		} else {
+			c.transition("health check "+hc.name+" passed", func(f *flowControl) {
+				delete(f.unhealthy, hc.name)
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// flowControl pauses and throttles fetching with a token bucket.
+type flowControl struct {
+	mu      sync.Mutex
+	changed chan struct{}
+
+	paused      bool
+	pauseReason string
+	unhealthy   map[string]string
+
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+func newFlowControl() *flowControl {
+	return &flowControl{changed: make(chan struct{}), unhealthy: make(map[string]string)}
+}
+
+func (f *flowControl) setRate(perSecond float64, burst int) {
+	f.rate = max(perSecond, 0)
+	f.burst = max(burst, 1)
+	f.tokens = float64(f.burst)
+	f.last = time.Now()
+}
+
+func (f *flowControl) update(change func(*flowControl)) (before, after FlowState) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	before = f.stateLocked()
+	change(f)
+	after = f.stateLocked()
+
+	close(f.changed)
+	f.changed = make(chan struct{})
+	return before, after
+}
+
+func (f *flowControl) state() FlowState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stateLocked()
+}
+
+func (f *flowControl) stateLocked() FlowState {
+	var reasons []string
+	if f.paused {
+		reasons = append(reasons, f.pauseReason)
+	}
+	for _, name := range slices.Sorted(maps.Keys(f.unhealthy)) {
+		reasons = append(reasons, f.unhealthy[name])
+	}
+
+	s := FlowState{
+		Paused:      len(reasons) > 0,
+		PauseReason: strings.Join(reasons, "; "),
+		RateLimit:   f.rate,
+	}
+	if f.rate > 0 {
+		s.Burst = f.burst
+	}
+	return s
+}
+
+func (f *flowControl) wait(ctx context.Context) error {
+	for {
+		f.mu.Lock()
+		changed := f.changed
+
+		var delay time.Duration
+		switch {
+		case f.paused || len(f.unhealthy) > 0:
+			delay = -1
+		case f.rate <= 0:
+			f.mu.Unlock()
+			return nil
+		default:
+			now := time.Now()
+			f.tokens = min(float64(f.burst), f.tokens+now.Sub(f.last).Seconds()*f.rate)
+			f.last = now
+			if f.tokens >= 1 {
+				f.tokens--
+				f.mu.Unlock()
+				return nil
+			}
+			delay = time.Duration((1 - f.tokens) / f.rate * float64(time.Second))
+		}
+		f.mu.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if delay >= 0 {
+			timer = time.NewTimer(delay)
+			timeout = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// waitAsync starts f.wait and returns a channel that receives its result.
+func waitAsync(ctx context.Context, f *flowControl) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- f.wait(ctx) }()
+	return done
+}
+
+func assertBlocked(t *testing.T, done <-chan error) {
+	t.Helper()
+	select {
+	case err := <-done:
+		t.Fatalf("wait returned %v while paused", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func assertReturned(t *testing.T, done <-chan error) {
+	t.Helper()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("wait still blocked")
+	}
+}
+
+func TestPauseBlocksFetchUntilResume(t *testing.T) {
+	metrics, reader := withTestMetrics(t)
+	c, _ := newTestConsumer(t, metrics)
+	core, logs := observer.New(zap.InfoLevel)
+	c.log = zap.New(core)
+
+	c.Pause("maintenance")
+	if s := c.FlowState(); !s.Paused || s.PauseReason != "maintenance" {
+		t.Errorf("FlowState = %+v, want paused for maintenance", s)
+	}
+	if g, _ := collect(t, reader, "consumer_paused").(metricdata.Gauge[int64]); len(g.DataPoints) != 1 || g.DataPoints[0].Value != 1 {
+		t.Errorf("consumer_paused = %+v, want 1", g.DataPoints)
+	}
+
+	done := waitAsync(t.Context(), c.flow)
+	assertBlocked(t, done)
+
+	c.Resume("done")
+	assertReturned(t, done)
+	if s := c.FlowState(); s.Paused || s.PauseReason != "" {
+		t.Errorf("FlowState = %+v, want resumed", s)
+	}
+	if g, _ := collect(t, reader, "consumer_paused").(metricdata.Gauge[int64]); len(g.DataPoints) != 1 || g.DataPoints[0].Value != 0 {
+		t.Errorf("consumer_paused = %+v, want 0", g.DataPoints)
+	}
+
+	// Resuming again changes nothing and is not logged.
+	c.Resume("again")
+	if n := logs.FilterMessage("consumer paused").Len(); n != 1 {
+		t.Errorf("%d pause logs, want 1", n)
+	}
+	if n := logs.FilterMessage("consumer resumed").Len(); n != 1 {
+		t.Errorf("%d resume logs, want 1", n)
+	}
+}
+
+func TestPauseIsCancelledWithContext(t *testing.T) {
+	c, _ := newTestConsumer(t)
+	c.Pause("maintenance")
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := waitAsync(ctx, c.flow)
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("wait = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("wait ignored the cancelled context")
+	}
+}
+
+func TestHealthCheckPausesConsumer(t *testing.T) {
+	var healthy atomic.Bool
+	c, _ := newTestConsumer(t, WithHealthCheck("payments-api", 5*time.Millisecond, func(context.Context) error {
+		if healthy.Load() {
+			return nil
+		}
+		return errors.New("connection refused")
+	}))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go c.watchHealth(ctx, c.healthChecks[0])
+
+	eventually(t, func() bool { return c.FlowState().Paused })
+	if s := c.FlowState(); s.PauseReason != "health check payments-api failed: connection refused" {
+		t.Errorf("pause reason = %q", s.PauseReason)
+	}
+
+	// A manual resume does not override a failing check, and both reasons
+	// are reported.
+	c.Pause("maintenance")
+	c.Resume("operator")
+	if !c.FlowState().Paused {
+		t.Error("resumed while the health check fails")
+	}
+	c.Pause("maintenance")
+	if s := c.FlowState(); s.PauseReason != "maintenance; health check payments-api failed: connection refused" {
+		t.Errorf("pause reason = %q, want both reasons", s.PauseReason)
+	}
+	c.Resume("operator")
+
+	done := waitAsync(t.Context(), c.flow)
+	assertBlocked(t, done)
+	healthy.Store(true)
+	assertReturned(t, done)
+	if c.FlowState().Paused {
+		t.Error("still paused after the health check passed")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	c, _ := newTestConsumer(t, WithRateLimit(20, 2))
+	if s := c.FlowState(); s.RateLimit != 20 || s.Burst != 2 {
+		t.Errorf("FlowState = %+v, want 20/s in bursts of 2", s)
+	}
+
+	start := time.Now()
+	for range 3 {
+		if err := c.flow.wait(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The burst is free, the third token takes 1/20s.
+	if waited := time.Since(start); waited < 40*time.Millisecond {
+		t.Errorf("3 fetches took %v, want at least 50ms", waited)
+	}
+
+	c.SetRateLimit(0, 0, "unthrottled")
+	if s := c.FlowState(); s.RateLimit != 0 || s.Burst != 0 {
+		t.Errorf("FlowState = %+v, want no rate limit", s)
+	}
+	start = time.Now()
+	for range 100 {
+		if err := c.flow.wait(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if waited := time.Since(start); waited > 100*time.Millisecond {
+		t.Errorf("100 unthrottled fetches took %v", waited)
+	}
+}
+
+func TestRateLimitChangeWakesBlockedFetch(t *testing.T) {
+	c, _ := newTestConsumer(t, WithRateLimit(0.01, 1))
+	if err := c.flow.wait(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	done := waitAsync(t.Context(), c.flow)
+	assertBlocked(t, done)
+	c.SetRateLimit(1000, 1, "catch up")
+	assertReturned(t, done)
+}
+
+func TestRetryTiersShareFlowControl(t *testing.T) {
+	c := newRoutingConsumer(t, WithRetryTiers(time.Second))
+	c.Pause("maintenance")
+	if !c.retryTiers[0].FlowState().Paused {
+		t.Error("retry tier keeps fetching while its consumer is paused")
+	}
+}
+
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 1s")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,85 @@
+package kafka
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Header is a Kafka record header.
+type Header = kafka.Header
+
+type Message struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   []kafka.Header
+	Time      time.Time
+	GroupID   string
+	ClientID  string
+	Envelope  Envelope
+
+	originGroupID string
+
+	codec  Codec
+	codecs map[string]Codec
+}
+
+func (c *Consumer) message(msg kafka.Message) Message {
+	return Message{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Headers:   msg.Headers,
+		Time:      msg.Time,
+		GroupID:   c.groupID,
+		ClientID:  c.clientID,
+		Envelope:  ParseEnvelope(msg.Headers),
+
+		originGroupID: c.originGroupID,
+		codec:         c.codec,
+		codecs:        c.codecs,
+	}
+}
+
+func (m Message) Header(key string) string {
+	return headerValue(m.Headers, key)
+}
+
+// OriginTopic returns the topic the message was first consumed from.
+func (m Message) OriginTopic() string {
+	if origin := m.Header(HeaderRetryOriginTopic); origin != "" {
+		return origin
+	}
+	return m.Topic
+}
+
+// OriginGroupID returns the group the message was first consumed by.
+func (m Message) OriginGroupID() string {
+	if m.originGroupID != "" {
+		return m.originGroupID
+	}
+	return m.GroupID
+}
+
+// ProducedAt returns HeaderProducedAt, or else the Kafka timestamp.
+func (m Message) ProducedAt() time.Time {
+	if ms, err := strconv.ParseInt(m.Header(HeaderProducedAt), 10, 64); err == nil {
+		return time.UnixMilli(ms)
+	}
+	return m.Time
+}
+
+// QueueDuration returns how long the message waited in Kafka.
+func (m Message) QueueDuration(receivedAt time.Time) time.Duration {
+	produced := m.ProducedAt()
+	if produced.IsZero() {
+		return 0
+	}
+	return max(receivedAt.Sub(produced), 0)
+}
@@ -0,0 +1,122 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestQueueDuration(t *testing.T) {
+	produced := time.UnixMilli(1700000000000)
+	stamped := []kafka.Header{{Key: HeaderProducedAt, Value: []byte(strconv.FormatInt(produced.UnixMilli(), 10))}}
+
+	for _, tt := range []struct {
+		name     string
+		msg      Message
+		received time.Time
+		want     time.Duration
+	}{
+		{"header", Message{Headers: stamped, Time: produced.Add(time.Hour)}, produced.Add(3 * time.Second), 3 * time.Second},
+		{"kafka timestamp", Message{Time: produced}, produced.Add(time.Second), time.Second},
+		{"malformed header", Message{Headers: []kafka.Header{{Key: HeaderProducedAt, Value: []byte("now")}}, Time: produced}, produced.Add(time.Second), time.Second},
+		{"clock skew", Message{Headers: stamped}, produced.Add(-time.Second), 0},
+		{"unknown", Message{}, produced, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.msg.QueueDuration(tt.received); got != tt.want {
+				t.Errorf("QueueDuration = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublishStampsProducedAt(t *testing.T) {
+	p := newCapturingProducer(t)
+	before := time.Now().Truncate(time.Millisecond)
+	if err := p.Publish(t.Context(), "o-1", testOrder); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := published(t, p)[0]
+	if n := headerCount(msg.Headers, HeaderProducedAt); n != 1 {
+		t.Fatalf("%d %s headers, want 1", n, HeaderProducedAt)
+	}
+	if at := (Message{Headers: msg.Headers}).ProducedAt(); at.Before(before) || at.After(time.Now()) {
+		t.Errorf("produced at %v, want the time of the publish", at)
+	}
+}
+
+func TestReceiveRecordsQueueDuration(t *testing.T) {
+	testMetricReader()
+	c, spans := newTestConsumer(t)
+	before := queueDurationPoint(t, "orders", 4)
+
+	msg := kafka.Message{
+		Topic: "orders", Partition: 4, Offset: 1,
+		Headers: []kafka.Header{{Key: HeaderProducedAt, Value: []byte(strconv.FormatInt(time.Now().Add(-2*time.Second).UnixMilli(), 10))}},
+	}
+	start := time.Now()
+	ctx := c.traceReceive(msg, start)
+	c.recordReceive(ctx, start, msg)
+
+	ended := spans.Ended()
+	if len(ended) != 1 {
+		t.Fatalf("ended spans = %v, want the receive span", spanNames(ended))
+	}
+	var spanDuration float64
+	for _, a := range ended[0].Attributes() {
+		if a.Key == "messaging.queue.duration" {
+			spanDuration = a.Value.AsFloat64()
+		}
+	}
+	if spanDuration < 2 || spanDuration > 3 {
+		t.Errorf("messaging.queue.duration span attribute = %v, want about 2s", spanDuration)
+	}
+
+	after := queueDurationPoint(t, "orders", 4)
+	if n, sum := after.Count-before.Count, after.Sum-before.Sum; n != 1 || sum < 2 || sum > 3 {
+		t.Errorf("queue duration histogram got %d values summing %v, want one of about 2s", n, sum)
+	}
+	if len(after.Exemplars) != 1 || len(after.Exemplars[0].TraceID) != 16 ||
+		trace.TraceID(after.Exemplars[0].TraceID) != ended[0].SpanContext().TraceID() {
+		t.Errorf("exemplars = %+v, want one in the trace of the receive span", after.Exemplars)
+	}
+}
+
+// queueDurationPoint returns the messaging.queue.duration histogram of a
+// topic partition.
+func queueDurationPoint(t *testing.T, topic string, partition int) metricdata.HistogramDataPoint[float64] {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := testMetricReader().Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	want := attribute.NewSet(
+		semconv.MessagingDestinationName(topic),
+		semconv.MessagingDestinationPartitionID(strconv.Itoa(partition)),
+		semconv.MessagingKafkaConsumerGroup("test-group"),
+		semconv.MessagingSystemKafka,
+	)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			h, ok := m.Data.(metricdata.Histogram[float64])
+			if m.Name != "messaging.queue.duration" || !ok {
+				continue
+			}
+			for _, p := range h.DataPoints {
+				if p.Attributes.Equals(&want) {
+					return p
+				}
+			}
+		}
+	}
+	return metricdata.HistogramDataPoint[float64]{}
+}
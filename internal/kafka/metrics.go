@@ -0,0 +1,178 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type messagingInstruments struct {
+	sent, consumed                     metric.Int64Counter
+	operationDuration, processDuration metric.Float64Histogram
+	queueDuration                      metric.Float64Histogram
+}
+
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10}
+
+var messagingInstrumentsOnce = sync.OnceValues(func() (*messagingInstruments, error) {
+	meter := otel.Meter("kafka")
+	errs := make([]error, 5)
+	i := &messagingInstruments{}
+
+	i.sent, errs[0] = meter.Int64Counter("messaging.client.sent.messages",
+		metric.WithDescription("Messages the producer attempted to send to the broker"),
+		metric.WithUnit("{message}"),
+	)
+	i.consumed, errs[1] = meter.Int64Counter("messaging.client.consumed.messages",
+		metric.WithDescription("Messages delivered to the consumer"),
+		metric.WithUnit("{message}"),
+	)
+	i.operationDuration, errs[2] = meter.Float64Histogram("messaging.client.operation.duration",
+		metric.WithDescription("Duration of publish, receive and commit operations"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...),
+	)
+	i.processDuration, errs[3] = meter.Float64Histogram("messaging.process.duration",
+		metric.WithDescription("Duration of message handlers"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...),
+	)
+	i.queueDuration, errs[4] = meter.Float64Histogram("messaging.queue.duration",
+		metric.WithDescription("Time messages spent in Kafka between publish and receive"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...),
+	)
+	return i, errors.Join(errs...)
+})
+
+func messagingInstrumentsOrNil() *messagingInstruments {
+	i, err := messagingInstrumentsOnce()
+	if err != nil {
+		otel.Handle(err)
+		return nil
+	}
+	return i
+}
+
+func (p *Producer) recordPublish(ctx context.Context, start time.Time, messages, partition int, err error, extra ...attribute.KeyValue) {
+	i := messagingInstrumentsOrNil()
+	if i == nil {
+		return
+	}
+	extra = append([]attribute.KeyValue{
+		semconv.MessagingDestinationName(p.topic),
+		semconv.MessagingOperationTypePublish,
+	}, extra...)
+	if partition >= 0 {
+		extra = append(extra, semconv.MessagingDestinationPartitionID(strconv.Itoa(partition)))
+	}
+	attrs := metric.WithAttributes(operationAttrs("publish", err, extra...)...)
+	i.sent.Add(ctx, int64(messages), attrs)
+	i.operationDuration.Record(ctx, time.Since(start).Seconds(), attrs)
+}
+
+func (c *Consumer) recordReceive(ctx context.Context, start time.Time, msg kafka.Message) {
+	i := messagingInstrumentsOrNil()
+	if i == nil {
+		return
+	}
+	now := time.Now()
+	attrs := metric.WithAttributes(operationAttrs("receive", nil,
+		append(c.partitionAttrs(msg), semconv.MessagingOperationTypeReceive)...,
+	)...)
+	i.consumed.Add(ctx, 1, attrs)
+	i.operationDuration.Record(ctx, now.Sub(start).Seconds(), attrs)
+	i.queueDuration.Record(ctx, c.message(msg).QueueDuration(now).Seconds(), metric.WithAttributes(
+		append(c.partitionAttrs(msg), semconv.MessagingSystemKafka)...,
+	))
+}
+
+func (c *Consumer) recordProcess(ctx context.Context, start time.Time, msg kafka.Message, err error) {
+	i := messagingInstrumentsOrNil()
+	if i == nil {
+		return
+	}
+	i.processDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(operationAttrs("process", err,
+		append(c.partitionAttrs(msg), semconv.MessagingOperationTypeDeliver)...,
+	)...))
+}
+
+func (c *Consumer) recordBatchProcess(ctx context.Context, start time.Time, batch []kafka.Message, err error) {
+	i := messagingInstrumentsOrNil()
+	if i == nil {
+		return
+	}
+	_, attrs := c.destination(messageTopics(batch)...)
+	i.processDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(operationAttrs("process", err,
+		append(attrs,
+			semconv.MessagingKafkaConsumerGroup(c.groupID),
+			semconv.MessagingOperationTypeDeliver,
+		)...,
+	)...))
+}
+
+func (c *Consumer) recordCommit(ctx context.Context, start time.Time, msgs []kafka.Message, err error) {
+	i := messagingInstrumentsOrNil()
+	if i == nil {
+		return
+	}
+	_, attrs := c.destination(messageTopics(msgs)...)
+	attrs = append(attrs, semconv.MessagingKafkaConsumerGroup(c.groupID))
+	if len(msgs) == 1 {
+		attrs = c.partitionAttrs(msgs[0])
+	}
+	i.operationDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(operationAttrs("commit", err,
+		append(attrs, semconv.MessagingOperationTypeSettle)...,
+	)...))
+}
+
+func (c *Consumer) partitionAttrs(msg kafka.Message) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.MessagingDestinationName(msg.Topic),
+		semconv.MessagingDestinationPartitionID(strconv.Itoa(msg.Partition)),
+		semconv.MessagingKafkaConsumerGroup(c.groupID),
+	}
+}
+
+func operationAttrs(op string, err error, attrs ...attribute.KeyValue) []attribute.KeyValue {
+	attrs = append(attrs, semconv.MessagingSystemKafka, semconv.MessagingOperationName(op))
+	if err != nil {
+		attrs = append(attrs, semconv.ErrorTypeKey.String(errorType(err)))
+	}
+	return attrs
+}
+
+// errorType maps err to a low-cardinality error.type value.
+func errorType(err error) string {
+	var panicErr *PanicError
+	var kafkaErr kafka.Error
+	var writeErrs kafka.WriteErrors
+	switch {
+	case errors.As(err, &panicErr):
+		return "panic"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, ErrNoHandler):
+		return "no_handler"
+	case errors.As(err, &kafkaErr):
+		return kafkaErr.Title()
+	case errors.As(err, &writeErrs):
+		for _, err := range writeErrs {
+			if err != nil {
+				return errorType(err)
+			}
+		}
+	}
+	return "_OTHER"
+}
@@ -0,0 +1,147 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// histogramCount adds up the counts of the float64 histogram name whose
+// attributes match.
+func histogramCount(t *testing.T, name string, match func(attribute.Set) bool) uint64 {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := testMetricReader().Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	var n uint64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			h, ok := m.Data.(metricdata.Histogram[float64])
+			if m.Name != name || !ok {
+				continue
+			}
+			for _, p := range h.DataPoints {
+				if match(p.Attributes) {
+					n += p.Count
+				}
+			}
+		}
+	}
+	return n
+}
+
+// operation matches the data points of op on the orders topic that failed
+// with errType, or succeeded when it is empty.
+func operation(op, errType string) func(attribute.Set) bool {
+	return func(a attribute.Set) bool {
+		topic, _ := a.Value(semconv.MessagingDestinationNameKey)
+		name, _ := a.Value(semconv.MessagingOperationNameKey)
+		got, _ := a.Value(semconv.ErrorTypeKey)
+		return topic.AsString() == "orders" && name.AsString() == op && got.AsString() == errType
+	}
+}
+
+func TestErrorType(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want string
+	}{
+		{&PanicError{Value: "boom"}, "panic"},
+		{fmt.Errorf("handler: %w", context.DeadlineExceeded), "timeout"},
+		{context.Canceled, "canceled"},
+		{fmt.Errorf("%w for topic refunds", ErrNoHandler), "no_handler"},
+		{fmt.Errorf("failed to write: %w", kafka.MessageSizeTooLarge), kafka.MessageSizeTooLarge.Title()},
+		{kafka.WriteErrors{nil, kafka.MessageSizeTooLarge}, kafka.MessageSizeTooLarge.Title()},
+		{kafka.WriteErrors{nil}, "_OTHER"},
+		{errors.New("boom"), "_OTHER"},
+	} {
+		if got := errorType(tt.err); got != tt.want {
+			t.Errorf("errorType(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestPublishRecordsSentMessages(t *testing.T) {
+	testMetricReader()
+	b := newFakeBroker(3)
+	p := newAsyncProducer(t, b)
+	p.writer.BatchTimeout = time.Millisecond
+	async := newAsyncProducer(t, b, WithAsync(10, 10, time.Millisecond))
+
+	// sent counts the publishes that failed with errType, or succeeded when
+	// it is empty, to partition, or to no known partition when it is empty.
+	sent := func(errType, partition string) int64 {
+		n, _ := metricSum(t, "messaging.client.sent.messages", func(a attribute.Set) bool {
+			got, _ := a.Value(semconv.MessagingDestinationPartitionIDKey)
+			return operation("publish", errType)(a) && got.AsString() == partition
+		})
+		return n
+	}
+	before := make(map[string]int64)
+	for _, partition := range []string{"", "0", "1", "2"} {
+		before[partition] = sent("", partition)
+	}
+	tooLarge := sent(kafka.MessageSizeTooLarge.Title(), "")
+
+	if err := p.Publish(t.Context(), "o-1", testOrder); err != nil {
+		t.Fatal(err)
+	}
+	if err := await(func(done DeliveryFunc) error { return async.PublishAsync(t.Context(), "o-2", testOrder, done) }); err != nil {
+		t.Fatal(err)
+	}
+	b.fail = kafka.MessageSizeTooLarge
+	if err := p.Publish(t.Context(), "o-3", testOrder); err == nil {
+		t.Fatal("Publish succeeded against a failing broker")
+	}
+
+	want := map[string]int64{"": 0}
+	for _, msg := range b.received() {
+		want[strconv.Itoa(msg.Partition)]++
+	}
+	for _, partition := range []string{"", "0", "1", "2"} {
+		if n := sent("", partition) - before[partition]; n != want[partition] {
+			t.Errorf("%d messages sent to partition %q, want %d", n, partition, want[partition])
+		}
+	}
+	if n := sent(kafka.MessageSizeTooLarge.Title(), "") - tooLarge; n != 1 {
+		t.Errorf("%d messages failed with %s, want 1 without a partition", n, kafka.MessageSizeTooLarge.Title())
+	}
+	if n := histogramCount(t, "messaging.client.operation.duration", operation("publish", "")); n == 0 {
+		t.Error("publish duration not recorded")
+	}
+}
+
+func TestProcessDurationByOutcome(t *testing.T) {
+	testMetricReader()
+	c, _ := newTestConsumer(t)
+	processed := func(errType string) uint64 {
+		return histogramCount(t, "messaging.process.duration", operation("process", errType))
+	}
+	ok, other, panicked := processed(""), processed("_OTHER"), processed("panic")
+
+	msg := kafka.Message{Topic: "orders", Partition: 3, Offset: 1}
+	for _, handler := range []HandlerFunc{
+		func(context.Context, Message) error { return nil },
+		failing("boom"),
+		func(context.Context, Message) error { panic("boom") },
+	} {
+		if _, err := c.handle(t.Context(), msg, handler); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := [3]uint64{processed("") - ok, processed("_OTHER") - other, processed("panic") - panicked}; got != [3]uint64{1, 1, 1} {
+		t.Errorf("process durations (ok, _OTHER, panic) = %v, want one each", got)
+	}
+}
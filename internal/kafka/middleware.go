@@ -0,0 +1,155 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"kafka-go-study/internal/telemetry"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+type Middleware func(HandlerFunc) HandlerFunc
+
+// Chain wraps h with mw so that mw[0] is the outermost middleware.
+func Chain(h HandlerFunc, mw ...Middleware) HandlerFunc {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// WithMiddleware replaces the default middleware chain with mw.
+func WithMiddleware(mw ...Middleware) ConsumerOption {
+	return func(c *Consumer) { c.middleware = mw }
+}
+
+// DefaultMiddleware traces messages and recovers panics.
+func DefaultMiddleware() []Middleware {
+	return []Middleware{Tracing(), Recover()}
+}
+
+// Tracing starts a process span per message.
+func Tracing() Middleware {
+	tracer := otel.Tracer("kafka/consumer")
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg Message) error {
+			ctx, span := tracer.Start(ctx, fmt.Sprintf("process %s", msg.Topic),
+				trace.WithSpanKind(trace.SpanKindConsumer),
+				trace.WithLinks(append(processLinks(ctx), retryOriginLinks(msg.Headers)...)...),
+				trace.WithAttributes(messageAttrs(msg)...),
+				trace.WithAttributes(
+					semconv.MessagingOperationTypeDeliver,
+					semconv.MessagingOperationName("process"),
+				),
+				trace.WithAttributes(processAttrs(ctx)...),
+			)
+			defer span.End()
+
+			if msg.Header(HeaderRetryAttempt) != "" {
+				span.SetAttributes(attribute.Int("messaging.kafka.retry.attempt", attempts(msg.Headers)))
+			}
+
+			if err := next(ctx, msg); err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				return err
+			}
+
+			span.SetStatus(codes.Ok, "")
+			return nil
+		}
+	}
+}
+
+// SpanAttributes adds attrs to the span of every handled message.
+func SpanAttributes(attrs ...attribute.KeyValue) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg Message) error {
+			trace.SpanFromContext(ctx).SetAttributes(attrs...)
+			return next(ctx, msg)
+		}
+	}
+}
+
+// Metrics counts handled messages and records how long handlers take.
+func Metrics(m *telemetry.Metrics) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg Message) error {
+			start := time.Now()
+			err := next(ctx, msg)
+
+			status := "ok"
+			if err != nil {
+				status = "error"
+			}
+			attrs := metric.WithAttributes(
+				attribute.String("topic", msg.Topic),
+				attribute.String("consumer_group", msg.GroupID),
+				attribute.String("status", status),
+			)
+			m.MessagesConsumed.Add(ctx, 1, attrs)
+			m.ProcessingTime.Record(ctx, time.Since(start).Seconds(), attrs)
+
+			return err
+		}
+	}
+}
+
+// Logging logs the outcome of every handled message.
+func Logging(log *zap.Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg Message) error {
+			start := time.Now()
+			err := next(ctx, msg)
+
+			fields := []zap.Field{
+				zap.String("topic", msg.Topic),
+				zap.Int("partition", msg.Partition),
+				zap.Int64("offset", msg.Offset),
+				zap.String("key", string(msg.Key)),
+				zap.String("consumer_group", msg.GroupID),
+				zap.Duration("duration", time.Since(start)),
+			}
+			fields = append(fields, msg.Envelope.fields()...)
+			if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+				fields = append(fields, zap.String("trace_id", sc.TraceID().String()))
+			}
+
+			if err != nil {
+				log.Error("failed to handle message", append(fields, zap.Error(err))...)
+				return err
+			}
+			log.Debug("message handled", fields...)
+			return nil
+		}
+	}
+}
+
+// Recover turns a panicking handler into a PanicError.
+func Recover() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg Message) (err error) {
+			defer recoverPanic(ctx, &err)
+			return next(ctx, msg)
+		}
+	}
+}
+
+// Timeout cancels the handler context after d.
+func Timeout(d time.Duration) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg Message) error {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+			return next(ctx, msg)
+		}
+	}
+}
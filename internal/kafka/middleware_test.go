@@ -0,0 +1,91 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	mark := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx context.Context, msg Message) error {
+				calls = append(calls, name+" in")
+				err := next(ctx, msg)
+				calls = append(calls, name+" out")
+				return err
+			}
+		}
+	}
+	h := Chain(func(context.Context, Message) error {
+		calls = append(calls, "handler")
+		return nil
+	}, mark("a"), mark("b"))
+
+	if err := h(context.Background(), Message{}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a in", "b in", "handler", "b out", "a out"}
+	if !slices.Equal(calls, want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestDefaultMiddlewareRecordsPanicOnProcessSpan(t *testing.T) {
+	spans := useGlobalTracer(t)
+	c, _ := newTestConsumer(t)
+	msg := kafka.Message{Topic: "orders", Offset: 1}
+
+	handler := Chain(func(context.Context, Message) error { panic("boom") }, DefaultMiddleware()...)
+	err := c.runHandler(c.handlerContext(context.Background(), msg), handler, msg)
+
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || panicErr.Value != "boom" {
+		t.Fatalf("err = %v, want PanicError(boom)", err)
+	}
+
+	var process []string
+	for _, s := range spans.Ended() {
+		if s.Name() != "process orders" {
+			continue
+		}
+		process = append(process, s.Name())
+		if s.Status().Code != codes.Error {
+			t.Errorf("process span status = %v, want Error", s.Status())
+		}
+		stack := ""
+		for _, e := range s.Events() {
+			for _, a := range e.Attributes {
+				if a.Key == semconv.ExceptionStacktraceKey {
+					stack = a.Value.AsString()
+				}
+			}
+		}
+		if !strings.Contains(stack, "TestDefaultMiddlewareRecordsPanicOnProcessSpan") {
+			t.Errorf("process span has no stack trace of the panic: %q", stack)
+		}
+	}
+	if len(process) != 1 {
+		t.Fatalf("got %d process spans, want 1", len(process))
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	h := Chain(func(ctx context.Context, _ Message) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, Timeout(10*time.Millisecond))
+
+	if err := h(context.Background(), Message{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+}
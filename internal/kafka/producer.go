@@ -2,83 +2,315 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"kafka-go-study/internal/telemetry"
+	"slices"
+	"strconv"
+	"sync"
 	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/propagation"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/segmentio/kafka-go"
 )
 
+// HeaderProducedAt is the publish time in Unix milliseconds.
+const HeaderProducedAt = "x-produced-at"
+
 type Producer struct {
 	writer *kafka.Writer
 	topic  string
 	tracer trace.Tracer
+	stats  *writerStats
+	codec  Codec
+
+	cloudEvents       CloudEventsMode
+	cloudEventsSource string
+
+	// queue is nil unless the producer is asynchronous.
+	queue chan struct{}
+
+	spillDir      string
+	spillMaxBytes int64
+	spill         *spill
+	spillWriter   *kafka.Writer
+	spillStats    *writerStats
+	spillStop     context.CancelFunc
+	spillDone     chan struct{}
 }
 
-func NewProducer(brokers []string, topic string) *Producer {
+type ProducerOption func(*Producer)
+
+// ErrQueueFull is returned when the async queue is full.
+var ErrQueueFull = errors.New("producer queue is full")
+
+// DeliveryFunc receives the outcome of a publish.
+type DeliveryFunc func(err error)
+
+// WithAsync publishes in batches of up to batchSize messages or linger,
+// with at most queueSize messages waiting for the broker.
+func WithAsync(queueSize, batchSize int, linger time.Duration) ProducerOption {
+	return func(p *Producer) {
+		p.queue = make(chan struct{}, queueSize)
+		p.writer.Async = true
+		p.writer.BatchSize = batchSize
+		p.writer.BatchTimeout = linger
+	}
+}
+
+func NewProducer(brokers []string, topic string, opts ...ProducerOption) *Producer {
 	writer := &kafka.Writer{
 		Addr:         kafka.TCP(brokers...),
 		Topic:        topic,
-		Balancer:     &kafka.LeastBytes{},
+		Balancer:     kafka.Murmur2Balancer{},
 		WriteTimeout: 10 * time.Second,
 		ReadTimeout:  10 * time.Second,
 		RequiredAcks: kafka.RequireOne,
 	}
 
-	return &Producer{
+	p := &Producer{
 		writer: writer,
 		topic:  topic,
 		tracer: otel.Tracer("kafka/producer"),
+		codec:  JSON,
+	}
+	writer.Completion = p.completed
+	for _, opt := range opts {
+		opt(p)
 	}
+	p.openSpill()
+	p.registerStats()
+
+	return p
 }
 
+// Publish encodes value with the producer codec and waits for the broker.
 func (p *Producer) Publish(ctx context.Context, key string, value any) error {
-	ctx, span := p.tracer.Start(ctx, fmt.Sprintf("publish %s", p.topic),
+	return await(func(done DeliveryFunc) error { return p.PublishAsync(ctx, key, value, done) })
+}
+
+// PublishRaw writes an already encoded message with the trace context of ctx.
+func (p *Producer) PublishRaw(ctx context.Context, key, value []byte, headers []kafka.Header) error {
+	return await(func(done DeliveryFunc) error { return p.PublishRawAsync(ctx, key, value, headers, done) })
+}
+
+// PublishAsync queues the message and reports its outcome to done, which may
+// be nil.
+func (p *Producer) PublishAsync(ctx context.Context, key string, value any, done DeliveryFunc) error {
+	ctx, span := p.startSpan(ctx, key)
+
+	data, err := p.codec.Marshal(value)
+	if err != nil {
+		err = fmt.Errorf("failed to serialize message: %w", err)
+		endSpan(span, err)
+		return err
+	}
+
+	return p.send(ctx, span, kafka.Message{
+		Key:     []byte(key),
+		Value:   data,
+		Headers: NewEnvelope(ctx, value, p.codec).Headers(),
+	}, done)
+}
+
+// PublishRawAsync is the asynchronous PublishRaw.
+func (p *Producer) PublishRawAsync(ctx context.Context, key, value []byte, headers []kafka.Header, done DeliveryFunc) error {
+	ctx, span := p.startSpan(ctx, string(key))
+
+	return p.send(ctx, span, kafka.Message{
+		Key:     key,
+		Value:   value,
+		Headers: withoutHeaders(headers, otel.GetTextMapPropagator().Fields()...),
+	}, done)
+}
+
+func (p *Producer) startSpan(ctx context.Context, key string) (context.Context, trace.Span) {
+	return p.tracer.Start(ctx, fmt.Sprintf("publish %s", p.topic),
 		trace.WithSpanKind(trace.SpanKindProducer),
 		trace.WithAttributes(
 			semconv.MessagingSystemKafka,
 			semconv.MessagingDestinationName(p.topic),
+			semconv.MessagingOperationTypePublish,
+			semconv.MessagingOperationName("publish"),
 			attribute.String("messaging.kafka.message.key", key),
 		),
 	)
-	defer span.End()
+}
+
+type delivery struct {
+	ctx   context.Context
+	span  trace.Span
+	start time.Time
+	done  DeliveryFunc
+	// partition is -1 until the broker acknowledges the message.
+	partition int
+}
 
-	data, err := json.Marshal(value)
+func (p *Producer) send(ctx context.Context, span trace.Span, msg kafka.Message, done DeliveryFunc) error {
+	// ce_* headers are regenerated for the new trace context.
+	msg.Headers = withoutCloudEventHeaders(msg.Headers)
+	otel.GetTextMapPropagator().Inject(ctx, &kafkaHeaderCarrier{headers: &msg.Headers})
+	env := completeEnvelope(ctx, msg.Headers)
+	msg.Headers = append(withoutHeaders(msg.Headers, envelopeHeaders...), env.Headers()...)
+	span.SetAttributes(env.attrs()...)
+	if p.cloudEvents != 0 {
+		var err error
+		if msg, err = p.toCloudEvent(msg, env); err != nil {
+			err = fmt.Errorf("failed to encode cloudevent: %w", err)
+			endSpan(span, err)
+			return err
+		}
+	}
+	msg.Time = time.Now()
+	msg.Headers = append(withoutHeaders(msg.Headers, HeaderProducedAt),
+		kafka.Header{Key: HeaderProducedAt, Value: []byte(strconv.FormatInt(msg.Time.UnixMilli(), 10))},
+	)
+	span.SetAttributes(semconv.MessagingMessageBodySize(len(msg.Value)))
+	d := &delivery{ctx: ctx, span: span, start: msg.Time, done: done, partition: -1}
+
+	if p.spill != nil && p.spill.pending() {
+		p.spillMessage(d, msg, nil)
+		return nil
+	}
+
+	if p.queue == nil {
+		msg.WriterData = d
+		err := p.writer.WriteMessages(ctx, msg)
+		if err != nil && p.spill != nil && spillable(err) {
+			msg.WriterData = nil
+			p.spillMessage(d, msg, err)
+			return nil
+		}
+		p.deliver(d, err)
+		return nil
+	}
+
+	select {
+	case p.queue <- struct{}{}:
+	default:
+		p.stats.drop(1)
+		err := fmt.Errorf("failed to publish message: %w", ErrQueueFull)
+		p.recordPublish(ctx, d.start, 1, d.partition, err)
+		endSpan(span, err)
+		return err
+	}
+
+	msg.WriterData = d
+	if err := p.writer.WriteMessages(context.WithoutCancel(ctx), msg); err != nil {
+		<-p.queue
+		if p.spill != nil && spillable(err) {
+			msg.WriterData = nil
+			p.spillMessage(d, msg, err)
+			return nil
+		}
+		err = fmt.Errorf("failed to publish message: %w", err)
+		p.recordPublish(ctx, d.start, 1, d.partition, err)
+		endSpan(span, err)
+		return err
+	}
+	return nil
+}
+
+// completed records the partition of acknowledged messages and delivers
+// async ones.
+func (p *Producer) completed(msgs []kafka.Message, err error) {
+	for _, msg := range msgs {
+		d, ok := msg.WriterData.(*delivery)
+		if !ok {
+			continue
+		}
+		if err == nil {
+			d.partition = msg.Partition
+		}
+		if p.queue == nil {
+			continue
+		}
+		<-p.queue
+		if err != nil && p.spill != nil && spillable(err) {
+			msg.WriterData = nil
+			p.spillMessage(d, msg, err)
+			continue
+		}
+		p.deliver(d, err)
+	}
+}
+
+func (p *Producer) deliver(d *delivery, err error) {
 	if err != nil {
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
-		return fmt.Errorf("failed to serialize message: %w", err)
+		err = fmt.Errorf("failed to publish message: %w", err)
 	}
+	p.recordPublish(d.ctx, d.start, 1, d.partition, err)
+	d.settle(err)
+}
 
-	headers := make([]kafka.Header, 0)
-	otel.GetTextMapPropagator().Inject(ctx, &kafkaHeaderCarrier{headers: &headers})
+func (d *delivery) settle(err error) {
+	endSpan(d.span, err)
+	if d.done != nil {
+		d.done(err)
+	}
+}
 
-	msg := kafka.Message{
-		Key:     []byte(key),
-		Value:   data,
-		Time:    time.Now(),
-		Headers: headers,
+func await(publish func(done DeliveryFunc) error) error {
+	result := make(chan error, 1)
+	if err := publish(func(err error) { result <- err }); err != nil {
+		return err
 	}
+	return <-result
+}
 
-	if err := p.writer.WriteMessages(ctx, msg); err != nil {
+func endSpan(span trace.Span, err error) {
+	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
-		return fmt.Errorf("failed to publish message: %w", err)
+	} else {
+		span.SetStatus(codes.Ok, "")
 	}
-
-	span.SetStatus(codes.Ok, "")
-	return nil
+	span.End()
 }
 
 func (p *Producer) Close() error {
-	return p.writer.Close()
+	p.stats.unregister()
+	p.spillStats.unregister()
+	return errors.Join(p.writer.Close(), p.closeSpill())
+}
+
+// producerPool creates one producer per destination topic.
+type producerPool struct {
+	brokers []string
+
+	mu        sync.Mutex
+	producers map[string]*Producer
+}
+
+func newProducerPool(brokers []string) *producerPool {
+	return &producerPool{brokers: brokers, producers: make(map[string]*Producer)}
+}
+
+func (pp *producerPool) get(topic string) *Producer {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+
+	p, ok := pp.producers[topic]
+	if !ok {
+		p = NewProducer(pp.brokers, topic)
+		pp.producers[topic] = p
+	}
+	return p
+}
+
+func (pp *producerPool) close() {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+
+	for _, p := range pp.producers {
+		_ = p.Close()
+	}
+	clear(pp.producers)
 }
 
 type kafkaHeaderCarrier struct {
@@ -94,8 +326,9 @@ func (c *kafkaHeaderCarrier) Get(key string) string {
 	return ""
 }
 
+// Set replaces any existing headers named key.
 func (c *kafkaHeaderCarrier) Set(key, value string) {
-	*c.headers = append(*c.headers, kafka.Header{Key: key, Value: []byte(value)})
+	*c.headers = append(withoutHeaders(*c.headers, key), kafka.Header{Key: key, Value: []byte(value)})
 }
 
 func (c *kafkaHeaderCarrier) Keys() []string {
@@ -106,6 +339,20 @@ func (c *kafkaHeaderCarrier) Keys() []string {
 	return keys
 }
 
+func headerValue(headers []kafka.Header, key string) string {
+	return (&kafkaHeaderCarrier{headers: &headers}).Get(key)
+}
+
+func withoutHeaders(headers []kafka.Header, keys ...string) []kafka.Header {
+	out := make([]kafka.Header, 0, len(headers))
+	for _, h := range headers {
+		if !slices.Contains(keys, h.Key) {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
 func init() {
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+	otel.SetTextMapPropagator(telemetry.Propagator())
 }
@@ -0,0 +1,311 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol"
+	metadataAPI "github.com/segmentio/kafka-go/protocol/metadata"
+	produceAPI "github.com/segmentio/kafka-go/protocol/produce"
+)
+
+// newCapturingProducer returns a producer of a broker that is never reached.
+// Its messages are spilled, so published returns them as they would have
+// been written to Kafka.
+func newCapturingProducer(t *testing.T, opts ...ProducerOption) *Producer {
+	t.Helper()
+	p := NewProducer([]string{"127.0.0.1:1"}, "orders", append(opts, WithSpill(t.TempDir(), 1<<20))...)
+	t.Cleanup(func() { _ = p.Close() })
+	p.tracer = sdktrace.NewTracerProvider().Tracer("test")
+	p.writer.MaxAttempts = 1
+	return p
+}
+
+// published returns the messages p has written so far.
+func published(t *testing.T, p *Producer) []kafka.Message {
+	t.Helper()
+	msgs, _, err := p.spill.next(1000)
+	if err != nil {
+		t.Fatalf("failed to read published messages: %v", err)
+	}
+	for i := range msgs {
+		msgs[i].Topic = p.topic
+	}
+	return msgs
+}
+
+func headerCount(headers []kafka.Header, key string) int {
+	n := 0
+	for _, h := range headers {
+		if h.Key == key {
+			n++
+		}
+	}
+	return n
+}
+
+// fakeBroker is a kafka.RoundTripper that answers metadata and produce
+// requests in memory, with every partition led by a single broker.
+type fakeBroker struct {
+	partitions int
+
+	mu       sync.Mutex
+	messages []kafka.Message
+	requests []int
+	// fail is the error code produce requests are answered with.
+	fail kafka.Error
+	// hold, when set, blocks produce requests until it is closed.
+	hold chan struct{}
+}
+
+func newFakeBroker(partitions int) *fakeBroker {
+	return &fakeBroker{partitions: partitions}
+}
+
+// connect makes the writers of p talk to b.
+func (b *fakeBroker) connect(p *Producer) {
+	p.writer.Transport = b
+	if p.spillWriter != nil {
+		p.spillWriter.Transport = b
+	}
+}
+
+func (b *fakeBroker) RoundTrip(ctx context.Context, _ net.Addr, req kafka.Request) (kafka.Response, error) {
+	switch req := req.(type) {
+	case *metadataAPI.Request:
+		res := &metadataAPI.Response{
+			Brokers: []metadataAPI.ResponseBroker{{NodeID: 1, Host: "127.0.0.1", Port: 9092}},
+		}
+		for _, name := range req.TopicNames {
+			topic := metadataAPI.ResponseTopic{Name: name}
+			for i := range b.partitions {
+				topic.Partitions = append(topic.Partitions, metadataAPI.ResponsePartition{
+					PartitionIndex: int32(i), LeaderID: 1, ReplicaNodes: []int32{1}, IsrNodes: []int32{1},
+				})
+			}
+			res.Topics = append(res.Topics, topic)
+		}
+		return res, nil
+
+	case *produceAPI.Request:
+		b.mu.Lock()
+		hold := b.hold
+		b.mu.Unlock()
+		if hold != nil {
+			select {
+			case <-hold:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		res := &produceAPI.Response{}
+		for _, t := range req.Topics {
+			rt := produceAPI.ResponseTopic{Topic: t.Topic}
+			for _, p := range t.Partitions {
+				n := 0
+				for {
+					r, err := p.RecordSet.Records.ReadRecord()
+					if errors.Is(err, io.EOF) {
+						break
+					}
+					if err != nil {
+						return nil, err
+					}
+					msg := kafka.Message{Topic: t.Topic, Partition: int(p.Partition), Time: r.Time}
+					msg.Key, _ = protocol.ReadAll(r.Key)
+					msg.Value, _ = protocol.ReadAll(r.Value)
+					for _, h := range r.Headers {
+						msg.Headers = append(msg.Headers, kafka.Header{Key: h.Key, Value: h.Value})
+					}
+					if b.fail == 0 {
+						b.messages = append(b.messages, msg)
+					}
+					n++
+				}
+				b.requests = append(b.requests, n)
+				rt.Partitions = append(rt.Partitions, produceAPI.ResponsePartition{
+					Partition: p.Partition,
+					ErrorCode: int16(b.fail),
+				})
+			}
+			res.Topics = append(res.Topics, rt)
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf("fake broker: unexpected %T", req)
+}
+
+// received returns the messages b has accepted so far.
+func (b *fakeBroker) received() []kafka.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.messages)
+}
+
+func (b *fakeBroker) produceRequests() []int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.requests)
+}
+
+func newAsyncProducer(t *testing.T, b *fakeBroker, opts ...ProducerOption) *Producer {
+	t.Helper()
+	p := NewProducer([]string{"127.0.0.1:1"}, "orders", opts...)
+	t.Cleanup(func() { _ = p.Close() })
+	p.tracer = sdktrace.NewTracerProvider().Tracer("test")
+	p.writer.MaxAttempts = 1
+	b.connect(p)
+	return p
+}
+
+func TestPublishAsyncBatches(t *testing.T) {
+	b := newFakeBroker(1)
+	p := newAsyncProducer(t, b, WithAsync(100, 10, 50*time.Millisecond))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 25)
+	for i := range 25 {
+		wg.Add(1)
+		err := p.PublishAsync(t.Context(), strconv.Itoa(i), testOrder, func(err error) {
+			errs <- err
+			wg.Done()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("delivery failed: %v", err)
+		}
+	}
+
+	msgs := b.received()
+	if len(msgs) != 25 {
+		t.Fatalf("broker received %d messages, want 25", len(msgs))
+	}
+	for i, msg := range msgs {
+		if string(msg.Key) != strconv.Itoa(i) {
+			t.Errorf("message %d has key %q, want them in order", i, msg.Key)
+			break
+		}
+	}
+	requests := b.produceRequests()
+	if len(requests) < 3 || slices.Max(requests) > 10 {
+		t.Errorf("produce requests of %v messages, want batches of up to 10", requests)
+	}
+	if len(p.queue) != 0 {
+		t.Errorf("%d messages still queued after delivery", len(p.queue))
+	}
+}
+
+func TestPublishAsyncQueueFull(t *testing.T) {
+	testMetricReader()
+	b := newFakeBroker(1)
+	b.hold = make(chan struct{})
+	p := newAsyncProducer(t, b, WithAsync(2, 1, time.Millisecond))
+	producerMetric := func(name string) int64 {
+		n, _ := metricSum(t, name, func(attrs attribute.Set) bool {
+			_, spill := attrs.Value("writer")
+			return attrs.HasValue("topic") && !spill
+		})
+		return n
+	}
+
+	delivered := make(chan error, 3)
+	done := func(err error) { delivered <- err }
+	for range 2 {
+		if err := p.PublishAsync(t.Context(), "o-1", testOrder, done); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.PublishAsync(t.Context(), "o-1", testOrder, done); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("PublishAsync = %v, want %v", err, ErrQueueFull)
+	}
+	if n := producerMetric("kafka_producer_queue_depth"); n != 2 {
+		t.Errorf("kafka_producer_queue_depth = %d, want 2", n)
+	}
+	if n := producerMetric("kafka_producer_dropped_total"); n != 1 {
+		t.Errorf("kafka_producer_dropped_total = %d, want 1", n)
+	}
+
+	b.mu.Lock()
+	close(b.hold)
+	b.hold = nil
+	b.mu.Unlock()
+	for range 2 {
+		if err := <-delivered; err != nil {
+			t.Errorf("delivery failed: %v", err)
+		}
+	}
+	select {
+	case err := <-delivered:
+		t.Errorf("rejected message was delivered with %v", err)
+	default:
+	}
+
+	if err := p.Publish(t.Context(), "o-1", testOrder); err != nil {
+		t.Errorf("Publish after the queue drained = %v", err)
+	}
+	if n := len(b.received()); n != 3 {
+		t.Errorf("broker received %d messages, want 3", n)
+	}
+}
+
+func TestPublishAsyncReportsBrokerErrors(t *testing.T) {
+	b := newFakeBroker(1)
+	b.fail = kafka.MessageSizeTooLarge
+	p := newAsyncProducer(t, b, WithAsync(10, 1, time.Millisecond))
+
+	delivered := make(chan error, 1)
+	if err := p.PublishAsync(t.Context(), "o-1", testOrder, func(err error) { delivered <- err }); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-delivered; !errors.Is(err, kafka.MessageSizeTooLarge) {
+		t.Errorf("delivery = %v, want %v", err, kafka.MessageSizeTooLarge)
+	}
+	if err := p.Publish(t.Context(), "o-1", testOrder); !errors.Is(err, kafka.MessageSizeTooLarge) {
+		t.Errorf("Publish = %v, want %v", err, kafka.MessageSizeTooLarge)
+	}
+}
+
+func TestPublishSync(t *testing.T) {
+	b := newFakeBroker(3)
+	p := newAsyncProducer(t, b)
+	// A lone message otherwise waits a second for its batch to fill.
+	p.writer.BatchTimeout = time.Millisecond
+
+	delivered := false
+	if err := p.PublishAsync(t.Context(), "o-1", testOrder, func(err error) { delivered = err == nil }); err != nil {
+		t.Fatal(err)
+	}
+	if !delivered {
+		t.Error("synchronous PublishAsync returned before delivery")
+	}
+
+	b.fail = kafka.MessageSizeTooLarge
+	var werrs kafka.WriteErrors
+	if err := p.Publish(t.Context(), "o-2", testOrder); !errors.As(err, &werrs) || !errors.Is(werrs[0], kafka.MessageSizeTooLarge) {
+		t.Errorf("Publish = %v, want %v", err, kafka.MessageSizeTooLarge)
+	}
+	if msgs := b.received(); len(msgs) != 1 || string(msgs[0].Key) != "o-1" {
+		t.Errorf("broker received %v, want o-1 only", msgs)
+	}
+}
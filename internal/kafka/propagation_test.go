@@ -0,0 +1,103 @@
+package kafka
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestHeaderCarrierSetReplacesHeaders(t *testing.T) {
+	headers := []kafka.Header{
+		{Key: "traceparent", Value: []byte("old-1")},
+		{Key: HeaderMessageID, Value: []byte("m-1")},
+		{Key: "traceparent", Value: []byte("old-2")},
+		{Key: "baggage", Value: []byte("customer_id=c-1")},
+	}
+	carrier := &kafkaHeaderCarrier{headers: &headers}
+	carrier.Set("traceparent", "new")
+
+	var values []string
+	for _, h := range headers {
+		if h.Key == "traceparent" {
+			values = append(values, string(h.Value))
+		}
+	}
+	if len(values) != 1 || values[0] != "new" {
+		t.Fatalf("traceparent headers = %v, want [new]", values)
+	}
+	if got := carrier.Get(HeaderMessageID); got != "m-1" {
+		t.Fatalf("%s = %q, other headers must be kept", HeaderMessageID, got)
+	}
+	if got := carrier.Get("baggage"); got != "customer_id=c-1" {
+		t.Fatalf("baggage = %q, other headers must be kept", got)
+	}
+	if len(headers) != 3 {
+		t.Fatalf("got %d headers, want 3", len(headers))
+	}
+}
+
+// TestTraceContextSurvivesKafkaAndHTTP follows the order-api → Kafka →
+// consumer → payment-api path: the trace and baggage of the request that
+// published the message reach the HTTP server the handler calls, even when
+// the message is republished with a stale context in its headers.
+func TestTraceContextSurvivesKafkaAndHTTP(t *testing.T) {
+	// order-api: the request span and the customer baggage.
+	member, _ := baggage.NewMember("customer_id", "c-42")
+	bag, _ := baggage.New(member)
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(baggage.ContextWithBaggage(context.Background(), bag), "POST /orders")
+	defer span.End()
+
+	p := newCapturingProducer(t)
+	stale := []kafka.Header{
+		{Key: "traceparent", Value: []byte("00-0000000000000000000000000000000a-000000000000000a-01")},
+		{Key: "baggage", Value: []byte("customer_id=stale")},
+	}
+	if err := p.PublishRaw(ctx, []byte("order-1"), []byte(`{}`), stale); err != nil {
+		t.Fatalf("PublishRaw: %v", err)
+	}
+	msg := published(t, p)[0]
+	for _, key := range []string{"traceparent", "baggage"} {
+		if n := headerCount(msg.Headers, key); n != 1 {
+			t.Fatalf("message has %d %s headers, want 1", n, key)
+		}
+	}
+
+	// consumer: the handler context, and the request the payment processor
+	// sends with it.
+	c, _ := newTestConsumer(t)
+	handlerCtx := c.handlerContext(context.Background(), msg)
+
+	var gotTrace trace.TraceID
+	var gotCustomer string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		gotTrace = trace.SpanContextFromContext(ctx).TraceID()
+		gotCustomer = baggage.FromContext(ctx).Member("customer_id").Value()
+	}))
+	defer srv.Close()
+
+	req, _ := http.NewRequestWithContext(handlerCtx, http.MethodPost, srv.URL, nil)
+	otel.GetTextMapPropagator().Inject(handlerCtx, propagation.HeaderCarrier(req.Header))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+
+	// payment-api
+	if want := span.SpanContext().TraceID(); gotTrace != want {
+		t.Errorf("payment-api got trace %s, want %s", gotTrace, want)
+	}
+	if gotCustomer != "c-42" {
+		t.Errorf("payment-api got customer_id baggage %q, want c-42", gotCustomer)
+	}
+}
@@ -0,0 +1,162 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	HeaderQuarantineError    = "x-quarantine-error"
+	HeaderQuarantineFailures = "x-quarantine-failures"
+
+	quarantineBackoff = 200 * time.Millisecond
+)
+
+// PanicError is returned in place of a handler that panicked.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic while handling message: %v", e.Value)
+}
+
+// recoverPanic must be deferred directly.
+func recoverPanic(ctx context.Context, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	panicErr := &PanicError{Value: r, Stack: debug.Stack()}
+	trace.SpanFromContext(ctx).RecordError(panicErr,
+		trace.WithAttributes(semconv.ExceptionStacktrace(string(panicErr.Stack))),
+	)
+	*err = panicErr
+}
+
+func callHandler(ctx context.Context, handler HandlerFunc, msg Message) (err error) {
+	defer recoverPanic(ctx, &err)
+	return handler(ctx, msg)
+}
+
+// QuarantineSink receives the messages that kept failing.
+type QuarantineSink interface {
+	Quarantine(ctx context.Context, msg Message, failures int, cause error) error
+}
+
+type QuarantineFunc func(ctx context.Context, msg Message, failures int, cause error) error
+
+func (f QuarantineFunc) Quarantine(ctx context.Context, msg Message, failures int, cause error) error {
+	return f(ctx, msg, failures, cause)
+}
+
+// TopicQuarantine publishes quarantined messages through producer.
+func TopicQuarantine(producer *Producer) QuarantineSink {
+	return QuarantineFunc(func(ctx context.Context, msg Message, failures int, cause error) error {
+		headers := withoutHeaders(msg.Headers, HeaderQuarantineError, HeaderQuarantineFailures)
+		headers = append(headers,
+			kafka.Header{Key: HeaderQuarantineError, Value: []byte(cause.Error())},
+			kafka.Header{Key: HeaderQuarantineFailures, Value: []byte(strconv.Itoa(failures))},
+			kafka.Header{Key: HeaderDeadLetterTopic, Value: []byte(msg.Topic)},
+			kafka.Header{Key: HeaderDeadLetterPartition, Value: []byte(strconv.Itoa(msg.Partition))},
+			kafka.Header{Key: HeaderDeadLetterOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+			kafka.Header{Key: HeaderDeadLetterGroup, Value: []byte(msg.GroupID)},
+		)
+		return producer.PublishRaw(ctx, msg.Key, msg.Value, headers)
+	})
+}
+
+// WithQuarantine retries a failing message in place and hands it to sink after
+// n failures. It is disabled by retry tiers, dead-letter topics and batches.
+func WithQuarantine(n int, sink QuarantineSink) ConsumerOption {
+	return func(c *Consumer) {
+		c.quarantineAfter = n
+		c.quarantine = sink
+		c.failures = newFailureCounter()
+	}
+}
+
+type failureCounter struct {
+	mu     sync.Mutex
+	counts map[topicPartition]map[int64]int
+}
+
+func newFailureCounter() *failureCounter {
+	return &failureCounter{counts: make(map[topicPartition]map[int64]int)}
+}
+
+func (f *failureCounter) inc(msg kafka.Message) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tp := topicPartition{topic: msg.Topic, partition: msg.Partition}
+	if f.counts[tp] == nil {
+		f.counts[tp] = make(map[int64]int)
+	}
+	f.counts[tp][msg.Offset]++
+	return f.counts[tp][msg.Offset]
+}
+
+func (f *failureCounter) reset(msg kafka.Message) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tp := topicPartition{topic: msg.Topic, partition: msg.Partition}
+	delete(f.counts[tp], msg.Offset)
+	if len(f.counts[tp]) == 0 {
+		delete(f.counts, tp)
+	}
+}
+
+func (c *Consumer) handleInPlace(ctx, msgCtx context.Context, msg kafka.Message, handler HandlerFunc, cause error) (bool, error) {
+	for {
+		failures := c.failures.inc(msg)
+		if failures >= c.quarantineAfter {
+			c.failures.reset(msg)
+			if err := c.quarantine.Quarantine(msgCtx, c.message(msg), failures, cause); err != nil {
+				return false, fmt.Errorf("failed to quarantine message: %w", err)
+			}
+			if c.metrics != nil {
+				c.metrics.MessagesQuarantined.Add(msgCtx, 1, c.metricAttrs(msg.Topic))
+			}
+			c.log.Warn("message quarantined",
+				zap.String("topic", msg.Topic),
+				zap.Int("partition", msg.Partition),
+				zap.Int64("offset", msg.Offset),
+				zap.Int("failures", failures),
+				zap.Error(cause),
+			)
+			return true, nil
+		}
+
+		timer := time.NewTimer(time.Duration(failures) * quarantineBackoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false, nil
+		case <-timer.C:
+		}
+
+		cause = c.runHandler(msgCtx, handler, msg)
+		if cause == nil {
+			c.failures.reset(msg)
+			return true, nil
+		}
+		if ctx.Err() != nil {
+			return false, nil
+		}
+		c.recordFailure(msgCtx, msg.Topic, 1, cause)
+	}
+}
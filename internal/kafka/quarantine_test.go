@@ -0,0 +1,176 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type quarantined struct {
+	msg      Message
+	failures int
+	cause    error
+}
+
+// quarantineInto returns a sink that appends what it receives to q.
+func quarantineInto(q *[]quarantined) QuarantineSink {
+	return QuarantineFunc(func(_ context.Context, msg Message, failures int, cause error) error {
+		*q = append(*q, quarantined{msg: msg, failures: failures, cause: cause})
+		return nil
+	})
+}
+
+func TestQuarantinePoisonPill(t *testing.T) {
+	var q []quarantined
+	metrics, reader := withTestMetrics(t)
+	c, _ := newTestConsumer(t, WithQuarantine(3, quarantineInto(&q)), metrics)
+
+	calls := 0
+	msg := kafka.Message{Topic: "orders", Partition: 1, Offset: 9, Value: []byte("poison")}
+	commit, err := c.handle(t.Context(), msg, func(context.Context, Message) error {
+		calls++
+		var order *struct{ ID string }
+		_ = order.ID
+		return nil
+	})
+	if err != nil || !commit {
+		t.Fatalf("handle = %v, %v, want the message quarantined and committed", commit, err)
+	}
+
+	if calls != 3 {
+		t.Errorf("handler called %d times, want 3", calls)
+	}
+	if len(q) != 1 {
+		t.Fatalf("%d messages quarantined, want 1", len(q))
+	}
+	var panicErr *PanicError
+	if q[0].failures != 3 || string(q[0].msg.Value) != "poison" || !errors.As(q[0].cause, &panicErr) {
+		t.Errorf("quarantined %+v, want the message after 3 panics", q[0])
+	}
+	if len(c.failures.counts) != 0 {
+		t.Errorf("failure counts = %v, want none left", c.failures.counts)
+	}
+	for name, want := range map[string]int64{
+		"messages_failed_total":      3,
+		"handler_panics_total":       3,
+		"messages_quarantined_total": 1,
+	} {
+		if n := counted(t, reader, name, "orders"); n != want {
+			t.Errorf("%s = %d, want %d", name, n, want)
+		}
+	}
+}
+
+func TestQuarantineRetriesInPlace(t *testing.T) {
+	var q []quarantined
+	c, _ := newTestConsumer(t, WithQuarantine(3, quarantineInto(&q)))
+
+	calls := 0
+	commit, err := c.handle(t.Context(), kafka.Message{Topic: "orders"}, func(context.Context, Message) error {
+		calls++
+		if calls < 3 {
+			return errors.New("flaky")
+		}
+		return nil
+	})
+	if err != nil || !commit || calls != 3 {
+		t.Errorf("handle = %v, %v after %d calls, want success on the third", commit, err, calls)
+	}
+	if len(q) != 0 {
+		t.Errorf("quarantined %+v, want nothing", q)
+	}
+	if len(c.failures.counts) != 0 {
+		t.Errorf("failure counts = %v, want none left", c.failures.counts)
+	}
+}
+
+func TestQuarantineStopsOnDrain(t *testing.T) {
+	var q []quarantined
+	c, _ := newTestConsumer(t, WithQuarantine(3, quarantineInto(&q)))
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	commit, err := c.handle(ctx, kafka.Message{Topic: "orders"}, failing("boom"))
+	if err != nil || commit {
+		t.Errorf("handle = %v, %v, want the message left uncommitted", commit, err)
+	}
+	if len(q) != 0 {
+		t.Errorf("quarantined %+v while draining", q)
+	}
+}
+
+func TestQuarantineSinkFailure(t *testing.T) {
+	c, _ := newTestConsumer(t, WithQuarantine(1, QuarantineFunc(func(context.Context, Message, int, error) error {
+		return errors.New("sink down")
+	})))
+
+	commit, err := c.handle(t.Context(), kafka.Message{Topic: "orders"}, failing("boom"))
+	if err == nil || commit {
+		t.Errorf("handle = %v, %v, want the sink error", commit, err)
+	}
+}
+
+func TestDeadLetterTakesPrecedenceOverQuarantine(t *testing.T) {
+	var q []quarantined
+	core, logs := observer.New(zap.WarnLevel)
+	c := newRoutingConsumer(t, WithDeadLetter(), WithQuarantine(3, quarantineInto(&q)), WithLogger(zap.New(core)))
+	if logs.FilterMessageSnippet("quarantine disabled").Len() != 1 {
+		t.Errorf("logged %v, want a warning that quarantine is disabled", logs.All())
+	}
+
+	handleOne(t, c, kafka.Message{Topic: "orders"}, failing("boom"), "orders.dlq")
+	if len(q) != 0 {
+		t.Errorf("quarantined %+v, want it dead-lettered", q)
+	}
+}
+
+func TestBatchIgnoresQuarantine(t *testing.T) {
+	var q []quarantined
+	core, logs := observer.New(zap.WarnLevel)
+	c, _ := newTestConsumer(t, WithQuarantine(3, quarantineInto(&q)), WithLogger(zap.New(core)))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	_ = c.ListenBatch(ctx, 10, time.Millisecond, func(context.Context, []Message) error { return nil })
+	if logs.FilterMessageSnippet("quarantine disabled").Len() != 1 {
+		t.Errorf("logged %v, want a warning that quarantine is disabled", logs.All())
+	}
+}
+
+func TestTopicQuarantine(t *testing.T) {
+	p := newCapturingProducer(t)
+	msg := Message{
+		Topic: "orders", Partition: 2, Offset: 40, GroupID: "test-group",
+		Key: []byte("o-1"), Value: []byte("poison"),
+		Headers: []kafka.Header{{Key: HeaderQuarantineFailures, Value: []byte("1")}},
+	}
+	if err := TopicQuarantine(p).Quarantine(t.Context(), msg, 5, errors.New("boom")); err != nil {
+		t.Fatal(err)
+	}
+
+	got := published(t, p)[0]
+	if string(got.Key) != "o-1" || string(got.Value) != "poison" {
+		t.Errorf("quarantined %q = %q, want the original key and value", got.Key, got.Value)
+	}
+	for key, want := range map[string]string{
+		HeaderQuarantineError:     "boom",
+		HeaderQuarantineFailures:  "5",
+		HeaderDeadLetterTopic:     "orders",
+		HeaderDeadLetterPartition: "2",
+		HeaderDeadLetterOffset:    "40",
+		HeaderDeadLetterGroup:     "test-group",
+	} {
+		if got := headerValue(got.Headers, key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if n := headerCount(got.Headers, HeaderQuarantineFailures); n != 1 {
+		t.Errorf("%d failure count headers, want 1", n)
+	}
+}
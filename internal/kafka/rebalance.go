@@ -0,0 +1,225 @@
+package kafka
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Group lifecycle format strings logged by kafka.Reader.
+const (
+	logJoinedGroup   = "Joined group %s as member %s in generation %d"
+	logJoinFailed    = "Failed to join group %s: %v"
+	logSyncFailed    = "Failed to sync group %s: %v"
+	logSubscribed    = "subscribed to topics and partitions: %+v"
+	logStoppedCommit = "stopped commit for group %s\n"
+	logLeavingGroup  = "Leaving group %s, member %s"
+)
+
+// groupObserver turns the group lifecycle logs of a reader into telemetry.
+type groupObserver struct {
+	c *Consumer
+
+	mu         sync.Mutex
+	memberID   string
+	generation int64
+	assigned   []topicPartition
+	rebalance  trace.Span
+}
+
+func (o *groupObserver) Printf(format string, args ...any) {
+	switch {
+	case format == logJoinedGroup && len(args) == 3:
+		generation, _ := strconv.ParseInt(fmt.Sprint(args[2]), 10, 64)
+		o.joined(fmt.Sprint(args[1]), generation)
+	case format == logSubscribed && len(args) == 1:
+		o.assign(assignedPartitions(args[0]))
+	case format == logStoppedCommit:
+		o.revoke()
+	case format == logLeavingGroup && len(args) == 2:
+		o.left(fmt.Sprint(args[1]))
+	case (format == logJoinFailed || format == logSyncFailed) && len(args) == 2:
+		o.c.log.Warn("consumer group rebalance failed",
+			zap.Strings("topics", o.c.topics),
+			zap.String("consumer_group", o.c.groupID),
+			zap.String("error", fmt.Sprint(args[1])),
+		)
+	}
+}
+
+func (o *groupObserver) joined(memberID string, generation int64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.memberID, o.generation = memberID, generation
+	span := o.startRebalance()
+	span.AddEvent("joined group", trace.WithAttributes(o.memberAttrs()...))
+	span.SetAttributes(o.memberAttrs()...)
+
+	o.logger().Info("consumer joined group")
+	o.count("join")
+}
+
+func (o *groupObserver) assign(partitions []topicPartition) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.assigned = partitions
+	span := o.startRebalance()
+	span.AddEvent("partitions assigned", trace.WithAttributes(partitionsAttr(partitions)))
+	span.SetAttributes(partitionsAttr(partitions))
+	span.End()
+	o.rebalance = nil
+
+	o.logger().Info("partitions assigned", zap.Strings("partitions", partitionNames(partitions)))
+	o.count("assign")
+	o.recordAssigned(partitions)
+	o.c.stats.assigned(partitions)
+}
+
+func (o *groupObserver) revoke() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	revoked := o.assigned
+	o.assigned = nil
+	span := o.startRebalance()
+	span.AddEvent("partitions revoked", trace.WithAttributes(partitionsAttr(revoked)))
+
+	o.logger().Info("partitions revoked", zap.Strings("partitions", partitionNames(revoked)))
+	o.count("revoke")
+	o.recordAssigned(nil)
+	o.c.stats.assigned(nil)
+}
+
+func (o *groupObserver) left(memberID string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.memberID = memberID
+	name, _ := o.c.destination(o.c.topics...)
+	_, span := o.c.tracer.Start(context.Background(), fmt.Sprintf("leave %s", name),
+		trace.WithAttributes(o.spanAttrs()...),
+	)
+	span.End()
+	if o.rebalance != nil {
+		o.rebalance.End()
+		o.rebalance = nil
+	}
+
+	o.logger().Info("consumer left group")
+	o.count("leave")
+}
+
+// startRebalance must be called with o.mu held.
+func (o *groupObserver) startRebalance() trace.Span {
+	if o.rebalance == nil {
+		name, _ := o.c.destination(o.c.topics...)
+		_, o.rebalance = o.c.tracer.Start(context.Background(), fmt.Sprintf("rebalance %s", name),
+			trace.WithAttributes(o.spanAttrs()...),
+		)
+	}
+	return o.rebalance
+}
+
+func (o *groupObserver) spanAttrs() []attribute.KeyValue {
+	_, destination := o.c.destination(o.c.topics...)
+	return append(append(destination,
+		semconv.MessagingSystemKafka,
+		semconv.MessagingKafkaConsumerGroup(o.c.groupID),
+	), o.memberAttrs()...)
+}
+
+func (o *groupObserver) memberAttrs() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("messaging.kafka.member.id", o.memberID),
+		attribute.Int64("messaging.kafka.generation.id", o.generation),
+	}
+}
+
+func (o *groupObserver) logger() *zap.Logger {
+	return o.c.log.With(
+		zap.Strings("topics", o.c.topics),
+		zap.String("consumer_group", o.c.groupID),
+		zap.String("member_id", o.memberID),
+		zap.Int64("generation", o.generation),
+	)
+}
+
+func (o *groupObserver) count(event string) {
+	if o.c.metrics == nil {
+		return
+	}
+	for _, topic := range o.c.topics {
+		o.c.metrics.RebalanceEvents.Add(context.Background(), 1, metric.WithAttributes(
+			attribute.String("topic", topic),
+			attribute.String("consumer_group", o.c.groupID),
+			attribute.String("event", event),
+		))
+	}
+}
+
+func (o *groupObserver) recordAssigned(partitions []topicPartition) {
+	if o.c.metrics == nil {
+		return
+	}
+	for _, topic := range o.c.topics {
+		n := 0
+		for _, tp := range partitions {
+			if tp.topic == topic {
+				n++
+			}
+		}
+		o.c.metrics.AssignedPartitions.Record(context.Background(), int64(n), metric.WithAttributes(
+			attribute.String("topic", topic),
+			attribute.String("consumer_group", o.c.groupID),
+			attribute.String("member_id", o.memberID),
+		))
+	}
+}
+
+// assignedPartitions reads the offsets map logged by kafka.Reader.
+func assignedPartitions(offsets any) []topicPartition {
+	v := reflect.ValueOf(offsets)
+	if v.Kind() != reflect.Map {
+		return nil
+	}
+
+	partitions := make([]topicPartition, 0, v.Len())
+	for _, k := range v.MapKeys() {
+		if k.Kind() != reflect.Struct {
+			continue
+		}
+		topic, partition := k.FieldByName("topic"), k.FieldByName("partition")
+		if topic.Kind() != reflect.String || !partition.CanInt() {
+			continue
+		}
+		partitions = append(partitions, topicPartition{topic: topic.String(), partition: int(partition.Int())})
+	}
+	slices.SortFunc(partitions, func(a, b topicPartition) int {
+		return cmp.Or(cmp.Compare(a.topic, b.topic), cmp.Compare(a.partition, b.partition))
+	})
+	return partitions
+}
+
+func partitionNames(partitions []topicPartition) []string {
+	names := make([]string, len(partitions))
+	for i, tp := range partitions {
+		names[i] = tp.topic + "/" + strconv.Itoa(tp.partition)
+	}
+	return names
+}
+
+func partitionsAttr(partitions []topicPartition) attribute.KeyValue {
+	return attribute.StringSlice("messaging.kafka.partitions", partitionNames(partitions))
+}
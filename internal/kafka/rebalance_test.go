@@ -0,0 +1,172 @@
+package kafka
+
+import (
+	"context"
+	"kafka-go-study/internal/telemetry"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// kafkaGoTopicPartition mirrors the unexported key of the offsets map that
+// kafka-go v0.4.50 logs on assignment (writer.go).
+type kafkaGoTopicPartition struct {
+	topic     string
+	partition int32
+}
+
+// printKafkaGoLog calls Printf as kafka-go v0.4.50 does. The format strings
+// are copied from consumergroup.go and reader.go rather than taken from the
+// constants of rebalance.go, so an upgrade that changes them fails here.
+func printKafkaGoLog(o *groupObserver, event string) {
+	switch event {
+	case "join":
+		o.Printf("Joined group %s as member %s in generation %d", "test-group", "member-1", int32(7))
+	case "assign":
+		o.Printf("subscribed to topics and partitions: %+v", map[kafkaGoTopicPartition]int64{
+			{topic: "orders", partition: 2}: 40,
+			{topic: "orders", partition: 0}: 10,
+		})
+	case "revoke":
+		o.Printf("stopped commit for group %s\n", "test-group")
+	case "join failed":
+		o.Printf("Failed to join group %s: %v", "test-group", "coordinator not available")
+	case "leave":
+		o.Printf("Leaving group %s, member %s", "test-group", "member-1")
+	}
+}
+
+func newObservedConsumer(t *testing.T) (*groupObserver, *tracetest.SpanRecorder, *observer.ObservedLogs, *sdkmetric.ManualReader) {
+	t.Helper()
+	c, spans := newTestConsumer(t)
+
+	core, logs := observer.New(zap.InfoLevel)
+	c.log = zap.New(core)
+
+	reader := sdkmetric.NewManualReader()
+	metrics, err := telemetry.NewMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.metrics = metrics
+
+	o, ok := c.reader.Config().Logger.(*groupObserver)
+	if !ok {
+		t.Fatalf("reader logger = %T, want *groupObserver", c.reader.Config().Logger)
+	}
+	return o, spans, logs, reader
+}
+
+func TestGroupObserverFollowsKafkaGoLogs(t *testing.T) {
+	o, spans, logs, reader := newObservedConsumer(t)
+
+	printKafkaGoLog(o, "join")
+	printKafkaGoLog(o, "assign")
+
+	if o.memberID != "member-1" || o.generation != 7 {
+		t.Errorf("member = %q in generation %d, want member-1 in 7", o.memberID, o.generation)
+	}
+	assigned := []topicPartition{{"orders", 0}, {"orders", 2}}
+	if !slices.Equal(o.assigned, assigned) {
+		t.Errorf("assigned = %v, want %v", o.assigned, assigned)
+	}
+	ended := spans.Ended()
+	if len(ended) != 1 || ended[0].Name() != "rebalance orders" {
+		t.Fatalf("ended spans = %v, want one rebalance span", spanNames(ended))
+	}
+	if !hasAttr(ended[0], attribute.StringSlice("messaging.kafka.partitions", []string{"orders/0", "orders/2"})) {
+		t.Errorf("rebalance span attributes = %v", ended[0].Attributes())
+	}
+	if entries := logs.FilterMessage("partitions assigned").All(); len(entries) != 1 {
+		t.Errorf("%d assignment logs, want 1", len(entries))
+	}
+	if n := assignedGauge(t, reader); n != 2 {
+		t.Errorf("assigned partitions gauge = %d, want 2", n)
+	}
+
+	printKafkaGoLog(o, "revoke")
+	if len(o.assigned) != 0 {
+		t.Errorf("assigned after revoke = %v, want none", o.assigned)
+	}
+	if o.rebalance == nil {
+		t.Error("revoke did not start a rebalance span")
+	}
+	revoked := logs.FilterMessage("partitions revoked").All()
+	if len(revoked) != 1 || !slices.Equal(revoked[0].ContextMap()["partitions"].([]any), []any{"orders/0", "orders/2"}) {
+		t.Errorf("revoke logs = %v, want the revoked partitions", revoked)
+	}
+	if n := assignedGauge(t, reader); n != 0 {
+		t.Errorf("assigned partitions gauge after revoke = %d, want 0", n)
+	}
+
+	printKafkaGoLog(o, "join failed")
+	if entries := logs.FilterMessage("consumer group rebalance failed").All(); len(entries) != 1 {
+		t.Errorf("%d rebalance failure logs, want 1", len(entries))
+	}
+
+	printKafkaGoLog(o, "leave")
+	if o.rebalance != nil {
+		t.Error("rebalance span still open after leaving")
+	}
+	names := spanNames(spans.Ended())
+	if !slices.Contains(names, "leave orders") {
+		t.Errorf("ended spans = %v, want a leave span", names)
+	}
+
+	events := rebalanceEvents(t, reader)
+	for _, event := range []string{"join", "assign", "revoke", "leave"} {
+		if events[event] != 1 {
+			t.Errorf("rebalance events = %v, want one %s", events, event)
+		}
+	}
+}
+
+func spanNames[S interface{ Name() string }](spans []S) []string {
+	names := make([]string, len(spans))
+	for i, s := range spans {
+		names[i] = s.Name()
+	}
+	return names
+}
+
+func collect(t *testing.T, reader *sdkmetric.ManualReader, name string) metricdata.Aggregation {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+		}
+	}
+	return nil
+}
+
+func assignedGauge(t *testing.T, reader *sdkmetric.ManualReader) int64 {
+	t.Helper()
+	gauge, ok := collect(t, reader, "consumer_assigned_partitions").(metricdata.Gauge[int64])
+	if !ok || len(gauge.DataPoints) != 1 {
+		t.Fatalf("consumer_assigned_partitions = %+v, want one series", gauge)
+	}
+	return gauge.DataPoints[0].Value
+}
+
+func rebalanceEvents(t *testing.T, reader *sdkmetric.ManualReader) map[string]int64 {
+	t.Helper()
+	events := make(map[string]int64)
+	sum, _ := collect(t, reader, "consumer_rebalance_events_total").(metricdata.Sum[int64])
+	for _, p := range sum.DataPoints {
+		v, _ := p.Attributes.Value("event")
+		events[v.AsString()] = p.Value
+	}
+	return events
+}
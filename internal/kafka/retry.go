@@ -0,0 +1,139 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	HeaderRetryAttempt         = "x-retry-attempt"
+	HeaderRetryDueAt           = "x-retry-due-at"
+	HeaderRetryError           = "x-retry-error"
+	HeaderRetryOriginTopic     = "x-retry-origin-topic"
+	HeaderRetryOriginPartition = "x-retry-origin-partition"
+	HeaderRetryOriginOffset    = "x-retry-origin-offset"
+
+	retryOriginTracePrefix = "x-retry-origin-"
+)
+
+// WithRetryTiers sends failed messages through one retry topic per delay
+// before the dead-letter topic.
+func WithRetryTiers(delays ...time.Duration) ConsumerOption {
+	return func(c *Consumer) { c.retryDelays = delays }
+}
+
+func RetryTopic(topic string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", topic, shortDuration(delay))
+}
+
+func retryGroup(groupID string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", groupID, shortDuration(delay))
+}
+
+func shortDuration(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	default:
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+}
+
+func (c *Consumer) setupRetryTiers(brokers []string, opts []ConsumerOption) {
+	for i, d := range c.retryDelays {
+		topics := make([]string, len(c.topics))
+		for j, topic := range c.topics {
+			topics[j] = RetryTopic(topic, d)
+		}
+
+		tierOpts := append(slices.Clone(opts), func(t *Consumer) {
+			t.retryTier = true
+			t.originGroupID = c.groupID
+		})
+		tier := newConsumer(brokers, topics, retryGroup(c.groupID, d), tierOpts)
+		tier.deadLetter = c.deadLetter
+		tier.deadLetterTopic = c.deadLetterTopic
+		tier.producers = c.producers
+		tier.flow = c.flow
+		tier.retryDelays = c.retryDelays[i+1:]
+		c.retryTiers = append(c.retryTiers, tier)
+	}
+}
+
+func (c *Consumer) sendToRetry(ctx context.Context, msg kafka.Message, cause error) error {
+	attempt := attempts(msg.Headers)
+	headers := withoutHeaders(msg.Headers, HeaderRetryAttempt, HeaderRetryDueAt, HeaderRetryError)
+	headers = append(headers,
+		kafka.Header{Key: HeaderRetryAttempt, Value: []byte(strconv.Itoa(attempt))},
+		kafka.Header{Key: HeaderRetryDueAt, Value: []byte(strconv.FormatInt(time.Now().Add(c.retryDelays[0]).UnixMilli(), 10))},
+		kafka.Header{Key: HeaderRetryError, Value: []byte(cause.Error())},
+	)
+
+	if headerValue(msg.Headers, HeaderRetryOriginTopic) == "" {
+		headers = append(headers,
+			kafka.Header{Key: HeaderRetryOriginTopic, Value: []byte(msg.Topic)},
+			kafka.Header{Key: HeaderRetryOriginPartition, Value: []byte(strconv.Itoa(msg.Partition))},
+			kafka.Header{Key: HeaderRetryOriginOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		)
+
+		origin := propagation.MapCarrier{}
+		propagation.TraceContext{}.Inject(ctx, origin)
+		for k, v := range origin {
+			headers = append(headers, kafka.Header{Key: retryOriginTracePrefix + k, Value: []byte(v)})
+		}
+	}
+
+	return c.producers.get(RetryTopic(c.message(msg).OriginTopic(), c.retryDelays[0])).PublishRaw(ctx, msg.Key, msg.Value, headers)
+}
+
+func retryOriginLinks(headers []kafka.Header) []trace.Link {
+	origin := propagation.MapCarrier{}
+	for _, k := range (propagation.TraceContext{}).Fields() {
+		if v := headerValue(headers, retryOriginTracePrefix+k); v != "" {
+			origin[k] = v
+		}
+	}
+	if len(origin) == 0 {
+		return nil
+	}
+
+	sc := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), origin))
+	if !sc.IsValid() {
+		return nil
+	}
+	return []trace.Link{{SpanContext: sc}}
+}
+
+func waitUntilDue(ctx context.Context, msg kafka.Message) error {
+	dueAt, err := strconv.ParseInt(headerValue(msg.Headers, HeaderRetryDueAt), 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	wait := time.Until(time.UnixMilli(dueAt))
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,206 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// newRoutingConsumer returns a consumer of orders and payments, with its
+// retry tiers. Its retry and dead-letter producers are taken with routedTo.
+func newRoutingConsumer(t *testing.T, opts ...ConsumerOption) *Consumer {
+	t.Helper()
+	c := NewMultiTopicConsumer([]string{"127.0.0.1:1"}, []string{"orders", "payments"}, "test-group", opts...)
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+// routedTo returns the capturing producer c routes messages for topic to.
+func routedTo(t *testing.T, c *Consumer, topic string) *Producer {
+	t.Helper()
+	c.producers.mu.Lock()
+	defer c.producers.mu.Unlock()
+
+	p, ok := c.producers.producers[topic]
+	if !ok {
+		p = NewProducer(c.producers.brokers, topic, WithSpill(t.TempDir(), 1<<20))
+		p.writer.MaxAttempts = 1
+		c.producers.producers[topic] = p
+	}
+	return p
+}
+
+// producerTraceparent is the trace context of the span that produced the
+// failing message.
+const producerTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func failing(cause string) HandlerFunc {
+	return func(context.Context, Message) error { return errors.New(cause) }
+}
+
+// handleOne runs handler on msg and returns the one message it was routed
+// to on topic.
+func handleOne(t *testing.T, c *Consumer, msg kafka.Message, handler HandlerFunc, topic string) kafka.Message {
+	t.Helper()
+	p := routedTo(t, c, topic)
+	commit, err := c.handle(t.Context(), msg, handler)
+	if err != nil || !commit {
+		t.Fatalf("handle = %v, %v, want the failure routed and committed", commit, err)
+	}
+	msgs := published(t, p)
+	if len(msgs) != 1 {
+		t.Fatalf("%d messages routed to %s, want 1", len(msgs), topic)
+	}
+	return msgs[0]
+}
+
+func TestRetryTiersRouteFailures(t *testing.T) {
+	c := newRoutingConsumer(t, WithRetryTiers(5*time.Second, time.Minute))
+	if len(c.retryTiers) != 2 {
+		t.Fatalf("%d retry tiers, want 2", len(c.retryTiers))
+	}
+
+	msg := kafka.Message{
+		Topic: "payments", Partition: 2, Offset: 40,
+		Key: []byte("p-1"), Value: []byte("payment"),
+		Headers: []kafka.Header{
+			{Key: "x-tenant", Value: []byte("t-1")},
+			{Key: "traceparent", Value: []byte(producerTraceparent)},
+		},
+	}
+	before := time.Now()
+	first := handleOne(t, c, msg, failing("gateway down"), "payments.retry.5s")
+
+	if string(first.Key) != "p-1" || string(first.Value) != "payment" || headerValue(first.Headers, "x-tenant") != "t-1" {
+		t.Errorf("retried message = %+v, want the original key, value and headers", first)
+	}
+	for key, want := range map[string]string{
+		HeaderRetryAttempt:         "1",
+		HeaderRetryError:           "gateway down",
+		HeaderRetryOriginTopic:     "payments",
+		HeaderRetryOriginPartition: "2",
+		HeaderRetryOriginOffset:    "40",
+	} {
+		if got := headerValue(first.Headers, key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	dueAt, _ := strconv.ParseInt(headerValue(first.Headers, HeaderRetryDueAt), 10, 64)
+	if due := time.UnixMilli(dueAt); due.Before(before.Add(5*time.Second).Truncate(time.Millisecond)) || due.After(time.Now().Add(5*time.Second)) {
+		t.Errorf("due at %v, want 5s after the failure", due)
+	}
+	if links := retryOriginLinks(first.Headers); len(links) != 1 || links[0].SpanContext.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("retry links = %v, want the producer span of the first attempt", links)
+	}
+
+	// The first tier hands the message, as seen from the original topic, to
+	// the next one.
+	var origin string
+	second := handleOne(t, c.retryTiers[0], first, func(_ context.Context, msg Message) error {
+		origin = msg.OriginTopic()
+		return errors.New("still down")
+	}, "payments.retry.1m")
+
+	if origin != "payments" {
+		t.Errorf("handler saw origin topic %q, want payments", origin)
+	}
+	if got := headerValue(second.Headers, HeaderRetryAttempt); got != "2" {
+		t.Errorf("attempt = %q, want 2", got)
+	}
+	if got := headerValue(second.Headers, HeaderRetryError); got != "still down" {
+		t.Errorf("error = %q, want the latest one", got)
+	}
+	for _, key := range []string{HeaderRetryAttempt, HeaderRetryError, HeaderRetryOriginTopic, retryOriginTracePrefix + "traceparent"} {
+		if n := headerCount(second.Headers, key); n != 1 {
+			t.Errorf("%d %s headers, want 1", n, key)
+		}
+	}
+	if headerValue(second.Headers, retryOriginTracePrefix+"traceparent") != headerValue(first.Headers, retryOriginTracePrefix+"traceparent") {
+		t.Error("second retry does not link to the first attempt")
+	}
+
+	// The last tier gives up on the dead-letter topic of the original topic.
+	dead := handleOne(t, c.retryTiers[1], second, failing("gave up"), "payments.dlq")
+	for key, want := range map[string]string{
+		HeaderDeadLetterError:     "gave up",
+		HeaderDeadLetterTopic:     "payments",
+		HeaderDeadLetterPartition: "2",
+		HeaderDeadLetterOffset:    "40",
+		HeaderDeadLetterAttempts:  "3",
+		HeaderDeadLetterGroup:     "test-group",
+	} {
+		if got := headerValue(dead.Headers, key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestRetryTopicNames(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		500 * time.Millisecond: "orders.retry.500ms",
+		5 * time.Second:        "orders.retry.5s",
+		90 * time.Second:       "orders.retry.90s",
+		10 * time.Minute:       "orders.retry.10m",
+		2 * time.Hour:          "orders.retry.2h",
+	} {
+		if got := RetryTopic("orders", d); got != want {
+			t.Errorf("RetryTopic(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestRetryTiersSubscribeEveryTopic(t *testing.T) {
+	c := newRoutingConsumer(t, WithRetryTiers(5*time.Second, time.Minute))
+
+	for i, want := range []struct {
+		group  string
+		topics []string
+	}{
+		{"test-group.retry.5s", []string{"orders.retry.5s", "payments.retry.5s"}},
+		{"test-group.retry.1m", []string{"orders.retry.1m", "payments.retry.1m"}},
+	} {
+		tier := c.retryTiers[i]
+		cfg := tier.reader.Config()
+		if cfg.GroupID != want.group || len(cfg.GroupTopics) != 2 || cfg.GroupTopics[0] != want.topics[0] || cfg.GroupTopics[1] != want.topics[1] {
+			t.Errorf("tier %d reads %v as %s, want %v as %s", i, cfg.GroupTopics, cfg.GroupID, want.topics, want.group)
+		}
+		if !tier.retryTier || tier.producers != c.producers || tier.flow != c.flow {
+			t.Errorf("tier %d does not share the producers and flow control of its consumer", i)
+		}
+	}
+}
+
+func TestWaitUntilDue(t *testing.T) {
+	due := func(at time.Time) kafka.Message {
+		return kafka.Message{Headers: []kafka.Header{{Key: HeaderRetryDueAt, Value: []byte(strconv.FormatInt(at.UnixMilli(), 10))}}}
+	}
+
+	start := time.Now()
+	if err := waitUntilDue(t.Context(), due(start.Add(50*time.Millisecond))); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < 40*time.Millisecond {
+		t.Errorf("waited %v, want until the due time", waited)
+	}
+
+	for name, msg := range map[string]kafka.Message{
+		"past due":  due(time.Now().Add(-time.Minute)),
+		"no header": {},
+		"malformed": {Headers: []kafka.Header{{Key: HeaderRetryDueAt, Value: []byte("soon")}}},
+	} {
+		start := time.Now()
+		if err := waitUntilDue(t.Context(), msg); err != nil || time.Since(start) > 10*time.Millisecond {
+			t.Errorf("%s: waitUntilDue = %v after %v, want no wait", name, err, time.Since(start))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+	if err := waitUntilDue(ctx, due(time.Now().Add(time.Hour))); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("waitUntilDue = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,21 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNoHandler is returned for messages of a topic that has no handler.
+var ErrNoHandler = errors.New("no handler for topic")
+
+// RouteByTopic dispatches every message to the handler of its origin topic.
+func RouteByTopic(handlers map[string]HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, msg Message) error {
+		handler, ok := handlers[msg.OriginTopic()]
+		if !ok {
+			return fmt.Errorf("%w %s", ErrNoHandler, msg.OriginTopic())
+		}
+		return handler(ctx, msg)
+	}
+}
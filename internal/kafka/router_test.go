@@ -0,0 +1,119 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"kafka-go-study/internal/telemetry"
+	"slices"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestRouteByTopic(t *testing.T) {
+	var routed []string
+	handler := func(name string) HandlerFunc {
+		return func(context.Context, Message) error {
+			routed = append(routed, name)
+			return nil
+		}
+	}
+	route := RouteByTopic(map[string]HandlerFunc{
+		"orders":   handler("orders"),
+		"payments": handler("payments"),
+	})
+
+	retried := Message{
+		Topic:   "payments.retry.5s",
+		Headers: []kafka.Header{{Key: HeaderRetryOriginTopic, Value: []byte("payments")}},
+	}
+	for _, msg := range []Message{{Topic: "orders"}, {Topic: "payments"}, retried} {
+		if err := route(t.Context(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"orders", "payments", "payments"}; !slices.Equal(routed, want) {
+		t.Errorf("routed to %v, want %v", routed, want)
+	}
+
+	if err := route(t.Context(), Message{Topic: "refunds"}); !errors.Is(err, ErrNoHandler) {
+		t.Errorf("route = %v, want %v", err, ErrNoHandler)
+	}
+}
+
+func TestMultiTopicConsumerSubscribesOneGroup(t *testing.T) {
+	c := newRoutingConsumer(t)
+
+	cfg := c.reader.Config()
+	if cfg.GroupID != "test-group" || !slices.Equal(cfg.GroupTopics, []string{"orders", "payments"}) || cfg.Topic != "" {
+		t.Errorf("reader reads %q (%v) as %s, want both topics in one group", cfg.Topic, cfg.GroupTopics, cfg.GroupID)
+	}
+}
+
+func TestIsFailureTopic(t *testing.T) {
+	for topic, want := range map[string]bool{
+		"orders":           false,
+		"orders.dlq":       true,
+		"orders.retry.5s":  true,
+		"orders.retryable": false,
+		"dlq.orders":       false,
+	} {
+		if got := isFailureTopic(topic); got != want {
+			t.Errorf("isFailureTopic(%q) = %v, want %v", topic, got, want)
+		}
+	}
+}
+
+func TestMultiTopicConsumerNamesNoJoinedTopic(t *testing.T) {
+	c := newRoutingConsumer(t)
+	spans := tracetest.NewSpanRecorder()
+	c.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)).Tracer("test")
+	reader := sdkmetric.NewManualReader()
+	metrics, err := telemetry.NewMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.metrics = metrics
+
+	o := c.reader.Config().Logger.(*groupObserver)
+	printKafkaGoLog(o, "join")
+	printKafkaGoLog(o, "assign")
+	_, commitMixed := c.startSettle(t.Context(), []kafka.Message{{Topic: "orders"}, {Topic: "payments"}})
+	commitMixed.End()
+	_, commitPayments := c.startSettle(t.Context(), []kafka.Message{{Topic: "payments"}, {Topic: "payments"}})
+	commitPayments.End()
+
+	ended := spans.Ended()
+	if names := spanNames(ended); !slices.Equal(names, []string{"rebalance test-group", "commit test-group", "commit payments"}) {
+		t.Fatalf("ended spans = %v, want group-wide spans named after the group", names)
+	}
+	for _, span := range ended[:2] {
+		for _, a := range span.Attributes() {
+			if a.Key == semconv.MessagingDestinationNameKey {
+				t.Errorf("%s has destination %q, want none", span.Name(), a.Value.AsString())
+			}
+		}
+	}
+	if !hasAttr(ended[2], semconv.MessagingDestinationName("payments")) {
+		t.Errorf("commit payments attributes = %v, want its topic", ended[2].Attributes())
+	}
+
+	sum, _ := collect(t, reader, "consumer_rebalance_events_total").(metricdata.Sum[int64])
+	var topics []string
+	for _, p := range sum.DataPoints {
+		if event, _ := p.Attributes.Value("event"); event.AsString() == "join" {
+			topic, _ := p.Attributes.Value("topic")
+			topics = append(topics, topic.AsString())
+		}
+	}
+	slices.Sort(topics)
+	if !slices.Equal(topics, []string{"orders", "payments"}) {
+		t.Errorf("join events counted for topics %v, want each subscribed topic", topics)
+	}
+}
@@ -0,0 +1,96 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const seekTimeout = 10 * time.Second
+
+type startPosition func(ctx context.Context, brokers []string, topic string) (map[int]int64, error)
+
+// WithStartAt starts every partition at the first message produced at or
+// after t. Start options only apply to partitions the group never committed.
+func WithStartAt(t time.Time) ConsumerOption {
+	return func(c *Consumer) {
+		c.start = func(ctx context.Context, brokers []string, topic string) (map[int]int64, error) {
+			return OffsetsAt(ctx, brokers, topic, t)
+		}
+	}
+}
+
+// WithStartOffsets starts each partition in offsets at the given offset.
+func WithStartOffsets(offsets map[int]int64) ConsumerOption {
+	offsets = maps.Clone(offsets)
+	return func(c *Consumer) {
+		c.start = func(context.Context, []string, string) (map[int]int64, error) {
+			return offsets, nil
+		}
+	}
+}
+
+// WithStartFromGroup starts at the offsets committed by groupID.
+func WithStartFromGroup(groupID string) ConsumerOption {
+	return func(c *Consumer) {
+		c.start = func(ctx context.Context, brokers []string, topic string) (map[int]int64, error) {
+			return committedOffsets(ctx, brokers, groupID, topic)
+		}
+	}
+}
+
+func uncommittedOffsets(own, start map[int]int64) map[int]int64 {
+	maps.DeleteFunc(start, func(partition int, _ int64) bool {
+		_, ok := own[partition]
+		return ok
+	})
+	return start
+}
+
+// WithStartAtLatest skips every message already in the topic.
+func WithStartAtLatest() ConsumerOption {
+	return func(c *Consumer) { c.start = LatestOffsets }
+}
+
+// WithoutCommit never commits offsets, e.g. when replaying a topic.
+func WithoutCommit() ConsumerOption {
+	return func(c *Consumer) { c.noCommit = true }
+}
+
+// seek commits the start position of the partitions the group never
+// committed, before the reader joins the group.
+func (c *Consumer) seek(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, seekTimeout)
+	defer cancel()
+
+	brokers := c.config.Brokers
+	for _, topic := range c.topics {
+		own, err := committedOffsets(ctx, brokers, c.groupID, topic)
+		if err != nil {
+			return fmt.Errorf("failed to seek %s: %w", topic, err)
+		}
+		start, err := c.start(ctx, brokers, topic)
+		if err != nil {
+			return fmt.Errorf("failed to resolve start offsets of %s: %w", topic, err)
+		}
+		offsets := uncommittedOffsets(own, start)
+		if len(offsets) == 0 {
+			continue
+		}
+		err = commitOffsets(ctx, brokers, c.groupID, topic, offsets)
+		if errors.Is(err, kafka.UnknownMemberId) || errors.Is(err, kafka.IllegalGeneration) || errors.Is(err, kafka.RebalanceInProgress) {
+			c.log.Warn("group already has members, keeping its offsets", zap.String("topic", topic), zap.Error(err))
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to seek %s: %w", topic, err)
+		}
+	}
+	return nil
+}
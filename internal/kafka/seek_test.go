@@ -0,0 +1,62 @@
+package kafka
+
+import (
+	"context"
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestWithStartOffsetsKeepsItsOwnCopy(t *testing.T) {
+	offsets := map[int]int64{0: 10, 1: 20}
+	c, _ := newTestConsumer(t, WithStartOffsets(offsets))
+	offsets[0] = 0
+
+	for _, topic := range []string{"orders", "payments"} {
+		got, err := c.start(context.Background(), nil, topic)
+		if err != nil || !maps.Equal(got, map[int]int64{0: 10, 1: 20}) {
+			t.Errorf("start offsets of %s = %v, %v, want the ones given", topic, got, err)
+		}
+	}
+}
+
+func TestWithoutCommit(t *testing.T) {
+	c, spans := newTestConsumer(t, WithoutCommit())
+
+	// The reader is never reached: committing would fail to connect.
+	if err := c.commit(t.Context(), kafka.Message{Topic: "orders", Offset: 1}); err != nil {
+		t.Errorf("commit = %v, want nothing committed", err)
+	}
+	if n := commitSpans(spans); n != 0 {
+		t.Errorf("%d commit spans, want none", n)
+	}
+}
+
+func TestUncommittedOffsets(t *testing.T) {
+	own := map[int]int64{0: 30}
+	start := map[int]int64{0: 10, 1: 20}
+	if got := uncommittedOffsets(own, start); !maps.Equal(got, map[int]int64{1: 20}) {
+		t.Errorf("uncommittedOffsets = %v, want partition 1 only", got)
+	}
+	if got := uncommittedOffsets(map[int]int64{0: 1, 1: 2}, map[int]int64{0: 10, 1: 20}); len(got) != 0 {
+		t.Errorf("uncommittedOffsets = %v, want nothing once every partition was committed", got)
+	}
+}
+
+func TestStartPositionDelaysTheReader(t *testing.T) {
+	c, _ := newTestConsumer(t, WithStartAtLatest())
+	if c.reader != nil {
+		t.Fatal("reader joined the group before the seek")
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+	if err := c.Listen(ctx, func(context.Context, Message) error { return nil }); err == nil {
+		t.Fatal("Listen = nil, want the seek error")
+	}
+	if c.reader != nil {
+		t.Error("reader opened although the seek failed")
+	}
+}
@@ -0,0 +1,86 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDrainTimeout = 30 * time.Second
+	cancelWait          = 5 * time.Second
+)
+
+var ErrDrainTimeout = errors.New("consumer drain deadline exceeded")
+
+// WithDrainTimeout bounds how long Listen waits for in-flight handlers.
+func WithDrainTimeout(d time.Duration) ConsumerOption {
+	return func(c *Consumer) { c.drainTimeout = d }
+}
+
+func (c *Consumer) shutdown(done <-chan error, cancelWork context.CancelFunc) error {
+	name, destination := c.destination(c.topics...)
+	_, span := c.tracer.Start(context.Background(), fmt.Sprintf("shutdown %s", name),
+		trace.WithAttributes(destination...),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			attribute.String("messaging.kafka.consumer.group", c.groupID),
+			attribute.String("messaging.kafka.drain_timeout", c.drainTimeout.String()),
+		),
+	)
+	defer span.End()
+
+	log := c.log.With(zap.Strings("topics", c.topics), zap.String("consumer_group", c.groupID))
+	log.Info("consumer stopped fetching, draining in-flight handlers", zap.Duration("drain_timeout", c.drainTimeout))
+	span.AddEvent("fetching stopped")
+
+	timer := time.NewTimer(c.drainTimeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case err = <-done:
+		log.Info("in-flight handlers drained")
+		span.AddEvent("in-flight handlers drained")
+	case <-timer.C:
+		cancelWork()
+		err = ErrDrainTimeout
+		log.Error("drain deadline exceeded, in-flight handlers cancelled")
+		span.AddEvent("drain deadline exceeded")
+
+		select {
+		case <-done:
+			span.AddEvent("cancelled handlers returned")
+		case <-time.After(cancelWait):
+			log.Error("cancelled handlers did not return, closing reader anyway", zap.Duration("wait", cancelWait))
+			span.AddEvent("cancelled handlers did not return")
+		}
+	}
+
+	log.Info("flushing pending commits and closing reader")
+	span.AddEvent("flushing commits")
+	for _, cons := range append([]*Consumer{c}, c.retryTiers...) {
+		if closeErr := cons.closeReader(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close reader: %w", closeErr)
+		}
+	}
+	span.AddEvent("reader closed")
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Error("consumer shut down with error", zap.Error(err))
+		return err
+	}
+
+	span.SetStatus(codes.Ok, "")
+	log.Info("consumer shut down")
+	return nil
+}
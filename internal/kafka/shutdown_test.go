@@ -0,0 +1,55 @@
+package kafka
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShutdownDrained(t *testing.T) {
+	c, _ := newTestConsumer(t, WithDrainTimeout(time.Second))
+	done := make(chan error, 1)
+	done <- nil
+
+	var cancelled atomic.Bool
+	if err := c.shutdown(done, func() { cancelled.Store(true) }); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if cancelled.Load() {
+		t.Fatal("handlers cancelled although they drained in time")
+	}
+}
+
+func TestShutdownReturnsLoopError(t *testing.T) {
+	c, _ := newTestConsumer(t)
+	done := make(chan error, 1)
+	loopErr := errors.New("fetch failed")
+	done <- loopErr
+
+	if err := c.shutdown(done, func() {}); !errors.Is(err, loopErr) {
+		t.Fatalf("shutdown = %v, want %v", err, loopErr)
+	}
+}
+
+func TestShutdownWaitsForCancelledLoops(t *testing.T) {
+	c, _ := newTestConsumer(t, WithDrainTimeout(10*time.Millisecond))
+	done := make(chan error, 1)
+
+	var returned atomic.Bool
+	cancelWork := func() {
+		// The loops notice the cancellation and commit what they finished.
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			returned.Store(true)
+			done <- nil
+		}()
+	}
+
+	if err := c.shutdown(done, cancelWork); !errors.Is(err, ErrDrainTimeout) {
+		t.Fatalf("shutdown = %v, want ErrDrainTimeout", err)
+	}
+	if !returned.Load() {
+		t.Fatal("reader closed before the cancelled loops returned")
+	}
+}
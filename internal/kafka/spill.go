@@ -0,0 +1,503 @@
+package kafka
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	spillSegmentBytes  = 8 << 20
+	spillDrainInterval = time.Second
+	spillDrainBatch    = 100
+	spillFrameHeader   = 8
+	spillCursorFile    = "cursor"
+	spillSegmentSuffix = ".seg"
+)
+
+// spillReplayAttr marks publishes of the drainer.
+var spillReplayAttr = attribute.Bool("messaging.kafka.spill.replay", true)
+
+// ErrSpillFull is returned when the spill reached its maximum size.
+var ErrSpillFull = errors.New("producer spill is full")
+
+// WithSpill spills messages the broker could not take to dir/<topic>, up to
+// maxBytes, and replays them in order once it is back.
+func WithSpill(dir string, maxBytes int64) ProducerOption {
+	return func(p *Producer) {
+		p.spillDir = dir
+		p.spillMaxBytes = maxBytes
+	}
+}
+
+type spillRecord struct {
+	Key     []byte         `json:"key,omitempty"`
+	Value   []byte         `json:"value,omitempty"`
+	Headers []kafka.Header `json:"headers,omitempty"`
+	Time    time.Time      `json:"time"`
+}
+
+type spillSegment struct {
+	seq  uint64
+	path string
+	size int64
+}
+
+// spill is an append-only log of length- and CRC-prefixed frames.
+type spill struct {
+	dir      string
+	maxBytes int64
+
+	mu       sync.Mutex
+	segments []spillSegment
+	file     *os.File // the last segment, open for appends
+	offset   int64    // the read position in the first segment
+	bytes    int64
+
+	spilled, replayed, dropped int64
+}
+
+func openSpill(dir string, maxBytes int64) (*spill, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spill dir: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spill dir: %w", err)
+	}
+
+	s := &spill{dir: dir, maxBytes: maxBytes}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), spillSegmentSuffix)
+		if !ok {
+			continue
+		}
+		seq, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat spill segment: %w", err)
+		}
+		s.segments = append(s.segments, spillSegment{seq: seq, path: filepath.Join(dir, e.Name()), size: info.Size()})
+	}
+	slices.SortFunc(s.segments, func(a, b spillSegment) int { return cmp.Compare(a.seq, b.seq) })
+
+	if n := len(s.segments); n > 0 {
+		last := &s.segments[n-1]
+		end, err := validSpillEnd(last.path)
+		if err != nil {
+			return nil, err
+		}
+		if end < last.size {
+			if err := os.Truncate(last.path, end); err != nil {
+				return nil, fmt.Errorf("failed to truncate spill segment: %w", err)
+			}
+			last.size = end
+		}
+	}
+	for _, seg := range s.segments {
+		s.bytes += seg.size
+	}
+	s.offset = s.readCursor()
+	return s, nil
+}
+
+func validSpillEnd(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open spill segment: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat spill segment: %w", err)
+	}
+
+	r := bufio.NewReader(f)
+	var end int64
+	for {
+		_, n, err := readSpillFrame(r, info.Size()-end)
+		if err != nil {
+			return end, nil
+		}
+		end += n
+	}
+}
+
+func (s *spill) readCursor() int64 {
+	if len(s.segments) == 0 {
+		return 0
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, spillCursorFile))
+	if err != nil {
+		return 0
+	}
+	seq, offset, ok := strings.Cut(strings.TrimSpace(string(data)), " ")
+	if !ok || seq != strconv.FormatUint(s.segments[0].seq, 10) {
+		return 0
+	}
+	n, err := strconv.ParseInt(offset, 10, 64)
+	if err != nil || n < 0 || n > s.segments[0].size {
+		return 0
+	}
+	return n
+}
+
+func (s *spill) writeCursor() error {
+	if len(s.segments) == 0 {
+		return os.Remove(filepath.Join(s.dir, spillCursorFile))
+	}
+	data := fmt.Sprintf("%d %d\n", s.segments[0].seq, s.offset)
+	return os.WriteFile(filepath.Join(s.dir, spillCursorFile), []byte(data), 0o644)
+}
+
+func (s *spill) pending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.segments) > 0
+}
+
+func (s *spill) append(msg kafka.Message) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() {
+		if err != nil {
+			s.dropped++
+		}
+	}()
+
+	body, err := json.Marshal(spillRecord{Key: msg.Key, Value: msg.Value, Headers: msg.Headers, Time: msg.Time})
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, spillFrameHeader+len(body))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(body)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(body))
+	copy(frame[spillFrameHeader:], body)
+
+	if s.bytes+int64(len(frame)) > s.maxBytes {
+		return ErrSpillFull
+	}
+	if err := s.openSegment(); err != nil {
+		return err
+	}
+	if _, err := s.file.Write(frame); err != nil {
+		return fmt.Errorf("failed to write spill segment: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync spill segment: %w", err)
+	}
+	s.segments[len(s.segments)-1].size += int64(len(frame))
+	s.bytes += int64(len(frame))
+	s.spilled++
+	return nil
+}
+
+func (s *spill) openSegment() error {
+	n := len(s.segments)
+	if s.file != nil && s.segments[n-1].size < spillSegmentBytes {
+		return nil
+	}
+	if n > 0 && s.segments[n-1].size < spillSegmentBytes {
+		f, err := os.OpenFile(s.segments[n-1].path, os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open spill segment: %w", err)
+		}
+		s.file = f
+		return nil
+	}
+
+	var seq uint64
+	if n > 0 {
+		seq = s.segments[n-1].seq + 1
+	}
+	path := filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, spillSegmentSuffix))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create spill segment: %w", err)
+	}
+	if s.file != nil {
+		_ = s.file.Close()
+	}
+	s.file = f
+	s.segments = append(s.segments, spillSegment{seq: seq, path: path})
+	return nil
+}
+
+// next returns up to n messages from the head and the offset to commit.
+func (s *spill) next(n int) ([]kafka.Message, int64, error) {
+	s.mu.Lock()
+	if len(s.segments) == 0 {
+		s.mu.Unlock()
+		return nil, 0, nil
+	}
+	head, offset := s.segments[0], s.offset
+	s.mu.Unlock()
+
+	f, err := os.Open(head.path)
+	if err != nil {
+		return nil, offset, fmt.Errorf("failed to open spill segment: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(io.NewSectionReader(f, offset, head.size-offset))
+	var msgs []kafka.Message
+	for len(msgs) < n {
+		rec, size, err := readSpillFrame(r, head.size-offset)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return msgs, head.size, fmt.Errorf("failed to read spill segment %s: %w", head.path, err)
+		}
+		offset += size
+		msgs = append(msgs, kafka.Message{Key: rec.Key, Value: rec.Value, Headers: rec.Headers, Time: rec.Time})
+	}
+	return msgs, offset, nil
+}
+
+func (s *spill) commit(offset int64, replayed int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.replayed += int64(replayed)
+	s.offset = offset
+	if len(s.segments) == 0 || s.offset < s.segments[0].size {
+		return s.writeCursor()
+	}
+
+	head := s.segments[0]
+	if len(s.segments) == 1 && s.file != nil {
+		_ = s.file.Close()
+		s.file = nil
+	}
+	if err := os.Remove(head.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove spill segment: %w", err)
+	}
+	s.segments = s.segments[1:]
+	s.bytes -= head.size
+	s.offset = 0
+	if err := s.writeCursor(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *spill) counts() (spilled, replayed, dropped, bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.spilled, s.replayed, s.dropped, s.bytes
+}
+
+func (s *spill) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// readSpillFrame reads a frame of at most remaining bytes.
+func readSpillFrame(r io.Reader, remaining int64) (spillRecord, int64, error) {
+	var rec spillRecord
+	var header [spillFrameHeader]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return rec, 0, io.EOF
+		}
+		return rec, 0, err
+	}
+	length := int64(binary.BigEndian.Uint32(header[0:4]))
+	if length > remaining-spillFrameHeader {
+		return rec, 0, fmt.Errorf("truncated spill frame: %d bytes, %d left in the segment", length, remaining-spillFrameHeader)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return rec, 0, fmt.Errorf("truncated spill frame: %w", err)
+	}
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(header[4:8]) {
+		return rec, 0, errors.New("spill frame checksum mismatch")
+	}
+	if err := json.Unmarshal(body, &rec); err != nil {
+		return rec, 0, fmt.Errorf("invalid spill frame: %w", err)
+	}
+	return rec, int64(len(header) + len(body)), nil
+}
+
+// spillable reports whether a later write may succeed.
+func spillable(err error) bool {
+	var werrs kafka.WriteErrors
+	if errors.As(err, &werrs) {
+		for _, e := range werrs {
+			if e != nil && !spillable(e) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var kerr kafka.Error
+	var nerr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return false
+	case errors.As(err, &kerr):
+		return kerr.Temporary()
+	case errors.As(err, &nerr):
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func (p *Producer) openSpill() {
+	if p.spillDir == "" {
+		return
+	}
+	s, err := openSpill(filepath.Join(p.spillDir, p.topic), p.spillMaxBytes)
+	if err != nil {
+		otel.Handle(fmt.Errorf("failed to open producer spill: %w", err))
+		return
+	}
+	p.spill = s
+	p.spillWriter = &kafka.Writer{
+		Addr:         p.writer.Addr,
+		Topic:        p.writer.Topic,
+		Balancer:     p.writer.Balancer,
+		WriteTimeout: p.writer.WriteTimeout,
+		ReadTimeout:  p.writer.ReadTimeout,
+		RequiredAcks: p.writer.RequiredAcks,
+		BatchSize:    spillDrainBatch,
+		BatchTimeout: time.Millisecond,
+		Completion:   replayCompleted,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.spillStop = cancel
+	p.spillDone = make(chan struct{})
+	go p.drainSpill(ctx)
+}
+
+func (p *Producer) drainSpill(ctx context.Context) {
+	defer close(p.spillDone)
+
+	ticker := time.NewTicker(spillDrainInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		p.replaySpill(ctx)
+	}
+}
+
+func (p *Producer) replaySpill(ctx context.Context) {
+	for {
+		msgs, offset, err := p.spill.next(spillDrainBatch)
+		if err != nil {
+			otel.Handle(err)
+		}
+		if len(msgs) == 0 {
+			if err != nil {
+				err = p.spill.commit(offset, 0)
+			}
+			if err != nil {
+				otel.Handle(err)
+			}
+			return
+		}
+		batch := &replayBatch{written: make(map[int]int)}
+		for i := range msgs {
+			msgs[i].WriterData = batch
+		}
+		start := time.Now()
+		err = p.spillWriter.WriteMessages(ctx, msgs...)
+		batch.mu.Lock()
+		written := 0
+		for partition, n := range batch.written {
+			p.recordPublish(ctx, start, n, partition, nil, spillReplayAttr)
+			written += n
+		}
+		batch.mu.Unlock()
+		if err != nil {
+			if ctx.Err() == nil {
+				p.recordPublish(ctx, start, len(msgs)-written, -1, err, spillReplayAttr)
+			}
+			return
+		}
+		if err := p.spill.commit(offset, len(msgs)); err != nil {
+			otel.Handle(err)
+			return
+		}
+	}
+}
+
+type replayBatch struct {
+	mu      sync.Mutex
+	written map[int]int
+}
+
+func replayCompleted(msgs []kafka.Message, err error) {
+	if err != nil || len(msgs) == 0 {
+		return
+	}
+	batch, ok := msgs[0].WriterData.(*replayBatch)
+	if !ok {
+		return
+	}
+	batch.mu.Lock()
+	defer batch.mu.Unlock()
+	for _, msg := range msgs {
+		batch.written[msg.Partition]++
+	}
+}
+
+func (p *Producer) spillMessage(d *delivery, msg kafka.Message, cause error) {
+	if err := p.spill.append(msg); err != nil {
+		p.deliver(d, errors.Join(cause, err))
+		return
+	}
+	opts := []trace.EventOption{trace.WithAttributes(attribute.String("messaging.kafka.spill.dir", p.spill.dir))}
+	if cause != nil {
+		opts = append(opts, trace.WithAttributes(attribute.String("error.message", cause.Error())))
+	}
+	d.span.AddEvent("message spilled", opts...)
+	d.settle(nil)
+}
+
+func (p *Producer) closeSpill() error {
+	if p.spill == nil {
+		return nil
+	}
+	p.spillStop()
+	<-p.spillDone
+	return errors.Join(p.spillWriter.Close(), p.spill.close())
+}
@@ -0,0 +1,459 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// testMetricReader installs a global meter provider once per test binary:
+// instruments are created once, so they stay bound to the first provider.
+var testMetricReader = sync.OnceValue(func() *sdkmetric.ManualReader {
+	r := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(r)))
+	return r
+})
+
+// metricSum adds up the int64 data points of the metric name whose attributes
+// match, and reports whether there was any.
+func metricSum(t *testing.T, name string, match func(attribute.Set) bool) (int64, bool) {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := testMetricReader().Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	var sum int64
+	found := false
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			var points []metricdata.DataPoint[int64]
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				points = data.DataPoints
+			case metricdata.Gauge[int64]:
+				points = data.DataPoints
+			}
+			for _, p := range points {
+				if match(p.Attributes) {
+					sum += p.Value
+					found = true
+				}
+			}
+		}
+	}
+	return sum, found
+}
+
+func spillMessages(n int) []kafka.Message {
+	msgs := make([]kafka.Message, n)
+	for i := range msgs {
+		msgs[i] = kafka.Message{
+			Key:     fmt.Appendf(nil, "k-%d", i),
+			Value:   fmt.Appendf(nil, "v-%d", i),
+			Headers: []kafka.Header{{Key: HeaderMessageID, Value: fmt.Appendf(nil, "m-%d", i)}},
+		}
+	}
+	return msgs
+}
+
+func openTestSpill(t *testing.T, dir string, maxBytes int64) *spill {
+	t.Helper()
+	s, err := openSpill(dir, maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.close() })
+	return s
+}
+
+func appendAll(t *testing.T, s *spill, msgs []kafka.Message) {
+	t.Helper()
+	for _, msg := range msgs {
+		if err := s.append(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func assertValues(t *testing.T, got []kafka.Message, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d messages, want %d", len(got), len(want))
+	}
+	for i, msg := range got {
+		if string(msg.Value) != want[i] {
+			t.Errorf("message %d = %q, want %q", i, msg.Value, want[i])
+		}
+	}
+}
+
+func TestSpillReplaysInOrder(t *testing.T) {
+	s := openTestSpill(t, t.TempDir(), 1<<20)
+	appendAll(t, s, spillMessages(3))
+
+	msgs, offset, err := s.next(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertValues(t, msgs, "v-0", "v-1")
+	if string(msgs[0].Key) != "k-0" || headerValue(msgs[0].Headers, HeaderMessageID) != "m-0" {
+		t.Errorf("message 0 = %+v, want its key and headers kept", msgs[0])
+	}
+
+	// Until committed, the same messages are read again.
+	again, _, _ := s.next(2)
+	assertValues(t, again, "v-0", "v-1")
+
+	if err := s.commit(offset, len(msgs)); err != nil {
+		t.Fatal(err)
+	}
+	msgs, offset, err = s.next(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertValues(t, msgs, "v-2")
+	if err := s.commit(offset, len(msgs)); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.pending() {
+		t.Error("spill still pending after replaying everything")
+	}
+	spilled, replayed, dropped, bytes := s.counts()
+	if spilled != 3 || replayed != 3 || dropped != 0 || bytes != 0 {
+		t.Errorf("counts = %d spilled, %d replayed, %d dropped, %d bytes", spilled, replayed, dropped, bytes)
+	}
+	entries, _ := os.ReadDir(s.dir)
+	if len(entries) != 0 {
+		t.Errorf("spill dir still holds %d files", len(entries))
+	}
+}
+
+func TestSpillResumesAtCursor(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestSpill(t, dir, 1<<20)
+	appendAll(t, s, spillMessages(3))
+
+	msgs, offset, err := s.next(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.commit(offset, len(msgs)); err != nil {
+		t.Fatal(err)
+	}
+	_ = s.close()
+
+	reopened := openTestSpill(t, dir, 1<<20)
+	msgs, _, err = reopened.next(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertValues(t, msgs, "v-1", "v-2")
+}
+
+func TestSpillTruncatesTornFrame(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestSpill(t, dir, 1<<20)
+	appendAll(t, s, spillMessages(2))
+	_, _, _, size := s.counts()
+	segment := s.segments[0].path
+	_ = s.close()
+
+	// A crash halfway through a third frame.
+	f, err := os.OpenFile(segment, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte{0, 0, 1, 0, 1, 2})
+	_ = f.Close()
+
+	reopened := openTestSpill(t, dir, 1<<20)
+	if _, _, _, bytes := reopened.counts(); bytes != size {
+		t.Errorf("bytes after reopening = %d, want %d", bytes, size)
+	}
+	msgs, _, err := reopened.next(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertValues(t, msgs, "v-0", "v-1")
+
+	// New frames follow the last whole one.
+	appendAll(t, reopened, spillMessages(3)[2:])
+	msgs, _, err = reopened.next(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertValues(t, msgs, "v-0", "v-1", "v-2")
+}
+
+func TestSpillSkipsCorruptSegment(t *testing.T) {
+	s := openTestSpill(t, t.TempDir(), 1<<20)
+	appendAll(t, s, spillMessages(2))
+
+	// Flip a byte of the first frame's body.
+	data, _ := os.ReadFile(s.segments[0].path)
+	data[spillFrameHeader] ^= 0xff
+	if err := os.WriteFile(s.segments[0].path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, offset, err := s.next(10)
+	if err == nil {
+		t.Fatal("next read a corrupt frame without error")
+	}
+	if len(msgs) != 0 || offset != s.segments[0].size {
+		t.Errorf("next = %d messages up to %d, want none up to the segment end %d", len(msgs), offset, s.segments[0].size)
+	}
+}
+
+func TestSpillRejectsFrameLongerThanSegment(t *testing.T) {
+	// A corrupt header claiming a 4 GiB frame in front of a 2-byte body.
+	frame := []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 1, 2}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, _, err := readSpillFrame(bytes.NewReader(frame), int64(len(frame)))
+	runtime.ReadMemStats(&after)
+	if err == nil {
+		t.Fatal("readSpillFrame accepted a frame longer than the segment")
+	}
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("%d bytes allocated, want the body never allocated", n)
+	}
+
+	dir := t.TempDir()
+	s := openTestSpill(t, dir, 1<<20)
+	appendAll(t, s, spillMessages(1))
+	segment := s.segments[0].path
+	_ = s.close()
+	f, err := os.OpenFile(segment, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write(frame)
+	_ = f.Close()
+
+	msgs, _, err := openTestSpill(t, dir, 1<<20).next(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertValues(t, msgs, "v-0")
+}
+
+func TestSpillFull(t *testing.T) {
+	s := openTestSpill(t, t.TempDir(), 1<<20)
+	msgs := spillMessages(2)
+	appendAll(t, s, msgs[:1])
+	_, _, _, size := s.counts()
+
+	s.maxBytes = size + size/2
+	if err := s.append(msgs[1]); !errors.Is(err, ErrSpillFull) {
+		t.Fatalf("append = %v, want %v", err, ErrSpillFull)
+	}
+	spilled, _, dropped, bytes := s.counts()
+	if spilled != 1 || dropped != 1 || bytes != size {
+		t.Errorf("counts = %d spilled, %d dropped, %d bytes, want 1, 1, %d", spilled, dropped, bytes, size)
+	}
+}
+
+func TestSpillable(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{refused, true},
+		{fmt.Errorf("failed to dial: %w", refused), true},
+		{kafka.LeaderNotAvailable, true},
+		{kafka.NotEnoughReplicas, true},
+		{kafka.RequestTimedOut, true},
+		{io.EOF, true},
+		{context.DeadlineExceeded, true},
+		{kafka.MessageSizeTooLarge, false},
+		{kafka.TopicAuthorizationFailed, false},
+		{context.Canceled, false},
+		{errors.New("serialization failed"), false},
+		{kafka.WriteErrors{nil, kafka.LeaderNotAvailable, refused}, true},
+		{kafka.WriteErrors{kafka.LeaderNotAvailable, kafka.MessageSizeTooLarge}, false},
+	}
+	for _, tt := range tests {
+		if got := spillable(tt.err); got != tt.want {
+			t.Errorf("spillable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestProducerSpillsWhileBrokerIsDown(t *testing.T) {
+	for _, async := range []bool{false, true} {
+		t.Run(fmt.Sprintf("async=%v", async), func(t *testing.T) {
+			var opts []ProducerOption
+			if async {
+				opts = append(opts, WithAsync(10, 1, 0))
+			}
+			p := newCapturingProducer(t, opts...)
+
+			for i := range 3 {
+				if err := p.Publish(context.Background(), fmt.Sprint(i), map[string]int{"n": i}); err != nil {
+					t.Fatalf("Publish %d = %v, want it spilled", i, err)
+				}
+			}
+			msgs := published(t, p)
+			assertValues(t, msgs, `{"n":0}`, `{"n":1}`, `{"n":2}`)
+		})
+	}
+}
+
+func TestProducerSpillFullFailsPublish(t *testing.T) {
+	p := newCapturingProducer(t)
+	p.spill.maxBytes = 1
+
+	err := p.Publish(context.Background(), "k", map[string]int{"n": 1})
+	if !errors.Is(err, ErrSpillFull) {
+		t.Errorf("Publish = %v, want %v", err, ErrSpillFull)
+	}
+	var nerr net.Error
+	if !errors.As(err, &nerr) {
+		t.Errorf("Publish = %v, want the write error kept", err)
+	}
+}
+
+func TestSpilledMessagesAreCountedWhenReplayed(t *testing.T) {
+	testMetricReader()
+	topic := func(a attribute.Set) bool {
+		v, _ := a.Value(semconv.MessagingDestinationNameKey)
+		return v.AsString() == "orders"
+	}
+	replay := func(a attribute.Set) bool {
+		v, ok := a.Value(spillReplayAttr.Key)
+		return ok && v.AsBool()
+	}
+	sent := func() (first, replayed int64) {
+		first, _ = metricSum(t, "messaging.client.sent.messages", func(a attribute.Set) bool { return topic(a) && !replay(a) })
+		replayed, _ = metricSum(t, "messaging.client.sent.messages", func(a attribute.Set) bool { return topic(a) && replay(a) })
+		return first, replayed
+	}
+
+	p := newCapturingProducer(t)
+	// Replay by hand, so the drainer does not race with the test.
+	p.spillStop()
+	<-p.spillDone
+	p.spillWriter.MaxAttempts = 1
+
+	firstBefore, replayedBefore := sent()
+	for i := range 2 {
+		if err := p.Publish(context.Background(), fmt.Sprint(i), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if first, _ := sent(); first != firstBefore {
+		t.Errorf("spilled messages counted as sent: %d, want %d", first, firstBefore)
+	}
+
+	p.replaySpill(context.Background())
+	if _, replayed := sent(); replayed != replayedBefore+2 {
+		t.Errorf("replayed sent messages = %d, want %d", replayed, replayedBefore+2)
+	}
+	failed, _ := metricSum(t, "messaging.client.sent.messages", func(a attribute.Set) bool {
+		_, hasError := a.Value(semconv.ErrorTypeKey)
+		return topic(a) && replay(a) && hasError
+	})
+	if failed < 2 {
+		t.Errorf("failed replays = %d, want the failed write recorded", failed)
+	}
+	if msgs := published(t, p); len(msgs) != 2 {
+		t.Errorf("spill holds %d messages after a failed replay, want 2", len(msgs))
+	}
+
+	if _, ok := metricSum(t, "kafka_writer_writes_total", func(a attribute.Set) bool {
+		v, _ := a.Value("writer")
+		return v.AsString() == "spill"
+	}); !ok {
+		t.Error("the spill writer reports no stats")
+	}
+}
+
+func TestSpillDrainsInOrderWhenBrokerIsBack(t *testing.T) {
+	p := newCapturingProducer(t)
+	p.spillStop()
+	<-p.spillDone
+
+	for i := range 2 {
+		if err := p.Publish(context.Background(), fmt.Sprint(i), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Until the spill is drained, new messages queue up behind it. One
+	// partition keeps the order of all of them comparable.
+	b := newFakeBroker(1)
+	b.connect(p)
+	p.spillWriter.BatchTimeout = time.Millisecond
+	p.writer.BatchTimeout = time.Millisecond
+	if err := p.Publish(context.Background(), "2", 2); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := b.received(); len(msgs) != 0 {
+		t.Fatalf("broker received %d messages ahead of the spill", len(msgs))
+	}
+
+	testMetricReader()
+	replayedTo0 := func() int64 {
+		n, _ := metricSum(t, "messaging.client.sent.messages", func(a attribute.Set) bool {
+			replay, _ := a.Value(spillReplayAttr.Key)
+			partition, _ := a.Value(semconv.MessagingDestinationPartitionIDKey)
+			return replay.AsBool() && partition.AsString() == "0"
+		})
+		return n
+	}
+	before := replayedTo0()
+
+	p.replaySpill(context.Background())
+	assertValues(t, b.received(), "0", "1", "2")
+	if n := replayedTo0() - before; n != 3 {
+		t.Errorf("%d replayed messages counted on partition 0, want 3", n)
+	}
+	if p.spill.pending() {
+		t.Error("spill still pending after it was replayed")
+	}
+	if msgs := b.received(); headerValue(msgs[0].Headers, HeaderMessageID) == "" {
+		t.Errorf("replayed headers = %q, want the envelope kept", msgs[0].Headers)
+	}
+
+	if err := p.Publish(context.Background(), "3", 3); err != nil {
+		t.Fatal(err)
+	}
+	assertValues(t, b.received(), "0", "1", "2", "3")
+	if msgs := published(t, p); len(msgs) != 0 {
+		t.Errorf("%d messages spilled once the broker was back", len(msgs))
+	}
+}
+
+func TestOpenSpillPerTopic(t *testing.T) {
+	dir := t.TempDir()
+	p := NewProducer([]string{"127.0.0.1:1"}, "payments", WithSpill(dir, 1<<20))
+	defer p.Close()
+
+	if p.spill == nil || p.spill.dir != filepath.Join(dir, "payments") {
+		t.Fatalf("spill = %+v, want one in %s", p.spill, filepath.Join(dir, "payments"))
+	}
+}
@@ -0,0 +1,437 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Reader.Stats and Writer.Stats reset their counters on every call, so the
+// observers keep running totals.
+
+type readerInstruments struct {
+	meter                           metric.Meter
+	dials, fetches, messages, bytes metric.Int64ObservableCounter
+	rebalances, timeouts, errors    metric.Int64ObservableCounter
+	commits                         metric.Int64ObservableCounter
+	lag, queueLength, fetchSize     metric.Int64ObservableGauge
+	dialTime, readTime, waitTime    metric.Float64ObservableGauge
+}
+
+type writerInstruments struct {
+	meter                                    metric.Meter
+	writes, messages, bytes, errors, retries metric.Int64ObservableCounter
+	batchSize, batchBytes                    metric.Int64ObservableGauge
+	batchTime, batchQueueTime, writeTime     metric.Float64ObservableGauge
+	waitTime                                 metric.Float64ObservableGauge
+	queueDepth                               metric.Int64ObservableGauge
+	dropped                                  metric.Int64ObservableCounter
+	spilled, spillReplayed, spillDropped     metric.Int64ObservableCounter
+	spillBytes                               metric.Int64ObservableGauge
+}
+
+var (
+	readerInstrumentsOnce = sync.OnceValues(func() (*readerInstruments, error) {
+		return newReaderInstruments(otel.Meter("kafka/consumer"))
+	})
+	writerInstrumentsOnce = sync.OnceValues(func() (*writerInstruments, error) {
+		return newWriterInstruments(otel.Meter("kafka/producer"))
+	})
+)
+
+type instrumentFactory struct {
+	meter metric.Meter
+	errs  []error
+}
+
+func (f *instrumentFactory) counter(name, desc, unit string) metric.Int64ObservableCounter {
+	c, err := f.meter.Int64ObservableCounter(name, metric.WithDescription(desc), metric.WithUnit(unit))
+	f.errs = append(f.errs, err)
+	return c
+}
+
+func (f *instrumentFactory) gauge(name, desc, unit string) metric.Int64ObservableGauge {
+	g, err := f.meter.Int64ObservableGauge(name, metric.WithDescription(desc), metric.WithUnit(unit))
+	f.errs = append(f.errs, err)
+	return g
+}
+
+func (f *instrumentFactory) seconds(name, desc string) metric.Float64ObservableGauge {
+	g, err := f.meter.Float64ObservableGauge(name, metric.WithDescription(desc), metric.WithUnit("s"))
+	f.errs = append(f.errs, err)
+	return g
+}
+
+func newReaderInstruments(meter metric.Meter) (*readerInstruments, error) {
+	f := &instrumentFactory{meter: meter}
+	i := &readerInstruments{
+		meter:       meter,
+		dials:       f.counter("kafka_reader_dials_total", "Connections opened by the Kafka reader", "{dial}"),
+		fetches:     f.counter("kafka_reader_fetches_total", "Fetch requests sent by the Kafka reader", "{fetch}"),
+		messages:    f.counter("kafka_reader_messages_total", "Messages read by the Kafka reader", "{message}"),
+		bytes:       f.counter("kafka_reader_bytes_total", "Message bytes read by the Kafka reader", "By"),
+		rebalances:  f.counter("kafka_reader_rebalances_total", "Consumer group rebalances seen by the Kafka reader", "{rebalance}"),
+		timeouts:    f.counter("kafka_reader_timeouts_total", "Fetch timeouts of the Kafka reader", "{timeout}"),
+		errors:      f.counter("kafka_reader_errors_total", "Errors returned by the Kafka reader", "{error}"),
+		commits:     f.counter("kafka_reader_commits_total", "Offset commits requested by the consumer", "{commit}"),
+		lag:         f.gauge("kafka_consumer_lag", "Messages between the last fetched offset and the partition high watermark", "{message}"),
+		queueLength: f.gauge("kafka_reader_queue_length", "Messages fetched and waiting to be handled", "{message}"),
+		fetchSize:   f.gauge("kafka_reader_fetch_size", "Messages returned per fetch", "{message}"),
+		dialTime:    f.seconds("kafka_reader_dial_seconds", "Time to open a connection to the broker"),
+		readTime:    f.seconds("kafka_reader_read_seconds", "Time to read a fetch response"),
+		waitTime:    f.seconds("kafka_reader_wait_seconds", "Time waiting for a fetch response"),
+	}
+	return i, errors.Join(f.errs...)
+}
+
+func newWriterInstruments(meter metric.Meter) (*writerInstruments, error) {
+	f := &instrumentFactory{meter: meter}
+	i := &writerInstruments{
+		meter:          meter,
+		writes:         f.counter("kafka_writer_writes_total", "Produce requests sent by the Kafka writer", "{write}"),
+		messages:       f.counter("kafka_writer_messages_total", "Messages written by the Kafka writer", "{message}"),
+		bytes:          f.counter("kafka_writer_bytes_total", "Message bytes written by the Kafka writer", "By"),
+		errors:         f.counter("kafka_writer_errors_total", "Errors returned by the Kafka writer", "{error}"),
+		retries:        f.counter("kafka_writer_retries_total", "Produce retries of the Kafka writer", "{retry}"),
+		batchSize:      f.gauge("kafka_writer_batch_size", "Messages per produced batch", "{message}"),
+		batchBytes:     f.gauge("kafka_writer_batch_bytes", "Bytes per produced batch", "By"),
+		batchTime:      f.seconds("kafka_writer_batch_seconds", "Time to fill a batch"),
+		batchQueueTime: f.seconds("kafka_writer_batch_queue_seconds", "Time a batch waits before being written"),
+		writeTime:      f.seconds("kafka_writer_write_seconds", "Time to write a batch to the broker"),
+		waitTime:       f.seconds("kafka_writer_wait_seconds", "Time waiting for the broker acknowledgement"),
+		queueDepth:     f.gauge("kafka_producer_queue_depth", "Messages queued by an async producer and not yet acknowledged", "{message}"),
+		dropped:        f.counter("kafka_producer_dropped_total", "Messages rejected because the async producer queue was full", "{message}"),
+		spilled:        f.counter("kafka_producer_spilled_total", "Messages written to the disk spill because the broker was unavailable", "{message}"),
+		spillReplayed:  f.counter("kafka_producer_spill_replayed_total", "Spilled messages published once the broker was back", "{message}"),
+		spillDropped:   f.counter("kafka_producer_spill_dropped_total", "Messages lost because the disk spill was full or could not be written", "{message}"),
+		spillBytes:     f.gauge("kafka_producer_spill_bytes", "Bytes of the disk spill segments", "By"),
+	}
+	return i, errors.Join(f.errs...)
+}
+
+var (
+	statAvg = attribute.String("stat", "avg")
+	statMax = attribute.String("stat", "max")
+)
+
+type readerStats struct {
+	reader       *kafka.Reader
+	groupID      string
+	attrs        []attribute.KeyValue
+	registration metric.Registration
+
+	mu      sync.Mutex
+	totals  kafka.ReaderStats
+	commits int64
+	lag     map[topicPartition]partitionLag
+}
+
+type partitionLag struct {
+	offset, highWaterMark int64
+}
+
+// lagRefreshInterval is how often the lag of a paused consumer is refreshed.
+const lagRefreshInterval = 15 * time.Second
+
+func (c *Consumer) registerStats() {
+	instruments, err := readerInstrumentsOnce()
+	if err != nil {
+		otel.Handle(err)
+		return
+	}
+
+	s := &readerStats{
+		reader:  c.reader,
+		groupID: c.groupID,
+		attrs:   []attribute.KeyValue{attribute.String("consumer_group", c.groupID)},
+		lag:     make(map[topicPartition]partitionLag),
+	}
+	if len(c.topics) == 1 {
+		s.attrs = append(s.attrs, attribute.String("topic", c.topics[0]))
+	}
+
+	i := instruments
+	s.registration, err = i.meter.RegisterCallback(
+		func(_ context.Context, o metric.Observer) error {
+			s.observe(i, o)
+			return nil
+		},
+		i.dials, i.fetches, i.messages, i.bytes, i.rebalances, i.timeouts, i.errors, i.commits,
+		i.lag, i.queueLength, i.fetchSize, i.dialTime, i.readTime, i.waitTime,
+	)
+	if err != nil {
+		otel.Handle(err)
+		return
+	}
+	c.stats = s
+}
+
+func (s *readerStats) fetched(msg kafka.Message) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lag[topicPartition{topic: msg.Topic, partition: msg.Partition}] = partitionLag{
+		offset:        msg.Offset,
+		highWaterMark: msg.HighWaterMark,
+	}
+}
+
+// assigned forgets the lag of revoked partitions.
+func (s *readerStats) assigned(partitions []topicPartition) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	maps.DeleteFunc(s.lag, func(tp topicPartition, _ partitionLag) bool {
+		return !slices.Contains(partitions, tp)
+	})
+}
+
+func (s *readerStats) refresh(topic string, latest map[int]int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for tp, l := range s.lag {
+		if hwm, ok := latest[tp.partition]; ok && tp.topic == topic {
+			l.highWaterMark = max(l.highWaterMark, hwm)
+			s.lag[tp] = l
+		}
+	}
+}
+
+func (s *readerStats) lagTopics() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var topics []string
+	for tp := range s.lag {
+		if !slices.Contains(topics, tp.topic) {
+			topics = append(topics, tp.topic)
+		}
+	}
+	slices.Sort(topics)
+	return topics
+}
+
+// watchLag refreshes the lag while the consumer is paused.
+func (c *Consumer) watchLag(ctx context.Context) {
+	if c.stats == nil {
+		return
+	}
+	ticker := time.NewTicker(lagRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !c.flow.state().Paused {
+			continue
+		}
+		c.refreshLag(ctx)
+	}
+}
+
+func (c *Consumer) refreshLag(ctx context.Context) {
+	for _, topic := range c.stats.lagTopics() {
+		latest, err := LatestOffsets(ctx, c.reader.Config().Brokers, topic)
+		if err != nil {
+			if ctx.Err() == nil {
+				c.log.Warn("failed to refresh consumer lag", zap.String("topic", topic), zap.Error(err))
+			}
+			continue
+		}
+		c.stats.refresh(topic, latest)
+	}
+}
+
+func (s *readerStats) committed(n int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commits += int64(n)
+}
+
+func (s *readerStats) observe(i *readerInstruments, o metric.Observer) {
+	stats := s.reader.Stats()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.totals.Dials += stats.Dials
+	s.totals.Fetches += stats.Fetches
+	s.totals.Messages += stats.Messages
+	s.totals.Bytes += stats.Bytes
+	s.totals.Rebalances += stats.Rebalances
+	s.totals.Timeouts += stats.Timeouts
+	s.totals.Errors += stats.Errors
+
+	attrs := metric.WithAttributes(s.attrs...)
+	o.ObserveInt64(i.dials, s.totals.Dials, attrs)
+	o.ObserveInt64(i.fetches, s.totals.Fetches, attrs)
+	o.ObserveInt64(i.messages, s.totals.Messages, attrs)
+	o.ObserveInt64(i.bytes, s.totals.Bytes, attrs)
+	o.ObserveInt64(i.rebalances, s.totals.Rebalances, attrs)
+	o.ObserveInt64(i.timeouts, s.totals.Timeouts, attrs)
+	o.ObserveInt64(i.errors, s.totals.Errors, attrs)
+	o.ObserveInt64(i.commits, s.commits, attrs)
+	o.ObserveInt64(i.queueLength, stats.QueueLength, attrs)
+
+	observeSummary(o, i.fetchSize, stats.FetchSize, s.attrs)
+	observeDuration(o, i.dialTime, stats.DialTime, s.attrs)
+	observeDuration(o, i.readTime, stats.ReadTime, s.attrs)
+	observeDuration(o, i.waitTime, stats.WaitTime, s.attrs)
+
+	for tp, l := range s.lag {
+		o.ObserveInt64(i.lag, max(l.highWaterMark-l.offset-1, 0), metric.WithAttributes(
+			attribute.String("topic", tp.topic),
+			attribute.Int("partition", tp.partition),
+			attribute.String("consumer_group", s.groupID),
+		))
+	}
+}
+
+func (s *readerStats) unregister() {
+	if s == nil {
+		return
+	}
+	_ = s.registration.Unregister()
+}
+
+type writerStats struct {
+	writer       *kafka.Writer
+	queue        chan struct{}
+	spill        *spill
+	attrs        []attribute.KeyValue
+	registration metric.Registration
+
+	mu      sync.Mutex
+	totals  kafka.WriterStats
+	dropped int64
+}
+
+func (p *Producer) registerStats() {
+	p.stats = registerWriterStats(p.writer, p.queue, p.spill, attribute.String("topic", p.topic))
+	if p.spillWriter != nil {
+		p.spillStats = registerWriterStats(p.spillWriter, nil, nil,
+			attribute.String("topic", p.topic),
+			attribute.String("writer", "spill"),
+		)
+	}
+}
+
+func registerWriterStats(writer *kafka.Writer, queue chan struct{}, spill *spill, attrs ...attribute.KeyValue) *writerStats {
+	instruments, err := writerInstrumentsOnce()
+	if err != nil {
+		otel.Handle(err)
+		return nil
+	}
+
+	s := &writerStats{
+		writer: writer,
+		queue:  queue,
+		spill:  spill,
+		attrs:  attrs,
+	}
+
+	i := instruments
+	s.registration, err = i.meter.RegisterCallback(
+		func(_ context.Context, o metric.Observer) error {
+			s.observe(i, o)
+			return nil
+		},
+		i.writes, i.messages, i.bytes, i.errors, i.retries,
+		i.batchSize, i.batchBytes, i.batchTime, i.batchQueueTime, i.writeTime, i.waitTime,
+		i.queueDepth, i.dropped, i.spilled, i.spillReplayed, i.spillDropped, i.spillBytes,
+	)
+	if err != nil {
+		otel.Handle(err)
+		return nil
+	}
+	return s
+}
+
+func (s *writerStats) observe(i *writerInstruments, o metric.Observer) {
+	stats := s.writer.Stats()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.totals.Writes += stats.Writes
+	s.totals.Messages += stats.Messages
+	s.totals.Bytes += stats.Bytes
+	s.totals.Errors += stats.Errors
+	s.totals.Retries += stats.Retries
+
+	attrs := metric.WithAttributes(s.attrs...)
+	o.ObserveInt64(i.writes, s.totals.Writes, attrs)
+	o.ObserveInt64(i.messages, s.totals.Messages, attrs)
+	o.ObserveInt64(i.bytes, s.totals.Bytes, attrs)
+	o.ObserveInt64(i.errors, s.totals.Errors, attrs)
+	o.ObserveInt64(i.retries, s.totals.Retries, attrs)
+	if s.queue != nil {
+		o.ObserveInt64(i.queueDepth, int64(len(s.queue)), attrs)
+		o.ObserveInt64(i.dropped, s.dropped, attrs)
+	}
+	if s.spill != nil {
+		spilled, replayed, dropped, bytes := s.spill.counts()
+		o.ObserveInt64(i.spilled, spilled, attrs)
+		o.ObserveInt64(i.spillReplayed, replayed, attrs)
+		o.ObserveInt64(i.spillDropped, dropped, attrs)
+		o.ObserveInt64(i.spillBytes, bytes, attrs)
+	}
+
+	observeSummary(o, i.batchSize, stats.BatchSize, s.attrs)
+	observeSummary(o, i.batchBytes, stats.BatchBytes, s.attrs)
+	observeDuration(o, i.batchTime, stats.BatchTime, s.attrs)
+	observeDuration(o, i.batchQueueTime, stats.BatchQueueTime, s.attrs)
+	observeDuration(o, i.writeTime, stats.WriteTime, s.attrs)
+	observeDuration(o, i.waitTime, stats.WaitTime, s.attrs)
+}
+
+func (s *writerStats) drop(n int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropped += int64(n)
+}
+
+func (s *writerStats) unregister() {
+	if s == nil {
+		return
+	}
+	_ = s.registration.Unregister()
+}
+
+func observeSummary(o metric.Observer, g metric.Int64ObservableGauge, stats kafka.SummaryStats, attrs []attribute.KeyValue) {
+	if stats.Count == 0 {
+		return
+	}
+	o.ObserveInt64(g, stats.Avg, metric.WithAttributes(slices.Concat(attrs, []attribute.KeyValue{statAvg})...))
+	o.ObserveInt64(g, stats.Max, metric.WithAttributes(slices.Concat(attrs, []attribute.KeyValue{statMax})...))
+}
+
+func observeDuration(o metric.Observer, g metric.Float64ObservableGauge, stats kafka.DurationStats, attrs []attribute.KeyValue) {
+	if stats.Count == 0 {
+		return
+	}
+	o.ObserveFloat64(g, stats.Avg.Seconds(), metric.WithAttributes(slices.Concat(attrs, []attribute.KeyValue{statAvg})...))
+	o.ObserveFloat64(g, stats.Max.Seconds(), metric.WithAttributes(slices.Concat(attrs, []attribute.KeyValue{statMax})...))
+}
@@ -0,0 +1,91 @@
+package kafka
+
+import (
+	"maps"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// observedLag returns the kafka_consumer_lag of every partition reported for
+// the test consumer group, keyed by "topic/partition".
+func observedLag(t *testing.T) map[string]int64 {
+	t.Helper()
+	lag := make(map[string]int64)
+	for _, topic := range []string{"orders", "payments", "orders,payments"} {
+		for partition := range 3 {
+			want := attribute.NewSet(
+				attribute.String("topic", topic),
+				attribute.Int("partition", partition),
+				attribute.String("consumer_group", "test-group"),
+			)
+			v, ok := metricSum(t, "kafka_consumer_lag", func(a attribute.Set) bool { return a.Equals(&want) })
+			if ok {
+				lag[partitionNames([]topicPartition{{topic, partition}})[0]] = v
+			}
+		}
+	}
+	return lag
+}
+
+func fetchedAt(topic string, partition int, offset, highWaterMark int64) kafka.Message {
+	return kafka.Message{Topic: topic, Partition: partition, Offset: offset, HighWaterMark: highWaterMark}
+}
+
+func TestLagLabelsEachTopic(t *testing.T) {
+	testMetricReader()
+	c := newConsumer([]string{"127.0.0.1:1"}, []string{"orders", "payments"}, "test-group", nil)
+	defer c.Close()
+
+	c.stats.fetched(fetchedAt("orders", 0, 10, 20))
+	c.stats.fetched(fetchedAt("payments", 0, 5, 6))
+	c.stats.fetched(fetchedAt("orders", 1, 3, 4))
+
+	want := map[string]int64{"orders/0": 9, "orders/1": 0, "payments/0": 0}
+	if got := observedLag(t); !maps.Equal(got, want) {
+		t.Errorf("lag = %v, want %v", got, want)
+	}
+}
+
+func TestLagForgetsRevokedPartitions(t *testing.T) {
+	testMetricReader()
+	c, _ := newTestConsumer(t)
+	o := &groupObserver{c: c}
+
+	c.stats.fetched(fetchedAt("orders", 0, 10, 20))
+	c.stats.fetched(fetchedAt("orders", 1, 10, 30))
+	c.stats.fetched(fetchedAt("orders", 2, 10, 40))
+
+	o.assign([]topicPartition{{"orders", 0}, {"orders", 2}})
+	want := map[string]int64{"orders/0": 9, "orders/2": 29}
+	if got := observedLag(t); !maps.Equal(got, want) {
+		t.Errorf("lag after reassignment = %v, want %v", got, want)
+	}
+
+	o.revoke()
+	if got := observedLag(t); len(got) != 0 {
+		t.Errorf("lag after revoke = %v, want none", got)
+	}
+}
+
+func TestLagRefresh(t *testing.T) {
+	testMetricReader()
+	c := newConsumer([]string{"127.0.0.1:1"}, []string{"orders", "payments"}, "test-group", nil)
+	defer c.Close()
+
+	c.stats.fetched(fetchedAt("orders", 0, 10, 11))
+	c.stats.fetched(fetchedAt("orders", 1, 10, 11))
+	c.stats.fetched(fetchedAt("payments", 0, 10, 11))
+	if topics := c.stats.lagTopics(); len(topics) != 2 || topics[0] != "orders" || topics[1] != "payments" {
+		t.Errorf("lag topics = %v, want [orders payments]", topics)
+	}
+
+	// Messages keep arriving while the consumer is paused.
+	c.stats.refresh("orders", map[int]int64{0: 50, 1: 5})
+	want := map[string]int64{"orders/0": 39, "orders/1": 0, "payments/0": 0}
+	if got := observedLag(t); !maps.Equal(got, want) {
+		t.Errorf("lag = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,205 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// SpanRelation is how consumer spans relate to the producer span.
+type SpanRelation int
+
+const (
+	// ParentProducer continues the producer trace.
+	ParentProducer SpanRelation = iota
+	// LinkProducer starts a new trace per message linked to the producer span.
+	LinkProducer
+)
+
+// WithSpanRelation defaults to ParentProducer.
+func WithSpanRelation(r SpanRelation) ConsumerOption {
+	return func(c *Consumer) { c.spanRelation = r }
+}
+
+// WithSpanAttributes adds attrs to the spans of every message.
+func WithSpanAttributes(attrs ...attribute.KeyValue) ConsumerOption {
+	return func(c *Consumer) { c.spanAttrs = append(c.spanAttrs, attrs...) }
+}
+
+// WithClientID sets the client ID sent to the brokers.
+func WithClientID(id string) ConsumerOption {
+	return func(c *Consumer) { c.clientID = id }
+}
+
+// WithSyncCommits commits every offset before handling the next message.
+func WithSyncCommits() ConsumerOption {
+	return func(c *Consumer) { c.syncCommits = true }
+}
+
+type messageID struct {
+	topicPartition
+	offset int64
+}
+
+func idOf(msg kafka.Message) messageID {
+	return messageID{topicPartition{topic: msg.Topic, partition: msg.Partition}, msg.Offset}
+}
+
+// traceReceive records the fetch of msg as a receive span.
+func (c *Consumer) traceReceive(msg kafka.Message, start time.Time) context.Context {
+	producer := c.producerContext(msg)
+
+	ctx := context.Background()
+	var links []trace.Link
+	if c.spanRelation == ParentProducer {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, producer)
+	} else if producer.IsValid() {
+		links = append(links, trace.Link{SpanContext: producer})
+	}
+
+	m := c.message(msg)
+	ctx, span := c.tracer.Start(ctx, fmt.Sprintf("receive %s", msg.Topic),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(start),
+		trace.WithLinks(links...),
+		trace.WithAttributes(messageAttrs(m)...),
+		trace.WithAttributes(
+			semconv.MessagingOperationTypeReceive,
+			semconv.MessagingOperationName("receive"),
+			attribute.Float64("messaging.queue.duration", m.QueueDuration(time.Now()).Seconds()),
+		),
+		trace.WithAttributes(c.spanAttrs...),
+	)
+	span.End()
+
+	c.receives.Store(idOf(msg), span.SpanContext())
+	return ctx
+}
+
+func (c *Consumer) takeReceive(msg kafka.Message) trace.SpanContext {
+	sc, ok := c.receives.LoadAndDelete(idOf(msg))
+	if !ok {
+		return trace.SpanContext{}
+	}
+	return sc.(trace.SpanContext)
+}
+
+// forgetReceive drops the receive spans of messages that will not be handled.
+func (c *Consumer) forgetReceive(msgs ...kafka.Message) {
+	for _, msg := range msgs {
+		c.receives.Delete(idOf(msg))
+	}
+}
+
+func (c *Consumer) producerContext(msg kafka.Message) trace.SpanContext {
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), &kafkaHeaderCarrier{headers: &msg.Headers})
+	return trace.SpanContextFromContext(ctx)
+}
+
+type (
+	processLinksKey struct{}
+	processAttrsKey struct{}
+)
+
+// handlerContext returns the producer context of msg, with the parent span
+// picked by the span relation.
+func (c *Consumer) handlerContext(ctx context.Context, msg kafka.Message) context.Context {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, &kafkaHeaderCarrier{headers: &msg.Headers})
+	if id := headerValue(msg.Headers, HeaderCorrelationID); id != "" {
+		ctx = ContextWithCorrelationID(ctx, id)
+	}
+	if len(c.spanAttrs) > 0 {
+		ctx = context.WithValue(ctx, processAttrsKey{}, c.spanAttrs)
+	}
+	producer := trace.SpanContextFromContext(ctx)
+	receive := c.takeReceive(msg)
+
+	var link trace.SpanContext
+	switch {
+	case c.spanRelation == ParentProducer:
+		link = receive
+	case receive.IsValid():
+		ctx = trace.ContextWithSpanContext(ctx, receive)
+		link = producer
+	default:
+		ctx = trace.ContextWithSpanContext(ctx, trace.SpanContext{})
+		link = producer
+	}
+
+	if !link.IsValid() {
+		return ctx
+	}
+	return context.WithValue(ctx, processLinksKey{}, []trace.Link{{SpanContext: link}})
+}
+
+func processLinks(ctx context.Context) []trace.Link {
+	links, _ := ctx.Value(processLinksKey{}).([]trace.Link)
+	return links
+}
+
+func processAttrs(ctx context.Context) []attribute.KeyValue {
+	attrs, _ := ctx.Value(processAttrsKey{}).([]attribute.KeyValue)
+	return attrs
+}
+
+// startSettle starts the span of committing msgs.
+func (c *Consumer) startSettle(ctx context.Context, msgs []kafka.Message) (context.Context, trace.Span) {
+	name, destination := c.destination(messageTopics(msgs)...)
+	var links []trace.Link
+	for _, msg := range msgs {
+		if sc := c.producerContext(msg); sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+	if len(msgs) == 1 && c.spanRelation == ParentProducer && len(links) == 1 {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, links[0].SpanContext)
+		links = nil
+	}
+
+	attrs := append([]attribute.KeyValue{
+		semconv.MessagingSystemKafka,
+		semconv.MessagingOperationTypeSettle,
+		semconv.MessagingOperationName("commit"),
+		semconv.MessagingClientID(c.clientID),
+		semconv.MessagingKafkaConsumerGroup(c.groupID),
+		attribute.String("messaging.consumer.group.name", c.groupID),
+		attribute.Bool("messaging.kafka.commit.async", !c.syncCommits),
+	}, destination...)
+	if len(msgs) == 1 {
+		attrs = append(attrs,
+			semconv.MessagingDestinationPartitionID(strconv.Itoa(msgs[0].Partition)),
+			semconv.MessagingKafkaMessageOffset(int(msgs[0].Offset)),
+		)
+	} else {
+		attrs = append(attrs, semconv.MessagingBatchMessageCount(len(msgs)))
+	}
+	attrs = append(attrs, c.spanAttrs...)
+
+	return c.tracer.Start(ctx, fmt.Sprintf("commit %s", name),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithLinks(links...),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+func messageAttrs(msg Message) []attribute.KeyValue {
+	return append([]attribute.KeyValue{
+		semconv.MessagingSystemKafka,
+		semconv.MessagingDestinationName(msg.Topic),
+		semconv.MessagingDestinationPartitionID(strconv.Itoa(msg.Partition)),
+		semconv.MessagingKafkaMessageOffset(int(msg.Offset)),
+		semconv.MessagingKafkaMessageKey(string(msg.Key)),
+		semconv.MessagingMessageBodySize(len(msg.Value)),
+		semconv.MessagingClientID(msg.ClientID),
+		semconv.MessagingKafkaConsumerGroup(msg.GroupID),
+		attribute.String("messaging.consumer.group.name", msg.GroupID),
+	}, msg.Envelope.attrs()...)
+}
@@ -0,0 +1,109 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// useGlobalTracer records the spans of tracers taken from the global
+// provider, such as that of Tracing, for the duration of the test.
+func useGlobalTracer(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	spans := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return spans
+}
+
+func hasAttr(s sdktrace.ReadOnlySpan, kv attribute.KeyValue) bool {
+	for _, a := range s.Attributes() {
+		if a == kv {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSpanAttributesOnEverySpan(t *testing.T) {
+	replay := attribute.Bool("replay", true)
+	processSpans := useGlobalTracer(t)
+	c, spans := newTestConsumer(t, WithSpanAttributes(replay))
+	msg := kafka.Message{Topic: "orders", Partition: 1, Offset: 7}
+
+	c.traceReceive(msg, time.Now())
+	handler := Chain(func(context.Context, Message) error { return nil }, Tracing())
+	if err := handler(c.handlerContext(context.Background(), msg), c.message(msg)); err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+	_, settle := c.startSettle(context.Background(), []kafka.Message{msg})
+	settle.End()
+
+	ended := append(spans.Ended(), processSpans.Ended()...)
+	for _, name := range []string{"receive orders", "process orders", "commit orders"} {
+		found := false
+		for _, s := range ended {
+			if s.Name() != name {
+				continue
+			}
+			found = true
+			if !hasAttr(s, replay) {
+				t.Errorf("span %q lacks %v", name, replay)
+			}
+		}
+		if !found {
+			t.Errorf("no %q span", name)
+		}
+	}
+}
+
+func TestSpanAttributesUnsetByDefault(t *testing.T) {
+	c, spans := newTestConsumer(t)
+	c.traceReceive(kafka.Message{Topic: "orders"}, time.Now())
+	for _, s := range spans.Ended() {
+		for _, a := range s.Attributes() {
+			if a.Key == "replay" {
+				t.Fatalf("span %q has %v", s.Name(), a)
+			}
+		}
+	}
+}
+
+func TestReceiveForgottenWhenMessageDropped(t *testing.T) {
+	c, _ := newTestConsumer(t)
+	c.retryTier = true
+	pending := func() int {
+		n := 0
+		c.receives.Range(func(any, any) bool { n++; return true })
+		return n
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	due := kafka.Message{Topic: "orders", Offset: 1, Headers: []kafka.Header{
+		{Key: HeaderRetryDueAt, Value: []byte(strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10))},
+	}}
+	c.traceReceive(due, time.Now())
+	if err := c.awaitDue(ctx, due); err == nil {
+		t.Fatal("awaitDue returned before the message was due")
+	}
+
+	tracker := newOffsetTracker()
+	undispatched := kafka.Message{Topic: "orders", Offset: 2}
+	tracker.start(undispatched)
+	c.traceReceive(undispatched, time.Now())
+	c.abandon(ctx, tracker, undispatched)
+
+	if n := pending(); n != 0 {
+		t.Fatalf("%d receive spans kept for dropped messages", n)
+	}
+}
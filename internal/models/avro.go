@@ -0,0 +1,83 @@
+package models
+
+import (
+	_ "embed"
+	"kafka-go-study/internal/avro"
+)
+
+// Avro encodings of the models, matching the schemas in schema/.
+
+var (
+	//go:embed schema/order.avsc
+	orderAvroSchema string
+	//go:embed schema/payment.avsc
+	paymentAvroSchema string
+	//go:embed schema/event.avsc
+	eventAvroSchema string
+)
+
+func (Order) AvroSchema() string { return orderAvroSchema }
+
+func (o Order) MarshalAvro() ([]byte, error) {
+	var e avro.Encoder
+	e.String(o.ID)
+	e.String(o.CustomerID)
+	e.Strings(o.Items)
+	e.Long(o.TotalCents)
+	e.TimestampMillis(o.CreatedAt)
+	return e.Data(), nil
+}
+
+func (o *Order) UnmarshalAvro(b []byte) error {
+	d := avro.NewDecoder(b)
+	*o = Order{
+		ID:         d.String(),
+		CustomerID: d.String(),
+		Items:      d.Strings(),
+		TotalCents: d.Long(),
+		CreatedAt:  d.TimestampMillis(),
+	}
+	return d.Err()
+}
+
+func (Payment) AvroSchema() string { return paymentAvroSchema }
+
+func (p Payment) MarshalAvro() ([]byte, error) {
+	var e avro.Encoder
+	e.String(p.OrderID)
+	e.String(p.CustomerID)
+	e.Long(p.TotalCents)
+	e.String(p.Status)
+	e.TimestampMillis(p.ConfirmedAt)
+	return e.Data(), nil
+}
+
+func (p *Payment) UnmarshalAvro(b []byte) error {
+	d := avro.NewDecoder(b)
+	*p = Payment{
+		OrderID:     d.String(),
+		CustomerID:  d.String(),
+		TotalCents:  d.Long(),
+		Status:      d.String(),
+		ConfirmedAt: d.TimestampMillis(),
+	}
+	return d.Err()
+}
+
+func (Event) AvroSchema() string { return eventAvroSchema }
+
+func (e Event) MarshalAvro() ([]byte, error) {
+	var enc avro.Encoder
+	enc.String(e.Payload)
+	enc.TimestampMillis(e.CreatedAt)
+	return enc.Data(), nil
+}
+
+func (e *Event) UnmarshalAvro(b []byte) error {
+	d := avro.NewDecoder(b)
+	*e = Event{
+		Payload:   d.String(),
+		CreatedAt: d.TimestampMillis(),
+	}
+	return d.Err()
+}
@@ -2,9 +2,22 @@ package models
 
 import "time"
 
+// Event is a generic event. Its ID and type travel in the message envelope,
+// not in the encoded value, and are filled in from it when decoded.
 type Event struct {
-	ID        string    `json:"id"`
-	Type      string    `json:"type"`
+	ID        string    `json:"-"`
+	Type      string    `json:"-"`
 	Payload   string    `json:"payload"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+func (e Event) MessageID() string { return e.ID }
+
+func (e Event) EventType() string { return e.Type }
+
+func (e *Event) SetMessageID(id string) { e.ID = id }
+
+func (e *Event) SetEventType(eventType string) { e.Type = eventType }
+
+// SchemaVersion is 2 since ID and Type moved to the envelope.
+func (Event) SchemaVersion() string { return "2" }
@@ -9,3 +9,7 @@ type Order struct {
 	TotalCents int64     `json:"total_cents"`
 	CreatedAt  time.Time `json:"created_at"`
 }
+
+func (Order) EventType() string { return "order.placed" }
+
+func (Order) SchemaVersion() string { return "1" }
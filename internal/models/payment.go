@@ -9,3 +9,7 @@ type Payment struct {
 	Status      string    `json:"status"`
 	ConfirmedAt time.Time `json:"confirmed_at"`
 }
+
+func (p Payment) EventType() string { return "payment." + p.Status }
+
+func (Payment) SchemaVersion() string { return "1" }
@@ -0,0 +1,210 @@
+package models
+
+import (
+	_ "embed"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Protobuf encodings of the models, matching the .proto files in schema/.
+// They are written by hand with protowire to avoid generated code; zero values
+// are omitted as in proto3.
+
+var (
+	//go:embed schema/order.proto
+	orderProtoSchema string
+	//go:embed schema/payment.proto
+	paymentProtoSchema string
+	//go:embed schema/event.proto
+	eventProtoSchema string
+)
+
+func (Order) ProtoSchema() string { return orderProtoSchema }
+
+func (Payment) ProtoSchema() string { return paymentProtoSchema }
+
+func (Event) ProtoSchema() string { return eventProtoSchema }
+
+func (o Order) MarshalProto() ([]byte, error) {
+	var b []byte
+	b = appendString(b, 1, o.ID)
+	b = appendString(b, 2, o.CustomerID)
+	for _, item := range o.Items {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, item)
+	}
+	b = appendInt64(b, 4, o.TotalCents)
+	b = appendTimestamp(b, 5, o.CreatedAt)
+	return b, nil
+}
+
+func (o *Order) UnmarshalProto(b []byte) error {
+	*o = Order{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &o.ID)
+		case 2:
+			return consumeString(typ, b, &o.CustomerID)
+		case 3:
+			var item string
+			n := consumeString(typ, b, &item)
+			if n > 0 {
+				o.Items = append(o.Items, item)
+			}
+			return n
+		case 4:
+			return consumeInt64(typ, b, &o.TotalCents)
+		case 5:
+			return consumeTimestamp(typ, b, &o.CreatedAt)
+		}
+		return 0
+	})
+}
+
+func (p Payment) MarshalProto() ([]byte, error) {
+	var b []byte
+	b = appendString(b, 1, p.OrderID)
+	b = appendString(b, 2, p.CustomerID)
+	b = appendInt64(b, 3, p.TotalCents)
+	b = appendString(b, 4, p.Status)
+	b = appendTimestamp(b, 5, p.ConfirmedAt)
+	return b, nil
+}
+
+func (p *Payment) UnmarshalProto(b []byte) error {
+	*p = Payment{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &p.OrderID)
+		case 2:
+			return consumeString(typ, b, &p.CustomerID)
+		case 3:
+			return consumeInt64(typ, b, &p.TotalCents)
+		case 4:
+			return consumeString(typ, b, &p.Status)
+		case 5:
+			return consumeTimestamp(typ, b, &p.ConfirmedAt)
+		}
+		return 0
+	})
+}
+
+func (e Event) MarshalProto() ([]byte, error) {
+	var b []byte
+	b = appendString(b, 3, e.Payload)
+	b = appendTimestamp(b, 4, e.CreatedAt)
+	return b, nil
+}
+
+func (e *Event) UnmarshalProto(b []byte) error {
+	*e = Event{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 3:
+			return consumeString(typ, b, &e.Payload)
+		case 4:
+			return consumeTimestamp(typ, b, &e.CreatedAt)
+		}
+		return 0
+	})
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendInt64(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+// appendTimestamp writes t as a google.protobuf.Timestamp.
+func appendTimestamp(b []byte, num protowire.Number, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+	var ts []byte
+	ts = appendInt64(ts, 1, t.Unix())
+	ts = appendInt64(ts, 2, int64(t.Nanosecond()))
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, ts)
+}
+
+// consumeFields calls field for every field in b. field returns the length
+// of the value it consumed, or 0 to skip an unknown field.
+func consumeFields(b []byte, field func(num protowire.Number, typ protowire.Type, b []byte) int) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		n = field(num, typ, b)
+		if n == 0 {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func consumeString(typ protowire.Type, b []byte, dst *string) int {
+	if typ != protowire.BytesType {
+		return 0
+	}
+	v, n := protowire.ConsumeString(b)
+	if n > 0 {
+		*dst = v
+	}
+	return n
+}
+
+func consumeInt64(typ protowire.Type, b []byte, dst *int64) int {
+	if typ != protowire.VarintType {
+		return 0
+	}
+	v, n := protowire.ConsumeVarint(b)
+	if n > 0 {
+		*dst = int64(v)
+	}
+	return n
+}
+
+func consumeTimestamp(typ protowire.Type, b []byte, dst *time.Time) int {
+	if typ != protowire.BytesType {
+		return 0
+	}
+	v, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return n
+	}
+	var seconds, nanos int64
+	err := consumeFields(v, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeInt64(typ, b, &seconds)
+		case 2:
+			return consumeInt64(typ, b, &nanos)
+		}
+		return 0
+	})
+	if err != nil {
+		return -1
+	}
+	*dst = time.Unix(seconds, nanos)
+	return n
+}
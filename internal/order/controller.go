@@ -2,6 +2,7 @@ package order
 
 import (
 	"errors"
+	"kafka-go-study/internal/kafka"
 
 	"github.com/gofiber/fiber/v2"
 	"go.opentelemetry.io/otel/baggage"
@@ -45,6 +46,9 @@ func (ct *Controller) Create(c *fiber.Ctx) error {
 	member, _ := baggage.NewMember("customer_id", req.CustomerID)
 	bag, _ := baggage.New(member)
 	ctx = baggage.ContextWithBaggage(ctx, bag)
+	if id := c.Get("X-Correlation-ID"); id != "" {
+		ctx = kafka.ContextWithCorrelationID(ctx, id)
+	}
 
 	order, err := ct.useCase.PlaceOrder(ctx, req.CustomerID, req.Items, req.TotalCents)
 	if err != nil {
@@ -0,0 +1,31 @@
+package order
+
+import (
+	"fmt"
+	"kafka-go-study/internal/models"
+)
+
+// PartitionKey is the order field that keys order and payment messages.
+type PartitionKey string
+
+const (
+	KeyOrderID    PartitionKey = "order_id"
+	KeyCustomerID PartitionKey = "customer_id"
+)
+
+// ParsePartitionKey returns the key named "order_id" or "customer_id".
+func ParsePartitionKey(name string) (PartitionKey, error) {
+	switch k := PartitionKey(name); k {
+	case KeyOrderID, KeyCustomerID:
+		return k, nil
+	}
+	return "", fmt.Errorf("unknown partition key %q", name)
+}
+
+// Of returns the key of messages about o.
+func (k PartitionKey) Of(o models.Order) string {
+	if k == KeyCustomerID {
+		return o.CustomerID
+	}
+	return o.ID
+}
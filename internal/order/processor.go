@@ -0,0 +1,90 @@
+package order
+
+import (
+	"context"
+	"kafka-go-study/internal/kafka"
+	"kafka-go-study/internal/models"
+	"math/rand/v2"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Publisher publishes a value under a key.
+type Publisher interface {
+	Publish(ctx context.Context, key string, value any) error
+}
+
+// Processor handles order events by confirming their payment and publishing
+// it to the payments topic.
+type Processor struct {
+	producer Publisher
+	key      PartitionKey
+	log      *zap.Logger
+	tracer   trace.Tracer
+}
+
+// NewProcessor publishes payments through producer, keyed by key.
+func NewProcessor(producer Publisher, key PartitionKey, log *zap.Logger, tracer trace.Tracer) *Processor {
+	return &Processor{producer: producer, key: key, log: log, tracer: tracer}
+}
+
+func (p *Processor) Process(ctx context.Context, msg kafka.Message) error {
+	ctx, span := p.tracer.Start(ctx, "ProcessOrder",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+	)
+	defer span.End()
+
+	var order models.Order
+	if err := msg.Decode(&order); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to unmarshal order")
+		return err
+	}
+
+	span.SetAttributes(
+		attribute.String("order.id", order.ID),
+		attribute.String("order.customer_id", order.CustomerID),
+		attribute.Int64("order.total_cents", order.TotalCents),
+	)
+
+	bag := baggage.FromContext(ctx)
+	customerID := order.CustomerID
+	if cid := bag.Member("customer_id").Value(); cid != "" {
+		customerID = cid
+	}
+
+	_, sleepSpan := p.tracer.Start(ctx, "SimulateProcessingDelay")
+	delay := time.Duration(50+rand.IntN(451)) * time.Millisecond
+	sleepSpan.SetAttributes(attribute.Int64("delay_ms", delay.Milliseconds()))
+	time.Sleep(delay)
+	sleepSpan.End()
+
+	payment := models.Payment{
+		OrderID:     order.ID,
+		CustomerID:  customerID,
+		TotalCents:  order.TotalCents,
+		Status:      "confirmed",
+		ConfirmedAt: time.Now(),
+	}
+
+	if err := p.producer.Publish(ctx, p.key.Of(order), payment); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	span.SetStatus(codes.Ok, "")
+	p.log.Info("order processed, payment published",
+		zap.String("order_id", order.ID),
+		zap.String("customer_id", customerID),
+		zap.Int64("total_cents", order.TotalCents),
+		zap.Duration("processing_delay", delay),
+	)
+
+	return nil
+}
@@ -3,8 +3,9 @@ package order
 import (
 	"context"
 	"errors"
-	"kafka-go-study/internal/kafka"
+	"fmt"
 	"kafka-go-study/internal/models"
+	"kafka-go-study/internal/outbox"
 	"kafka-go-study/internal/telemetry"
 	"math/rand/v2"
 	"time"
@@ -20,15 +21,23 @@ import (
 
 var ErrPaymentDeclined = errors.New("payment declined")
 
+// ordersBucket is where orders are stored, next to the outbox holding their
+// events.
+const ordersBucket = "orders"
+
 type UseCase struct {
-	producer *kafka.Producer
-	metrics  *telemetry.Metrics
-	log      *zap.Logger
-	tracer   trace.Tracer
+	outbox  *outbox.Store
+	topic   string
+	key     PartitionKey
+	metrics *telemetry.Metrics
+	log     *zap.Logger
+	tracer  trace.Tracer
 }
 
-func NewUseCase(producer *kafka.Producer, metrics *telemetry.Metrics, log *zap.Logger, tracer trace.Tracer) *UseCase {
-	return &UseCase{producer: producer, metrics: metrics, log: log, tracer: tracer}
+// NewUseCase stores orders in store and enqueues them to topic through its
+// outbox, keyed by key.
+func NewUseCase(store *outbox.Store, topic string, key PartitionKey, metrics *telemetry.Metrics, log *zap.Logger, tracer trace.Tracer) *UseCase {
+	return &UseCase{outbox: store, topic: topic, key: key, metrics: metrics, log: log, tracer: tracer}
 }
 
 func (uc *UseCase) PlaceOrder(ctx context.Context, customerID string, items []string, totalCents int64) (*models.Order, error) {
@@ -64,7 +73,18 @@ func (uc *UseCase) PlaceOrder(ctx context.Context, customerID string, items []st
 	}
 	span.SetAttributes(attribute.String("order.id", order.ID))
 
-	if err := uc.producer.Publish(ctx, order.ID, order); err != nil {
+	// The order and its event are committed together; the outbox relay
+	// publishes the event with the trace context captured here.
+	storeCtx, storeSpan := uc.tracer.Start(ctx, "StoreOrder")
+	err := uc.outbox.Update(func(tx *outbox.Tx) error {
+		if err := tx.Put(ordersBucket, order.ID, order); err != nil {
+			return err
+		}
+		return tx.Enqueue(storeCtx, uc.topic, uc.key.Of(*order), order)
+	})
+	storeSpan.End()
+	if err != nil {
+		err = fmt.Errorf("failed to store order: %w", err)
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		uc.metrics.OrdersCreated.Add(ctx, 1, metric.WithAttributes(attribute.String("status", "error")))
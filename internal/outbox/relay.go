@@ -0,0 +1,121 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"kafka-go-study/internal/kafka"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.uber.org/zap"
+)
+
+const (
+	batchSize     = 100
+	pollInterval  = time.Second
+	purgeInterval = 10 * time.Minute
+	sentRetention = 24 * time.Hour
+)
+
+// Relay publishes pending outbox records at least once.
+type Relay struct {
+	store     *Store
+	producers map[string]*kafka.Producer
+	log       *zap.Logger
+}
+
+// NewRelay publishes the records of every topic through its producer.
+func NewRelay(store *Store, producers map[string]*kafka.Producer, log *zap.Logger) *Relay {
+	return &Relay{store: store, producers: producers, log: log}
+}
+
+// Run relays records as they are enqueued until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+	purge := time.NewTicker(purgeInterval)
+	defer purge.Stop()
+
+	for {
+		for {
+			n, err := r.relay()
+			if err != nil {
+				r.log.Error("outbox relay failed", zap.Error(err))
+			}
+			if err != nil || n < batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.store.pending:
+		case <-poll.C:
+		case <-purge.C:
+			if err := r.store.PurgeSent(time.Now().Add(-sentRetention)); err != nil {
+				r.log.Warn("failed to purge sent outbox records", zap.Error(err))
+			}
+		}
+	}
+}
+
+// relay publishes one batch and returns how many records were marked sent.
+func (r *Relay) relay() (int, error) {
+	records, err := r.store.Pending(batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	sent := make([]bool, len(records))
+	for i, rec := range records {
+		producer, ok := r.producers[rec.Topic]
+		if !ok {
+			r.log.Error("no producer for outbox topic", zap.String("topic", rec.Topic), zap.Uint64("outbox_id", rec.ID))
+			break
+		}
+
+		// Publish under the trace of the request that enqueued the record.
+		ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(rec.Trace))
+		log := r.log.With(zap.Uint64("outbox_id", rec.ID), zap.String("topic", rec.Topic), zap.String("key", rec.Key))
+
+		wg.Add(1)
+		err := producer.PublishRawAsync(ctx, []byte(rec.Key), rec.Value, rec.Envelope.Headers(), func(err error) {
+			defer wg.Done()
+			if err != nil {
+				log.Warn("failed to publish outbox record", zap.Error(err))
+				return
+			}
+			sent[i] = true
+		})
+		if err != nil {
+			wg.Done()
+			log.Warn("failed to queue outbox record", zap.Error(err))
+			// Keep the rest for the next attempt rather than reordering them.
+			break
+		}
+	}
+	wg.Wait()
+
+	// Mark only the records before the first failure to keep their order.
+	var ids []uint64
+	for i, ok := range sent {
+		if !ok {
+			break
+		}
+		ids = append(ids, records[i].ID)
+	}
+	if len(ids) == 0 {
+		if len(records) > 0 {
+			return 0, fmt.Errorf("none of %d pending outbox records was published", len(records))
+		}
+		return 0, nil
+	}
+	if err := r.store.MarkSent(ids...); err != nil {
+		return 0, fmt.Errorf("failed to mark outbox records sent: %w", err)
+	}
+	return len(ids), nil
+}
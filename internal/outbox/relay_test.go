@@ -0,0 +1,114 @@
+package outbox
+
+import (
+	"context"
+	"kafka-go-study/internal/kafka"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// newSpillingProducer returns a producer of a broker that is never reached.
+// Its publishes succeed by spilling to disk, unless maxBytes is too small to
+// hold a message.
+func newSpillingProducer(t *testing.T, topic string, maxBytes int64) *kafka.Producer {
+	t.Helper()
+	p := kafka.NewProducer([]string{"127.0.0.1:1"}, topic, kafka.WithSpill(t.TempDir(), maxBytes))
+	t.Cleanup(func() { _ = p.Close() })
+	return p
+}
+
+func enqueue(t *testing.T, s *Store, topic string, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		err := s.Update(func(tx *Tx) error {
+			return tx.Enqueue(context.Background(), topic, id, event{ID: id})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func pendingKeys(t *testing.T, s *Store) []string {
+	t.Helper()
+	records, err := s.Pending(batchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, rec := range records {
+		keys = append(keys, rec.Key)
+	}
+	return keys
+}
+
+func TestRelayMarksPublishedRecords(t *testing.T) {
+	s := openTestStore(t, kafka.JSON)
+	enqueue(t, s, "orders", "o-1", "o-2", "o-3")
+
+	r := NewRelay(s, map[string]*kafka.Producer{"orders": newSpillingProducer(t, "orders", 1<<20)}, zap.NewNop())
+	n, err := r.relay()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("relayed %d records, want 3", n)
+	}
+	if keys := pendingKeys(t, s); len(keys) != 0 {
+		t.Errorf("pending = %v, want none", keys)
+	}
+}
+
+func TestRelayStopsAtFirstFailure(t *testing.T) {
+	tests := []struct {
+		name      string
+		producers func(t *testing.T) map[string]*kafka.Producer
+	}{
+		{"publish fails", func(t *testing.T) map[string]*kafka.Producer {
+			return map[string]*kafka.Producer{
+				"orders":   newSpillingProducer(t, "orders", 1<<20),
+				"payments": newSpillingProducer(t, "payments", 1),
+			}
+		}},
+		{"no producer", func(t *testing.T) map[string]*kafka.Producer {
+			return map[string]*kafka.Producer{"orders": newSpillingProducer(t, "orders", 1<<20)}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := openTestStore(t, kafka.JSON)
+			enqueue(t, s, "orders", "o-1")
+			enqueue(t, s, "payments", "p-1")
+			enqueue(t, s, "orders", "o-2")
+
+			r := NewRelay(s, tt.producers(t), zap.NewNop())
+			n, err := r.relay()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 1 {
+				t.Errorf("relayed %d records, want 1", n)
+			}
+
+			// o-2 stays behind p-1, so they are published again in order.
+			keys := pendingKeys(t, s)
+			if len(keys) != 2 || keys[0] != "p-1" || keys[1] != "o-2" {
+				t.Errorf("pending = %v, want [p-1 o-2]", keys)
+			}
+		})
+	}
+}
+
+func TestRelayFailsWhenNothingIsPublished(t *testing.T) {
+	s := openTestStore(t, kafka.JSON)
+	enqueue(t, s, "orders", "o-1", "o-2")
+
+	r := NewRelay(s, map[string]*kafka.Producer{"orders": newSpillingProducer(t, "orders", 1)}, zap.NewNop())
+	if _, err := r.relay(); err == nil {
+		t.Error("relay reported success with every publish failing")
+	}
+	if keys := pendingKeys(t, s); len(keys) != 2 {
+		t.Errorf("pending = %v, want both records", keys)
+	}
+}
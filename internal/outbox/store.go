@@ -0,0 +1,217 @@
+package outbox
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"kafka-go-study/internal/kafka"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	pendingBucket = []byte("outbox")
+	sentBucket    = []byte("outbox_sent")
+)
+
+// Record is an event waiting to be published with its envelope and trace.
+type Record struct {
+	ID        uint64            `json:"id"`
+	Topic     string            `json:"topic"`
+	Key       string            `json:"key"`
+	Value     []byte            `json:"value"`
+	Envelope  kafka.Envelope    `json:"envelope"`
+	Trace     map[string]string `json:"trace,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// Store writes entities and their outgoing events in one bbolt transaction.
+type Store struct {
+	db    *bolt.DB
+	codec kafka.Codec
+	// pending wakes the relay when a commit enqueues a record.
+	pending chan struct{}
+}
+
+func OpenStore(path string, codec kafka.Codec) (*Store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open outbox store: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{pendingBucket, sentBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to create outbox buckets: %w", err)
+	}
+
+	return &Store{db: db, codec: codec, pending: make(chan struct{}, 1)}, nil
+}
+
+// Tx encodes entities and records before Update locks the database.
+type Tx struct {
+	codec  kafka.Codec
+	writes []func(tx *bolt.Tx) error
+	// enqueued reports whether any record was added.
+	enqueued bool
+}
+
+// Update stores the entities and records added by fn in one transaction.
+func (s *Store) Update(fn func(tx *Tx) error) error {
+	t := &Tx{codec: s.codec}
+	if err := fn(t); err != nil {
+		return err
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for _, write := range t.writes {
+			if err := write(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if t.enqueued {
+		select {
+		case s.pending <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Put stores value as JSON under key in bucket, creating the bucket if needed.
+func (t *Tx) Put(bucket, key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to serialize %s %s: %w", bucket, key, err)
+	}
+	t.writes = append(t.writes, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return fmt.Errorf("failed to create bucket %s: %w", bucket, err)
+		}
+		return b.Put([]byte(key), data)
+	})
+	return nil
+}
+
+// Enqueue adds value, encoded with the store codec, to the outbox of topic
+// along with the trace context of ctx.
+func (t *Tx) Enqueue(ctx context.Context, topic, key string, value any) error {
+	data, err := t.codec.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to serialize outbox event: %w", err)
+	}
+
+	env := kafka.NewEnvelope(ctx, value, t.codec)
+	if env.MessageID == "" {
+		env.MessageID = uuid.NewString()
+	}
+	if env.CorrelationID == "" {
+		env.CorrelationID = env.MessageID
+	}
+
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	rec := Record{
+		Topic:     topic,
+		Key:       key,
+		Value:     data,
+		Envelope:  env,
+		Trace:     carrier,
+		CreatedAt: env.CreatedAt,
+	}
+	t.writes = append(t.writes, func(tx *bolt.Tx) error {
+		b := tx.Bucket(pendingBucket)
+		id, err := b.NextSequence()
+		if err != nil {
+			return fmt.Errorf("failed to allocate outbox id: %w", err)
+		}
+		rec.ID = id
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return fmt.Errorf("failed to serialize outbox record: %w", err)
+		}
+		return b.Put(recordKey(id), data)
+	})
+	t.enqueued = true
+	return nil
+}
+
+// Pending returns up to limit records not yet sent, oldest first.
+func (s *Store) Pending(limit int) ([]Record, error) {
+	var records []Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(pendingBucket).Cursor()
+		for k, v := c.First(); k != nil && len(records) < limit; k, v = c.Next() {
+			var rec Record
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return fmt.Errorf("failed to read outbox record %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			records = append(records, rec)
+		}
+		return nil
+	})
+	return records, err
+}
+
+// MarkSent moves the records with the given ids out of the pending outbox.
+func (s *Store) MarkSent(ids ...uint64) error {
+	sentAt := make([]byte, 8)
+	binary.BigEndian.PutUint64(sentAt, uint64(time.Now().UnixNano()))
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		pending, sent := tx.Bucket(pendingBucket), tx.Bucket(sentBucket)
+		for _, id := range ids {
+			if err := pending.Delete(recordKey(id)); err != nil {
+				return err
+			}
+			if err := sent.Put(recordKey(id), sentAt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PurgeSent forgets records sent before cutoff.
+func (s *Store) PurgeSent(cutoff time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(sentBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if len(v) != 8 || int64(binary.BigEndian.Uint64(v)) < cutoff.UnixNano() {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func recordKey(id uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, id)
+	return k
+}
@@ -0,0 +1,184 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"kafka-go-study/internal/kafka"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type event struct {
+	ID string `json:"id"`
+}
+
+func (e event) MessageID() string { return e.ID }
+
+func openTestStore(t *testing.T, codec kafka.Codec) *Store {
+	t.Helper()
+	s, err := OpenStore(filepath.Join(t.TempDir(), "outbox.db"), codec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func TestEnqueueStoresEntityAndRecord(t *testing.T) {
+	s := openTestStore(t, kafka.JSON)
+
+	err := s.Update(func(tx *Tx) error {
+		if err := tx.Put("orders", "o-1", event{ID: "o-1"}); err != nil {
+			return err
+		}
+		return tx.Enqueue(context.Background(), "orders", "o-1", event{ID: "o-1"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var entity []byte
+	_ = s.db.View(func(tx *bolt.Tx) error {
+		entity = tx.Bucket([]byte("orders")).Get([]byte("o-1"))
+		return nil
+	})
+	if string(entity) != `{"id":"o-1"}` {
+		t.Errorf("entity = %s", entity)
+	}
+
+	records, err := s.Pending(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("pending = %d records, want 1", len(records))
+	}
+	rec := records[0]
+	if rec.ID != 1 || rec.Topic != "orders" || rec.Key != "o-1" || string(rec.Value) != `{"id":"o-1"}` {
+		t.Errorf("record = %+v", rec)
+	}
+	if rec.Envelope.MessageID != "o-1" || rec.Envelope.CorrelationID != "o-1" {
+		t.Errorf("envelope = %+v", rec.Envelope)
+	}
+
+	select {
+	case <-s.pending:
+	default:
+		t.Error("relay was not signalled")
+	}
+}
+
+func TestUpdateIsAtomic(t *testing.T) {
+	s := openTestStore(t, kafka.JSON)
+	failed := errors.New("failed")
+
+	err := s.Update(func(tx *Tx) error {
+		if err := tx.Enqueue(context.Background(), "orders", "o-1", event{ID: "o-1"}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("Update = %v, want %v", err, failed)
+	}
+
+	err = s.Update(func(tx *Tx) error {
+		if err := tx.Enqueue(context.Background(), "orders", "o-2", event{ID: "o-2"}); err != nil {
+			return err
+		}
+		return tx.Put("orders", "o-2", func() {})
+	})
+	if err == nil {
+		t.Fatal("Update with an unserializable entity succeeded")
+	}
+
+	records, err := s.Pending(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Errorf("pending = %+v, want none", records)
+	}
+}
+
+// lockingCodec writes to the store while marshalling, which deadlocks if it
+// is called with the write lock held.
+type lockingCodec struct {
+	kafka.Codec
+	store *Store
+}
+
+func (c lockingCodec) Marshal(v any) ([]byte, error) {
+	if err := c.store.MarkSent(); err != nil {
+		return nil, err
+	}
+	return c.Codec.Marshal(v)
+}
+
+func TestEnqueueMarshalsOutsideTransaction(t *testing.T) {
+	s := openTestStore(t, kafka.JSON)
+	s.codec = lockingCodec{Codec: kafka.JSON, store: s}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Update(func(tx *Tx) error {
+			return tx.Enqueue(context.Background(), "orders", "o-1", event{ID: "o-1"})
+		})
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("codec ran inside the write transaction")
+	}
+}
+
+func TestMarkSentAndPurge(t *testing.T) {
+	s := openTestStore(t, kafka.JSON)
+	for _, id := range []string{"o-1", "o-2", "o-3"} {
+		err := s.Update(func(tx *Tx) error {
+			return tx.Enqueue(context.Background(), "orders", id, event{ID: id})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.MarkSent(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	records, err := s.Pending(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].ID != 3 {
+		t.Fatalf("pending = %+v, want record 3", records)
+	}
+
+	countSent := func() int {
+		n := 0
+		_ = s.db.View(func(tx *bolt.Tx) error {
+			n = tx.Bucket(sentBucket).Stats().KeyN
+			return nil
+		})
+		return n
+	}
+	if err := s.PurgeSent(time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if n := countSent(); n != 2 {
+		t.Errorf("sent after purging older records = %d, want 2", n)
+	}
+	if err := s.PurgeSent(time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if n := countSent(); n != 0 {
+		t.Errorf("sent after purging all = %d, want 0", n)
+	}
+}
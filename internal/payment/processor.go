@@ -0,0 +1,90 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"kafka-go-study/internal/kafka"
+	"kafka-go-study/internal/models"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Processor handles payment events by confirming them on payment-api.
+type Processor struct {
+	client  *http.Client
+	apiAddr string
+	log     *zap.Logger
+	tracer  trace.Tracer
+}
+
+func NewProcessor(client *http.Client, apiAddr string, log *zap.Logger, tracer trace.Tracer) *Processor {
+	return &Processor{client: client, apiAddr: apiAddr, log: log, tracer: tracer}
+}
+
+func (p *Processor) Process(ctx context.Context, msg kafka.Message) error {
+	ctx, span := p.tracer.Start(ctx, "ProcessPayment",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+	)
+	defer span.End()
+
+	var payment models.Payment
+	if err := msg.Decode(&payment); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to unmarshal payment")
+		return err
+	}
+
+	span.SetAttributes(
+		attribute.String("payment.order_id", payment.OrderID),
+		attribute.String("payment.customer_id", payment.CustomerID),
+		attribute.Int64("payment.total_cents", payment.TotalCents),
+	)
+
+	body, _ := json.Marshal(map[string]any{
+		"order_id":    payment.OrderID,
+		"customer_id": payment.CustomerID,
+		"total_cents": payment.TotalCents,
+	})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		p.apiAddr+"/payments/confirm", bytes.NewReader(body))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("payment-api returned %d", resp.StatusCode)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	span.SetStatus(codes.Ok, "")
+	p.log.Info("payment confirmed via payment-api",
+		zap.String("order_id", payment.OrderID),
+		zap.String("customer_id", payment.CustomerID),
+	)
+
+	return nil
+}
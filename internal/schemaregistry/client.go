@@ -0,0 +1,206 @@
+// Package schemaregistry talks to a Confluent-compatible schema registry and
+// frames message values in its wire format.
+package schemaregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type SchemaType string
+
+const (
+	TypeAvro     SchemaType = "AVRO"
+	TypeProtobuf SchemaType = "PROTOBUF"
+)
+
+// Schema is a schema as stored by the registry. An empty Type means Avro.
+type Schema struct {
+	Type   SchemaType `json:"schemaType,omitempty"`
+	Schema string     `json:"schema"`
+}
+
+func (s Schema) schemaType() SchemaType {
+	if s.Type == "" {
+		return TypeAvro
+	}
+	return s.Type
+}
+
+var (
+	ErrNotFound     = errors.New("schema registry: not found")
+	ErrIncompatible = errors.New("schema registry: schema is incompatible with the latest version")
+)
+
+// Error is an error response of the registry.
+type Error struct {
+	Status  int    `json:"-"`
+	Code    int    `json:"error_code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("schema registry: %s (%d)", e.Message, e.Code)
+}
+
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Status == http.StatusNotFound
+	case ErrIncompatible:
+		return e.Status == http.StatusConflict
+	}
+	return false
+}
+
+const contentType = "application/vnd.schemaregistry.v1+json"
+
+// Client is a schema registry client. Schemas and IDs never change once
+// registered, so both are cached.
+type Client struct {
+	baseURL string
+	http    *http.Client
+
+	mu   sync.Mutex
+	byID map[int]Schema
+	ids  map[subjectSchema]int
+}
+
+type subjectSchema struct {
+	subject string
+	schema  Schema
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    &http.Client{Timeout: 10 * time.Second},
+		byID:    make(map[int]Schema),
+		ids:     make(map[subjectSchema]int),
+	}
+}
+
+// Register registers schema under subject, or returns its ID if it already is.
+func (c *Client) Register(ctx context.Context, subject string, schema Schema) (int, error) {
+	if id, ok := c.cachedID(subject, schema); ok {
+		return id, nil
+	}
+	var resp struct {
+		ID int `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/subjects/"+url.PathEscape(subject)+"/versions", schema, &resp); err != nil {
+		return 0, fmt.Errorf("failed to register schema for %s: %w", subject, err)
+	}
+	c.cache(subject, schema, resp.ID)
+	return resp.ID, nil
+}
+
+// Lookup returns the ID of schema if it is registered under subject, or an
+// error matching ErrNotFound.
+func (c *Client) Lookup(ctx context.Context, subject string, schema Schema) (int, error) {
+	if id, ok := c.cachedID(subject, schema); ok {
+		return id, nil
+	}
+	var resp struct {
+		ID int `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/subjects/"+url.PathEscape(subject), schema, &resp); err != nil {
+		return 0, fmt.Errorf("failed to look up schema for %s: %w", subject, err)
+	}
+	c.cache(subject, schema, resp.ID)
+	return resp.ID, nil
+}
+
+// SchemaByID returns the schema registered with id.
+func (c *Client) SchemaByID(ctx context.Context, id int) (Schema, error) {
+	c.mu.Lock()
+	s, ok := c.byID[id]
+	c.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+
+	if err := c.do(ctx, http.MethodGet, "/schemas/ids/"+strconv.Itoa(id), nil, &s); err != nil {
+		return Schema{}, fmt.Errorf("failed to fetch schema %d: %w", id, err)
+	}
+	c.mu.Lock()
+	c.byID[id] = s
+	c.mu.Unlock()
+	return s, nil
+}
+
+// CheckCompatibility reports whether schema can be registered under subject
+// given the subject's compatibility level. Any schema is compatible with a
+// subject that has no versions yet.
+func (c *Client) CheckCompatibility(ctx context.Context, subject string, schema Schema) (bool, error) {
+	var resp struct {
+		IsCompatible bool `json:"is_compatible"`
+	}
+	err := c.do(ctx, http.MethodPost, "/compatibility/subjects/"+url.PathEscape(subject)+"/versions/latest", schema, &resp)
+	if errors.Is(err, ErrNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check compatibility for %s: %w", subject, err)
+	}
+	return resp.IsCompatible, nil
+}
+
+func (c *Client) cachedID(subject string, schema Schema) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id, ok := c.ids[subjectSchema{subject, schema}]
+	return id, ok
+}
+
+func (c *Client) cache(subject string, schema Schema, id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ids[subjectSchema{subject, schema}] = id
+	c.byID[id] = schema
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", contentType)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		regErr := &Error{Status: resp.StatusCode}
+		if json.NewDecoder(resp.Body).Decode(regErr) != nil || regErr.Message == "" {
+			regErr.Message = resp.Status
+		}
+		return regErr
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,131 @@
+package schemaregistry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	recordV1 = `{"type": "record", "name": "R", "fields": [{"name": "a", "type": "int"}]}`
+	// recordV2 promotes a to long, which can read int data.
+	recordV2 = `{"type": "record", "name": "R", "fields": [{"name": "a", "type": "long"}]}`
+	// recordV3 adds a field without a default, which cannot.
+	recordV3 = `{"type": "record", "name": "R", "fields": [{"name": "a", "type": "long"}, {"name": "b", "type": "string"}]}`
+)
+
+// startCountingFake serves a Fake and counts the requests it receives.
+func startCountingFake(t *testing.T) (*Client, *atomic.Int64) {
+	t.Helper()
+	var requests atomic.Int64
+	fake := NewFake()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fake.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return NewClient(srv.URL + "/"), &requests
+}
+
+func TestClientRegisterAndLookup(t *testing.T) {
+	c, requests := startCountingFake(t)
+	ctx := context.Background()
+	v1 := Schema{Schema: recordV1}
+
+	if _, err := c.Lookup(ctx, "R", v1); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Lookup before Register = %v, want %v", err, ErrNotFound)
+	}
+
+	id, err := c.Register(ctx, "R", v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := c.Register(ctx, "R", v1); err != nil || again != id {
+		t.Errorf("Register again = %d, %v, want %d", again, err, id)
+	}
+	if got, err := c.Lookup(ctx, "R", v1); err != nil || got != id {
+		t.Errorf("Lookup = %d, %v, want %d", got, err, id)
+	}
+	if got, err := c.SchemaByID(ctx, id); err != nil || got != v1 {
+		t.Errorf("SchemaByID = %+v, %v, want %+v", got, err, v1)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("registry requests = %d, want 2: later calls must be cached", n)
+	}
+
+	// A fresh client finds the schema registered by another one.
+	other := NewClient(c.baseURL)
+	if got, err := other.Lookup(ctx, "R", v1); err != nil || got != id {
+		t.Errorf("Lookup from another client = %d, %v, want %d", got, err, id)
+	}
+	if _, err := other.SchemaByID(ctx, id+100); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SchemaByID of an unknown id = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestClientCheckCompatibility(t *testing.T) {
+	c, _ := startCountingFake(t)
+	ctx := context.Background()
+
+	if ok, err := c.CheckCompatibility(ctx, "R", Schema{Schema: recordV3}); err != nil || !ok {
+		t.Errorf("CheckCompatibility on a new subject = %v, %v, want true", ok, err)
+	}
+	if _, err := c.Register(ctx, "R", Schema{Schema: recordV1}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		schema Schema
+		want   bool
+	}{
+		{"promoted field", Schema{Schema: recordV2}, true},
+		{"field without default", Schema{Schema: recordV3}, false},
+		{"schema type changed", Schema{Type: TypeProtobuf, Schema: "message R { int64 a = 1; }"}, false},
+	}
+	for _, tt := range tests {
+		got, err := c.CheckCompatibility(ctx, "R", tt.schema)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: compatible = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFakeRejectsIncompatibleRegistration(t *testing.T) {
+	c, _ := startCountingFake(t)
+	ctx := context.Background()
+
+	if _, err := c.Register(ctx, "R", Schema{Schema: recordV1}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := c.Register(ctx, "R", Schema{Schema: recordV3})
+	if !errors.Is(err, ErrIncompatible) {
+		t.Errorf("Register = %v, want %v", err, ErrIncompatible)
+	}
+}
+
+func TestProtoCompatible(t *testing.T) {
+	prev := "message P {\n  string id = 1;\n  int64 total = 2;\n}"
+	tests := []struct {
+		name string
+		next string
+		ok   bool
+	}{
+		{"added field", "message P {\n  string id = 1;\n  int64 total = 2;\n  string note = 3;\n}", true},
+		{"removed field", "message P {\n  string id = 1;\n}", true},
+		{"changed type", "message P {\n  string id = 1;\n  string total = 2;\n}", false},
+		{"made repeated", "message P {\n  repeated string id = 1;\n  int64 total = 2;\n}", false},
+	}
+	for _, tt := range tests {
+		err := protoCompatible(tt.next, prev)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: protoCompatible = %v, want ok=%v", tt.name, err, tt.ok)
+		}
+	}
+}
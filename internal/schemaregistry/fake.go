@@ -0,0 +1,231 @@
+package schemaregistry
+
+import (
+	"encoding/json"
+	"fmt"
+	"kafka-go-study/internal/avro"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// Fake is an in-memory schema registry serving the part of the Confluent REST
+// API that Client uses. Every subject has BACKWARD compatibility: a new
+// schema must be able to read data written with the latest one.
+type Fake struct {
+	mux *http.ServeMux
+
+	mu       sync.Mutex
+	schemas  []Schema
+	subjects map[string][]int
+}
+
+func NewFake() *Fake {
+	f := &Fake{mux: http.NewServeMux(), subjects: make(map[string][]int)}
+	f.mux.HandleFunc("GET /subjects", f.listSubjects)
+	f.mux.HandleFunc("POST /subjects/{subject}/versions", f.register)
+	f.mux.HandleFunc("POST /subjects/{subject}", f.lookup)
+	f.mux.HandleFunc("GET /schemas/ids/{id}", f.schemaByID)
+	f.mux.HandleFunc("POST /compatibility/subjects/{subject}/versions/latest", f.checkCompatibility)
+	return f
+}
+
+// StartFake serves a new Fake on a local port. Close the server when done.
+func StartFake() *httptest.Server {
+	return httptest.NewServer(NewFake())
+}
+
+func (f *Fake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mux.ServeHTTP(w, r)
+}
+
+func (f *Fake) listSubjects(w http.ResponseWriter, _ *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	subjects := make([]string, 0, len(f.subjects))
+	for s := range f.subjects {
+		subjects = append(subjects, s)
+	}
+	slices.Sort(subjects)
+	reply(w, http.StatusOK, subjects)
+}
+
+func (f *Fake) register(w http.ResponseWriter, r *http.Request) {
+	subject := r.PathValue("subject")
+	schema, ok := readSchema(w, r)
+	if !ok {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	versions := f.subjects[subject]
+	for _, id := range versions {
+		if f.schemas[id-1] == schema {
+			reply(w, http.StatusOK, map[string]int{"id": id})
+			return
+		}
+	}
+	if len(versions) > 0 {
+		if err := compatible(schema, f.schemas[versions[len(versions)-1]-1]); err != nil {
+			replyError(w, http.StatusConflict, http.StatusConflict, err.Error())
+			return
+		}
+	}
+
+	id := slices.Index(f.schemas, schema) + 1
+	if id == 0 {
+		f.schemas = append(f.schemas, schema)
+		id = len(f.schemas)
+	}
+	f.subjects[subject] = append(versions, id)
+	reply(w, http.StatusOK, map[string]int{"id": id})
+}
+
+func (f *Fake) lookup(w http.ResponseWriter, r *http.Request) {
+	subject := r.PathValue("subject")
+	schema, ok := readSchema(w, r)
+	if !ok {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	versions, ok := f.subjects[subject]
+	if !ok {
+		replyError(w, http.StatusNotFound, 40401, "subject not found")
+		return
+	}
+	for i, id := range versions {
+		if f.schemas[id-1] == schema {
+			reply(w, http.StatusOK, map[string]any{
+				"subject": subject,
+				"id":      id,
+				"version": i + 1,
+				"schema":  schema.Schema,
+			})
+			return
+		}
+	}
+	replyError(w, http.StatusNotFound, 40403, "schema not found")
+}
+
+func (f *Fake) schemaByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err != nil || id < 1 || id > len(f.schemas) {
+		replyError(w, http.StatusNotFound, 40403, "schema not found")
+		return
+	}
+	reply(w, http.StatusOK, f.schemas[id-1])
+}
+
+func (f *Fake) checkCompatibility(w http.ResponseWriter, r *http.Request) {
+	subject := r.PathValue("subject")
+	schema, ok := readSchema(w, r)
+	if !ok {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	versions, ok := f.subjects[subject]
+	if !ok {
+		replyError(w, http.StatusNotFound, 40401, "subject not found")
+		return
+	}
+	resp := map[string]any{"is_compatible": true}
+	if err := compatible(schema, f.schemas[versions[len(versions)-1]-1]); err != nil {
+		resp = map[string]any{"is_compatible": false, "messages": []string{err.Error()}}
+	}
+	reply(w, http.StatusOK, resp)
+}
+
+// compatible checks that next can read data written with prev.
+func compatible(next, prev Schema) error {
+	if next.schemaType() != prev.schemaType() {
+		return fmt.Errorf("schema type changed from %s to %s", prev.schemaType(), next.schemaType())
+	}
+
+	switch next.schemaType() {
+	case TypeAvro:
+		reader, err := avro.ParseSchema(next.Schema)
+		if err != nil {
+			return err
+		}
+		writer, err := avro.ParseSchema(prev.Schema)
+		if err != nil {
+			return err
+		}
+		return avro.CanRead(reader, writer)
+	case TypeProtobuf:
+		return protoCompatible(next.Schema, prev.Schema)
+	}
+	return nil
+}
+
+var (
+	protoMessage = regexp.MustCompile(`message\s+(\w+)\s*\{([^}]*)\}`)
+	protoField   = regexp.MustCompile(`(?m)^\s*(repeated\s+|optional\s+)?([\w.]+)\s+(\w+)\s*=\s*(\d+)`)
+)
+
+// protoCompatible checks that no field number kept by next changed its type
+// or cardinality. Fields may be added or removed. Nested messages are not
+// supported.
+func protoCompatible(next, prev string) error {
+	prevFields := protoFields(prev)
+	for msg, fields := range protoFields(next) {
+		for num, field := range fields {
+			if old, ok := prevFields[msg][num]; ok && old != field {
+				return fmt.Errorf("%s: field %s changed from %q to %q", msg, num, old, field)
+			}
+		}
+	}
+	return nil
+}
+
+// protoFields returns the "[label] type" of every field number of every
+// message in a .proto file.
+func protoFields(schema string) map[string]map[string]string {
+	messages := make(map[string]map[string]string)
+	for _, m := range protoMessage.FindAllStringSubmatch(schema, -1) {
+		fields := make(map[string]string)
+		for _, f := range protoField.FindAllStringSubmatch(m[2], -1) {
+			fields[f[4]] = f[1] + f[2]
+		}
+		messages[m[1]] = fields
+	}
+	return messages
+}
+
+func readSchema(w http.ResponseWriter, r *http.Request) (Schema, bool) {
+	var s Schema
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil || s.Schema == "" {
+		replyError(w, http.StatusUnprocessableEntity, 42201, "invalid schema")
+		return Schema{}, false
+	}
+	if s.Type == TypeAvro {
+		s.Type = ""
+	}
+	return s, true
+}
+
+func reply(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func replyError(w http.ResponseWriter, status, code int, message string) {
+	reply(w, status, Error{Code: code, Message: message})
+}
@@ -0,0 +1,242 @@
+package schemaregistry
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"kafka-go-study/internal/avro"
+	"kafka-go-study/internal/kafka"
+	"regexp"
+	"sync"
+)
+
+// Content types of values framed in the Confluent wire format.
+const (
+	ContentTypeAvro     = "application/vnd.confluent.avro"
+	ContentTypeProtobuf = "application/vnd.confluent.protobuf"
+)
+
+var ErrNotFramed = errors.New("value is not in the Confluent wire format")
+
+// AvroSchemer and ProtoSchemer are implemented by values that know the schema
+// they are encoded with.
+type AvroSchemer interface {
+	AvroSchema() string
+}
+
+type ProtoSchemer interface {
+	ProtoSchema() string
+}
+
+// Serializer is a kafka.Codec that frames Avro or Protobuf values in the
+// Confluent wire format: a zero magic byte and the 4-byte big-endian schema
+// ID, plus the message indexes for Protobuf, before the encoded value.
+//
+// Schemas are registered under the full name of their record or message
+// (RecordNameStrategy), so one subject serves every topic carrying the type.
+// Marshal fails with ErrIncompatible rather than register a schema the
+// registry rejects. Unmarshal fetches the writer schema by ID and, for Avro,
+// resolves it against the schema of the target value.
+type Serializer struct {
+	client *Client
+	format kafka.Codec
+
+	mu     sync.Mutex
+	ids    map[Schema]int
+	parsed map[string]*avro.Schema
+}
+
+// NewSerializer frames values encoded with format, which must be kafka.Avro or
+// kafka.Protobuf.
+func NewSerializer(client *Client, format kafka.Codec) *Serializer {
+	return &Serializer{
+		client: client,
+		format: format,
+		ids:    make(map[Schema]int),
+		parsed: make(map[string]*avro.Schema),
+	}
+}
+
+func (s *Serializer) ContentType() string {
+	if s.format == kafka.Protobuf {
+		return ContentTypeProtobuf
+	}
+	return ContentTypeAvro
+}
+
+func (s *Serializer) Marshal(v any) ([]byte, error) {
+	schema, err := s.schemaOf(v)
+	if err != nil {
+		return nil, err
+	}
+	id, err := s.register(context.Background(), schema)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := s.format.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 5, 6+len(payload))
+	binary.BigEndian.PutUint32(out[1:], uint32(id))
+	if s.format == kafka.Protobuf {
+		// Message indexes [0], the first message of the file, are written as
+		// a single zero.
+		out = append(out, 0)
+	}
+	return append(out, payload...), nil
+}
+
+func (s *Serializer) Unmarshal(data []byte, v any) error {
+	if len(data) < 5 || data[0] != 0 {
+		return ErrNotFramed
+	}
+	id := int(binary.BigEndian.Uint32(data[1:5]))
+	writer, err := s.client.SchemaByID(context.Background(), id)
+	if err != nil {
+		return err
+	}
+	payload := data[5:]
+
+	switch s.format {
+	case kafka.Protobuf:
+		payload, err = skipMessageIndexes(payload)
+		if err != nil {
+			return err
+		}
+	case kafka.Avro:
+		reader, err := s.schemaOf(v)
+		if err != nil {
+			return err
+		}
+		if writer.Schema != reader.Schema {
+			payload, err = s.resolve(payload, writer.Schema, reader.Schema)
+			if err != nil {
+				return fmt.Errorf("failed to resolve writer schema %d: %w", id, err)
+			}
+		}
+	}
+	return s.format.Unmarshal(payload, v)
+}
+
+func (s *Serializer) schemaOf(v any) (Schema, error) {
+	switch s.format {
+	case kafka.Avro:
+		if a, ok := v.(AvroSchemer); ok {
+			return Schema{Schema: a.AvroSchema()}, nil
+		}
+	case kafka.Protobuf:
+		if p, ok := v.(ProtoSchemer); ok {
+			return Schema{Type: TypeProtobuf, Schema: p.ProtoSchema()}, nil
+		}
+	}
+	return Schema{}, fmt.Errorf("%w: %T", kafka.ErrUnsupportedType, v)
+}
+
+func (s *Serializer) register(ctx context.Context, schema Schema) (int, error) {
+	s.mu.Lock()
+	id, ok := s.ids[schema]
+	s.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	subject, err := s.subject(schema)
+	if err != nil {
+		return 0, err
+	}
+	compatible, err := s.client.CheckCompatibility(ctx, subject, schema)
+	if err != nil {
+		return 0, err
+	}
+	if !compatible {
+		return 0, fmt.Errorf("%w: %s", ErrIncompatible, subject)
+	}
+	id, err = s.client.Register(ctx, subject, schema)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	s.ids[schema] = id
+	s.mu.Unlock()
+	return id, nil
+}
+
+var (
+	protoPackage      = regexp.MustCompile(`(?m)^\s*package\s+([\w.]+)\s*;`)
+	protoFirstMessage = regexp.MustCompile(`(?m)^\s*message\s+(\w+)`)
+)
+
+// subject returns the full name of the record or message of schema.
+func (s *Serializer) subject(schema Schema) (string, error) {
+	if schema.Type == TypeProtobuf {
+		m := protoFirstMessage.FindStringSubmatch(schema.Schema)
+		if m == nil {
+			return "", errors.New("protobuf schema has no message")
+		}
+		if p := protoPackage.FindStringSubmatch(schema.Schema); p != nil {
+			return p[1] + "." + m[1], nil
+		}
+		return m[1], nil
+	}
+
+	parsed, err := s.parse(schema.Schema)
+	if err != nil {
+		return "", err
+	}
+	if parsed.Name == "" {
+		return "", errors.New("avro schema has no name")
+	}
+	return parsed.Name, nil
+}
+
+func (s *Serializer) resolve(payload []byte, writer, reader string) ([]byte, error) {
+	w, err := s.parse(writer)
+	if err != nil {
+		return nil, err
+	}
+	r, err := s.parse(reader)
+	if err != nil {
+		return nil, err
+	}
+	return avro.Resolve(payload, w, r)
+}
+
+func (s *Serializer) parse(schema string) (*avro.Schema, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if parsed, ok := s.parsed[schema]; ok {
+		return parsed, nil
+	}
+	parsed, err := avro.ParseSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	s.parsed[schema] = parsed
+	return parsed, nil
+}
+
+// skipMessageIndexes strips the Protobuf message indexes, zig-zag varints
+// prefixed by their count. Only the first message of a file is supported.
+func skipMessageIndexes(data []byte) ([]byte, error) {
+	count, n := binary.Varint(data)
+	if n <= 0 {
+		return nil, ErrNotFramed
+	}
+	data = data[n:]
+	for range count {
+		index, n := binary.Varint(data)
+		if n <= 0 {
+			return nil, ErrNotFramed
+		}
+		if index != 0 {
+			return nil, fmt.Errorf("unsupported protobuf message index %d", index)
+		}
+		data = data[n:]
+	}
+	return data, nil
+}
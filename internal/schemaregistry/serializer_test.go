@@ -0,0 +1,236 @@
+package schemaregistry
+
+import (
+	"encoding/binary"
+	"errors"
+	"kafka-go-study/internal/avro"
+	"kafka-go-study/internal/kafka"
+	"kafka-go-study/internal/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// itemV1 and itemV2 are two versions of the same record: V2 adds a field
+// with a default, so it can read data written with V1.
+type itemV1 struct {
+	ID    string
+	Price int64
+}
+
+func (itemV1) AvroSchema() string {
+	return `{"type": "record", "name": "Item", "namespace": "test", "fields": [
+		{"name": "id", "type": "string"},
+		{"name": "price", "type": "long"}
+	]}`
+}
+
+func (i itemV1) MarshalAvro() ([]byte, error) {
+	var e avro.Encoder
+	e.String(i.ID)
+	e.Long(i.Price)
+	return e.Data(), nil
+}
+
+func (i *itemV1) UnmarshalAvro(b []byte) error {
+	d := avro.NewDecoder(b)
+	*i = itemV1{ID: d.String(), Price: d.Long()}
+	return d.Err()
+}
+
+type itemV2 struct {
+	ID       string
+	Price    int64
+	Currency string
+}
+
+func (itemV2) AvroSchema() string {
+	return `{"type": "record", "name": "Item", "namespace": "test", "fields": [
+		{"name": "id", "type": "string"},
+		{"name": "price", "type": "long"},
+		{"name": "currency", "type": "string", "default": "BRL"}
+	]}`
+}
+
+func (i itemV2) MarshalAvro() ([]byte, error) {
+	var e avro.Encoder
+	e.String(i.ID)
+	e.Long(i.Price)
+	e.String(i.Currency)
+	return e.Data(), nil
+}
+
+func (i *itemV2) UnmarshalAvro(b []byte) error {
+	d := avro.NewDecoder(b)
+	*i = itemV2{ID: d.String(), Price: d.Long(), Currency: d.String()}
+	return d.Err()
+}
+
+// itemBroken changes the type of price, so it cannot read V1 data.
+type itemBroken struct{ itemV1 }
+
+func (itemBroken) AvroSchema() string {
+	return `{"type": "record", "name": "Item", "namespace": "test", "fields": [
+		{"name": "id", "type": "string"},
+		{"name": "price", "type": "string"}
+	]}`
+}
+
+func newTestSerializer(t *testing.T, format kafka.Codec) *Serializer {
+	t.Helper()
+	srv := StartFake()
+	t.Cleanup(srv.Close)
+	return NewSerializer(NewClient(srv.URL), format)
+}
+
+func schemaID(t *testing.T, data []byte) int {
+	t.Helper()
+	if len(data) < 5 || data[0] != 0 {
+		t.Fatalf("value % x is not framed", data)
+	}
+	return int(binary.BigEndian.Uint32(data[1:5]))
+}
+
+func TestSerializerAvroRoundTrip(t *testing.T) {
+	s := newTestSerializer(t, kafka.Avro)
+	in := models.Order{
+		ID:         "o-1",
+		CustomerID: "c-1",
+		Items:      []string{"book", "pen"},
+		TotalCents: 4250,
+		CreatedAt:  time.UnixMilli(1700000000000).UTC(),
+	}
+
+	data, err := s.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := schemaID(t, data); id != 1 {
+		t.Errorf("schema id = %d, want 1", id)
+	}
+	payload, _ := in.MarshalAvro()
+	if !reflect.DeepEqual(data[5:], payload) {
+		t.Errorf("payload = % x, want % x", data[5:], payload)
+	}
+
+	var out models.Order
+	if err := s.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	out.CreatedAt = out.CreatedAt.UTC()
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+	if s.ContentType() != ContentTypeAvro {
+		t.Errorf("content type = %q", s.ContentType())
+	}
+}
+
+func TestSerializerProtobufRoundTrip(t *testing.T) {
+	s := newTestSerializer(t, kafka.Protobuf)
+	in := models.Payment{OrderID: "o-1", CustomerID: "c-1", TotalCents: 4250, Status: "confirmed"}
+
+	data, err := s.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemaID(t, data)
+	if data[5] != 0 {
+		t.Errorf("message indexes = %d, want 0", data[5])
+	}
+
+	var out models.Payment
+	if err := s.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.OrderID != in.OrderID || out.TotalCents != in.TotalCents || out.Status != in.Status {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+	if s.ContentType() != ContentTypeProtobuf {
+		t.Errorf("content type = %q", s.ContentType())
+	}
+}
+
+func TestSerializerRegistersOncePerSchema(t *testing.T) {
+	s := newTestSerializer(t, kafka.Avro)
+
+	first, err := s.Marshal(itemV1{ID: "a", Price: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.Marshal(itemV1{ID: "b", Price: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	evolved, err := s.Marshal(itemV2{ID: "c", Price: 3, Currency: "USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a, b := schemaID(t, first), schemaID(t, second); a != b {
+		t.Errorf("same schema registered as %d and %d", a, b)
+	}
+	if a, c := schemaID(t, first), schemaID(t, evolved); a == c {
+		t.Errorf("evolved schema reused id %d", a)
+	}
+}
+
+func TestSerializerRefusesIncompatibleSchema(t *testing.T) {
+	s := newTestSerializer(t, kafka.Avro)
+
+	if _, err := s.Marshal(itemV1{ID: "a", Price: 1}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := s.Marshal(itemBroken{itemV1{ID: "a", Price: 1}})
+	if !errors.Is(err, ErrIncompatible) {
+		t.Errorf("Marshal = %v, want %v", err, ErrIncompatible)
+	}
+}
+
+func TestSerializerResolvesAvroWriterSchema(t *testing.T) {
+	s := newTestSerializer(t, kafka.Avro)
+
+	old, err := s.Marshal(itemV1{ID: "a", Price: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v2 itemV2
+	if err := s.Unmarshal(old, &v2); err != nil {
+		t.Fatal(err)
+	}
+	if want := (itemV2{ID: "a", Price: 100, Currency: "BRL"}); v2 != want {
+		t.Errorf("old data read as %+v, want %+v", v2, want)
+	}
+
+	evolved, err := s.Marshal(itemV2{ID: "b", Price: 200, Currency: "USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v1 itemV1
+	if err := s.Unmarshal(evolved, &v1); err != nil {
+		t.Fatal(err)
+	}
+	if want := (itemV1{ID: "b", Price: 200}); v1 != want {
+		t.Errorf("new data read as %+v, want %+v", v1, want)
+	}
+}
+
+func TestSerializerRejectsUnframedValues(t *testing.T) {
+	s := newTestSerializer(t, kafka.Avro)
+
+	for _, data := range [][]byte{nil, {0, 0, 1}, []byte(`{"id":"a"}`)} {
+		if err := s.Unmarshal(data, &itemV1{}); !errors.Is(err, ErrNotFramed) {
+			t.Errorf("Unmarshal(% x) = %v, want %v", data, err, ErrNotFramed)
+		}
+	}
+	if err := s.Unmarshal([]byte{0, 0, 0, 0, 42, 2, 'a', 2}, &itemV1{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Unmarshal with an unknown schema id = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestSerializerUnsupportedType(t *testing.T) {
+	s := newTestSerializer(t, kafka.Avro)
+	if _, err := s.Marshal(struct{}{}); !errors.Is(err, kafka.ErrUnsupportedType) {
+		t.Errorf("Marshal = %v, want %v", err, kafka.ErrUnsupportedType)
+	}
+}
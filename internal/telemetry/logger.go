@@ -10,9 +10,9 @@ import (
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/metric"
-	"go.opentelemetry.io/otel/propagation"
 	sdklog "go.opentelemetry.io/otel/sdk/log"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/exemplar"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
@@ -54,7 +54,7 @@ func Setup(ctx context.Context, serviceName string) (*zap.Logger, trace.Tracer,
 		sdktrace.WithBatcher(traceExporter),
 	)
 	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+	otel.SetTextMapPropagator(Propagator())
 	tracer := tp.Tracer(serviceName)
 
 	// --- metrics ---
@@ -68,6 +68,9 @@ func Setup(ctx context.Context, serviceName string) (*zap.Logger, trace.Tracer,
 	mp := sdkmetric.NewMeterProvider(
 		sdkmetric.WithResource(res),
 		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
+		// Measurements taken inside a sampled span carry its trace ID, so
+		// histograms such as messaging.queue.duration link back to traces.
+		sdkmetric.WithExemplarFilter(exemplar.TraceBasedFilter),
 	)
 	otel.SetMeterProvider(mp)
 	meter := mp.Meter(serviceName)
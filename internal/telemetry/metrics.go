@@ -9,6 +9,19 @@ type Metrics struct {
 	MessagesConsumed  metric.Int64Counter
 	ProcessingTime    metric.Float64Histogram
 
+	MessagesFailed       metric.Int64Counter
+	MessagesRetried      metric.Int64Counter
+	MessagesDeadLettered metric.Int64Counter
+	MessagesQuarantined  metric.Int64Counter
+	HandlerPanics        metric.Int64Counter
+	MessagesDeduplicated metric.Int64Counter
+	MessagesInFlight     metric.Int64UpDownCounter
+	WorkerUtilization    metric.Float64Gauge
+	ConsumerPaused       metric.Int64Gauge
+	ConsumerRateLimit    metric.Float64Gauge
+	RebalanceEvents      metric.Int64Counter
+	AssignedPartitions   metric.Int64Gauge
+
 	OrdersCreated     metric.Int64Counter
 	PaymentsConfirmed metric.Int64Counter
 	OrderValueCents   metric.Int64Histogram
@@ -40,6 +53,102 @@ func NewMetrics(meter metric.Meter) (*Metrics, error) {
 		return nil, err
 	}
 
+	failed, err := meter.Int64Counter("messages_failed_total",
+		metric.WithDescription("Total messages whose handler returned an error"),
+		metric.WithUnit("{message}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	retried, err := meter.Int64Counter("messages_retried_total",
+		metric.WithDescription("Total messages scheduled on a retry topic"),
+		metric.WithUnit("{message}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	deadLettered, err := meter.Int64Counter("messages_dead_lettered_total",
+		metric.WithDescription("Total messages routed to a dead-letter topic"),
+		metric.WithUnit("{message}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	quarantined, err := meter.Int64Counter("messages_quarantined_total",
+		metric.WithDescription("Total messages handed to the quarantine sink after repeated failures"),
+		metric.WithUnit("{message}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	panics, err := meter.Int64Counter("handler_panics_total",
+		metric.WithDescription("Total panics recovered from message handlers"),
+		metric.WithUnit("{panic}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	deduplicated, err := meter.Int64Counter("messages_deduplicated_total",
+		metric.WithDescription("Total duplicate messages skipped by the idempotent consumer"),
+		metric.WithUnit("{message}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	inFlight, err := meter.Int64UpDownCounter("messages_in_flight",
+		metric.WithDescription("Messages fetched from Kafka and not yet handled"),
+		metric.WithUnit("{message}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	utilization, err := meter.Float64Gauge("consumer_worker_utilization",
+		metric.WithDescription("Fraction of consumer workers busy handling a message"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	paused, err := meter.Int64Gauge("consumer_paused",
+		metric.WithDescription("Whether the consumer stopped fetching, 1 when paused"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimit, err := meter.Float64Gauge("consumer_rate_limit",
+		metric.WithDescription("Maximum messages fetched per second, 0 when unlimited"),
+		metric.WithUnit("{message}/s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rebalanceEvents, err := meter.Int64Counter("consumer_rebalance_events_total",
+		metric.WithDescription("Consumer group joins, leaves, partition assignments and revocations"),
+		metric.WithUnit("{event}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	assigned, err := meter.Int64Gauge("consumer_assigned_partitions",
+		metric.WithDescription("Partitions currently assigned to a consumer group member"),
+		metric.WithUnit("{partition}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	ordersCreated, err := meter.Int64Counter("orders_created_total",
 		metric.WithDescription("Total orders created"),
 		metric.WithUnit("{order}"),
@@ -69,6 +178,20 @@ func NewMetrics(meter metric.Meter) (*Metrics, error) {
 		MessagesPublished: published,
 		MessagesConsumed:  consumed,
 		ProcessingTime:    procTime,
+
+		MessagesFailed:       failed,
+		MessagesRetried:      retried,
+		MessagesDeadLettered: deadLettered,
+		MessagesQuarantined:  quarantined,
+		HandlerPanics:        panics,
+		MessagesDeduplicated: deduplicated,
+		MessagesInFlight:     inFlight,
+		WorkerUtilization:    utilization,
+		ConsumerPaused:       paused,
+		ConsumerRateLimit:    rateLimit,
+		RebalanceEvents:      rebalanceEvents,
+		AssignedPartitions:   assigned,
+
 		OrdersCreated:     ordersCreated,
 		PaymentsConfirmed: paymentsConfirmed,
 		OrderValueCents:   orderValue,
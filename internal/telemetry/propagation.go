@@ -0,0 +1,39 @@
+package telemetry
+
+import (
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const defaultPropagators = "tracecontext,baggage"
+
+// Propagator composes the propagators listed in OTEL_PROPAGATORS.
+func Propagator() propagation.TextMapPropagator {
+	names := os.Getenv("OTEL_PROPAGATORS")
+	if names == "" {
+		names = defaultPropagators
+	}
+
+	var props []propagation.TextMapPropagator
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "tracecontext":
+			props = append(props, propagation.TraceContext{})
+		case "baggage":
+			props = append(props, propagation.Baggage{})
+		case "b3":
+			props = append(props, b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)))
+		case "b3multi":
+			props = append(props, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case "jaeger":
+			props = append(props, jaeger.Jaeger{})
+		case "none":
+			return propagation.NewCompositeTextMapPropagator()
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(props...)
+}
@@ -0,0 +1,68 @@
+package telemetry
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestPropagatorFields(t *testing.T) {
+	for _, tc := range []struct {
+		env  string
+		want []string
+	}{
+		{"", []string{"traceparent", "tracestate", "baggage"}},
+		{"none", nil},
+		{"tracecontext,none,baggage", nil},
+		{"baggage, tracecontext", []string{"baggage", "traceparent", "tracestate"}},
+		{"b3", []string{"b3"}},
+		{"b3multi", []string{"x-b3-traceid", "x-b3-spanid", "x-b3-sampled", "x-b3-flags"}},
+		{"jaeger,tracecontext", []string{"uber-trace-id", "traceparent", "tracestate"}},
+		{"xray,tracecontext,ottrace", []string{"traceparent", "tracestate"}},
+		{"xray", nil},
+	} {
+		t.Run(tc.env, func(t *testing.T) {
+			t.Setenv("OTEL_PROPAGATORS", tc.env)
+			// The composite propagator dedups fields in no particular order;
+			// TestPropagatorOrder covers the order.
+			got := Propagator().Fields()
+			slices.Sort(got)
+			slices.Sort(tc.want)
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("OTEL_PROPAGATORS=%q: fields %v, want %v", tc.env, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPropagatorOrder(t *testing.T) {
+	w3c := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	})
+	zipkin := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{2},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(trace.ContextWithSpanContext(context.Background(), w3c), carrier)
+	b3.New().Inject(trace.ContextWithSpanContext(context.Background(), zipkin), carrier)
+
+	// Each propagator overrides the context extracted by those before it.
+	for env, want := range map[string]trace.SpanContext{
+		"tracecontext,b3": zipkin,
+		"b3,tracecontext": w3c,
+	} {
+		t.Setenv("OTEL_PROPAGATORS", env)
+		got := trace.SpanContextFromContext(Propagator().Extract(context.Background(), carrier))
+		if got.TraceID() != want.TraceID() {
+			t.Errorf("OTEL_PROPAGATORS=%q extracted trace %s, want %s", env, got.TraceID(), want.TraceID())
+		}
+	}
+}